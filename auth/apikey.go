@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"service/models"
+)
+
+// APIKeyPrefix starts every generated API key so that keys are easy to
+// recognise, for example by secret scanners
+const APIKeyPrefix = "shr_"
+
+// displayPrefixLength is how much of a key is kept in clear to identify it
+const displayPrefixLength = len(APIKeyPrefix) + 6
+
+// GenerateAPIKey returns a new random API key together with the prefix shown
+// to users and the hash to store
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:displayPrefixLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of key. API keys are long random
+// strings, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidScope reports whether scope is a known API key scope
+func ValidScope(scope string) bool {
+	switch scope {
+	case models.ScopeRead, models.ScopeWrite, models.ScopeAdmin:
+		return true
+	}
+	return false
+}
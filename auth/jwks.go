@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"service/logger"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is how long a loaded key set is used before it
+	// is loaded again
+	DefaultJWKSRefreshInterval = time.Hour
+	// minJWKSRefreshInterval limits reloads triggered by unknown key IDs, so
+	// that tokens with made-up key IDs cannot hammer the key source
+	minJWKSRefreshInterval = time.Minute
+	// maxJWKSSize caps the size of a key set document
+	maxJWKSSize = 1 << 20
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySource returns the public key a token was signed with
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JWKS is a cached JSON Web Key Set loaded from a file or URL. The set is
+// reloaded after the refresh interval and whenever a token names a key ID it
+// does not contain, so keys can be rotated without a restart. When a reload
+// fails the previously loaded keys stay in use.
+type JWKS struct {
+	fetch           func(ctx context.Context) ([]byte, error)
+	source          string
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+}
+
+// JWKSOption configures a JWKS
+type JWKSOption func(*JWKS)
+
+// WithRefreshInterval sets how long a loaded key set is used before it is
+// loaded again
+func WithRefreshInterval(d time.Duration) JWKSOption {
+	return func(k *JWKS) {
+		if d > 0 {
+			k.refreshInterval = d
+		}
+	}
+}
+
+// NewFileJWKS returns a key set read from the JSON file at path
+func NewFileJWKS(path string, opts ...JWKSOption) *JWKS {
+	return newJWKS(path, func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}, opts...)
+}
+
+// NewRemoteJWKS returns a key set fetched from url with client, or
+// http.DefaultClient when client is nil
+func NewRemoteJWKS(url string, client *http.Client, opts ...JWKSOption) *JWKS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return newJWKS(url, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching JWKS: unexpected status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	}, opts...)
+}
+
+func newJWKS(source string, fetch func(ctx context.Context) ([]byte, error), opts ...JWKSOption) *JWKS {
+	k := &JWKS{
+		fetch:           fetch,
+		source:          source,
+		refreshInterval: DefaultJWKSRefreshInterval,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	return k
+}
+
+// Refresh loads the key set from its source, replacing the cached keys
+func (k *JWKS) Refresh(ctx context.Context) error {
+	k.mu.Lock()
+	k.attemptedAt = k.now()
+	k.mu.Unlock()
+
+	data, err := k.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.loadedAt = k.now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Key returns the public key with ID kid, reloading the key set if it is
+// stale or does not contain kid. A failed reload is logged with ctx, the
+// context of the request that needed the key.
+func (k *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	key, found := k.keys[kid]
+	now := k.now()
+	stale := now.Sub(k.loadedAt) >= k.refreshInterval
+	canRetry := now.Sub(k.attemptedAt) >= minJWKSRefreshInterval
+	k.mu.RUnlock()
+
+	if (stale || !found) && canRetry {
+		// The reload serves later requests too, so it is not cancelled with
+		// this one
+		if err := k.Refresh(context.WithoutCancel(ctx)); err != nil {
+			logger.ErrorContext(ctx, "Failed to load JWKS", map[string]interface{}{
+				"error":  err.Error(),
+				"source": k.source,
+			})
+		}
+		k.mu.RLock()
+		key, found = k.keys[kid]
+		k.mu.RUnlock()
+	}
+
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// jwk is a single key of a JSON Web Key Set (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS decodes the RSA and P-256 signing keys of a JSON Web Key Set,
+// indexed by key ID. Keys of other types and encryption keys are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			key, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != 32 || len(y) != 32 {
+		return nil, errors.New("invalid P-256 key")
+	}
+	// Reject points that are not on the curve
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, errors.New("invalid P-256 key")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
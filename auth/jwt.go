@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"service/models"
+)
+
+// Supported signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// DefaultJWTLeeway is the clock skew tolerated when checking token lifetimes
+const DefaultJWTLeeway = time.Minute
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrUnsupportedAlg   = errors.New("unsupported token algorithm")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+)
+
+// JWTValidator validates bearer tokens issued by an OpenID Connect identity
+// provider and maps their claims to a Principal
+type JWTValidator struct {
+	keys       KeySource
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	roleClaim  string
+	scopeClaim string
+	now        func() time.Time
+}
+
+// JWTOption configures a JWTValidator
+type JWTOption func(*JWTValidator)
+
+// WithLeeway sets the clock skew tolerated when checking exp and nbf
+func WithLeeway(d time.Duration) JWTOption {
+	return func(v *JWTValidator) {
+		v.leeway = d
+	}
+}
+
+// WithRoleClaim sets the claim holding the user's role, "role" by default.
+// The claim may be a string or a list of strings.
+func WithRoleClaim(claim string) JWTOption {
+	return func(v *JWTValidator) {
+		if claim != "" {
+			v.roleClaim = claim
+		}
+	}
+}
+
+// WithScopeClaim sets the claim holding the granted scopes, "scope" by
+// default. The claim may be a space separated string or a list of strings.
+func WithScopeClaim(claim string) JWTOption {
+	return func(v *JWTValidator) {
+		if claim != "" {
+			v.scopeClaim = claim
+		}
+	}
+}
+
+// NewJWTValidator returns a validator accepting tokens signed by a key from
+// keys, issued by issuer and intended for audience
+func NewJWTValidator(keys KeySource, issuer, audience string, opts ...JWTOption) *JWTValidator {
+	v := &JWTValidator{
+		keys:       keys,
+		issuer:     issuer,
+		audience:   audience,
+		leeway:     DefaultJWTLeeway,
+		roleClaim:  "role",
+		scopeClaim: "scope",
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// IsJWT reports whether a bearer token looks like a compact JWS
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims holds the registered claims; other claims are kept raw for the
+// role and scope mapping
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	raw       map[string]json.RawMessage
+}
+
+// Validate verifies the signature, issuer, audience and lifetime of token and
+// returns the principal it identifies
+func (v *JWTValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := decodeSegment(parts[1], &claims.raw); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return v.principal(claims), nil
+}
+
+// checkClaims verifies the registered claims. exp and sub are required.
+func (v *JWTValidator) checkClaims(claims jwtClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil || claims.Subject == "" {
+		return ErrInvalidToken
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return ErrTokenNotYetValid
+	}
+	if claims.Issuer != v.issuer {
+		return ErrInvalidIssuer
+	}
+	if !containsString(stringOrList(claims.Audience), v.audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// principal maps token claims to a principal. The highest known role in the
+// role claim wins and unknown roles map to the user role. Tokens without
+// scopes get read and write, plus admin for admins.
+func (v *JWTValidator) principal(claims jwtClaims) *Principal {
+	role := models.RoleUser
+	roles := stringOrList(claims.raw[v.roleClaim])
+	switch {
+	case containsString(roles, models.RoleAdmin):
+		role = models.RoleAdmin
+	case containsString(roles, models.RoleModerator):
+		role = models.RoleModerator
+	}
+
+	var scopes []string
+	for _, s := range stringOrList(claims.raw[v.scopeClaim]) {
+		for _, scope := range strings.Fields(s) {
+			if ValidScope(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{models.ScopeRead, models.ScopeWrite}
+		if role == models.RoleAdmin {
+			scopes = append(scopes, models.ScopeAdmin)
+		}
+	}
+
+	return &Principal{UserID: claims.Subject, Role: role, Scopes: scopes}
+}
+
+// verifySignature checks a JWS signature. The algorithm must match the type of
+// key so that, for example, an RSA key is never used to check an ES256 token.
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlg
+		}
+		// JWS encodes ECDSA signatures as the fixed size concatenation r || s
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url encoded JSON token segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// stringOrList decodes a claim that is either a string or a list of strings
+func stringOrList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []string{s}
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
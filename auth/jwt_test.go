@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"service/logger"
+	"service/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://id.example.com"
+	testAudience = "shroomp"
+)
+
+type testSigner struct {
+	kid string
+	alg string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newRSASigner(t *testing.T, kid string) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return &testSigner{kid: kid, alg: AlgRS256, rsa: key}
+}
+
+func newECSigner(t *testing.T, kid string) *testSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return &testSigner{kid: kid, alg: AlgES256, ec: key}
+}
+
+// jwk returns the public half of the signer as a JSON Web Key
+func (s *testSigner) jwk() map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	if s.rsa != nil {
+		return map[string]string{
+			"kty": "RSA", "kid": s.kid, "use": "sig",
+			"n": enc(s.rsa.N.Bytes()),
+			"e": enc([]byte{1, 0, 1}),
+		}
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	return map[string]string{
+		"kty": "EC", "kid": s.kid, "crv": "P-256",
+		"x": enc(s.ec.X.FillBytes(x)),
+		"y": enc(s.ec.Y.FillBytes(y)),
+	}
+}
+
+// sign returns a compact JWS with the given claims
+func (s *testSigner) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	var err error
+	if s.rsa != nil {
+		sig, err = rsa.SignPKCS1v15(rand.Reader, s.rsa, crypto.SHA256, digest[:])
+	} else {
+		r, ss, signErr := ecdsa.Sign(rand.Reader, s.ec, digest[:])
+		err = signErr
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		ss.FillBytes(sig[32:])
+	}
+	if err != nil {
+		t.Fatalf("signing failed: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS writes the public keys of signers to path
+func writeJWKS(t *testing.T, path string, signers ...*testSigner) {
+	keys := make([]map[string]string, 0, len(signers))
+	for _, s := range signers {
+		keys = append(keys, s.jwk())
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "user-1",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	}
+}
+
+func TestJWTValidator_Validate(t *testing.T) {
+	rsaSigner := newRSASigner(t, "rsa-1")
+	ecSigner := newECSigner(t, "ec-1")
+	unknown := newRSASigner(t, "other")
+	// Same key ID as a published key, different key
+	impostor := newECSigner(t, "ec-1")
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaSigner, ecSigner)
+	validator := NewJWTValidator(NewFileJWKS(path), testIssuer, testAudience)
+
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		claims := validClaims()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"RS256", rsaSigner.sign(t, validClaims()), nil},
+		{"ES256", ecSigner.sign(t, validClaims()), nil},
+		{"audience list", rsaSigner.sign(t, with(map[string]interface{}{"aud": []string{"other", testAudience}})), nil},
+		{"expired", rsaSigner.sign(t, with(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), ErrTokenExpired},
+		{"expired within leeway", rsaSigner.sign(t, with(map[string]interface{}{"exp": time.Now().Add(-30 * time.Second).Unix()})), nil},
+		{"missing exp", rsaSigner.sign(t, with(map[string]interface{}{"exp": nil})), ErrInvalidToken},
+		{"missing sub", rsaSigner.sign(t, with(map[string]interface{}{"sub": nil})), ErrInvalidToken},
+		{"not yet valid", rsaSigner.sign(t, with(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})), ErrTokenNotYetValid},
+		{"wrong issuer", rsaSigner.sign(t, with(map[string]interface{}{"iss": "https://evil.example.com"})), ErrInvalidIssuer},
+		{"wrong audience", rsaSigner.sign(t, with(map[string]interface{}{"aud": "other"})), ErrInvalidAudience},
+		{"unknown key", unknown.sign(t, validClaims()), ErrUnknownKey},
+		{"bad signature", impostor.sign(t, validClaims()), ErrInvalidSignature},
+		{"alg none", unsignedToken(validClaims()), ErrUnsupportedAlg},
+		{"malformed", "not.a.token", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := validator.Validate(t.Context(), tt.token)
+			if err != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && p.UserID != "user-1" {
+				t.Errorf("Expected principal user-1, got %+v", p)
+			}
+		})
+	}
+}
+
+// unsignedToken returns a token using the "none" algorithm for the RSA key ID
+func unsignedToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "none", "kid": "rsa-1"})
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestJWTValidator_ClaimMapping(t *testing.T) {
+	signer := newECSigner(t, "ec-1")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, signer)
+	validator := NewJWTValidator(NewFileJWKS(path), testIssuer, testAudience, WithRoleClaim("roles"))
+
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		wantRole   string
+		wantScopes []string
+	}{
+		{"defaults", map[string]interface{}{}, models.RoleUser, []string{models.ScopeRead, models.ScopeWrite}},
+		{"admin role", map[string]interface{}{"roles": []string{"viewer", "admin"}}, models.RoleAdmin, []string{models.ScopeRead, models.ScopeWrite, models.ScopeAdmin}},
+		{"moderator role", map[string]interface{}{"roles": "moderator"}, models.RoleModerator, []string{models.ScopeRead, models.ScopeWrite}},
+		{"unknown role", map[string]interface{}{"roles": "superuser"}, models.RoleUser, []string{models.ScopeRead, models.ScopeWrite}},
+		{"scope string", map[string]interface{}{"scope": "openid read"}, models.RoleUser, []string{models.ScopeRead}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			p, err := validator.Validate(t.Context(), signer.sign(t, claims))
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if p.Role != tt.wantRole {
+				t.Errorf("Expected role %s, got %s", tt.wantRole, p.Role)
+			}
+			if len(p.Scopes) != len(tt.wantScopes) {
+				t.Fatalf("Expected scopes %v, got %v", tt.wantScopes, p.Scopes)
+			}
+			for i := range p.Scopes {
+				if p.Scopes[i] != tt.wantScopes[i] {
+					t.Errorf("Expected scopes %v, got %v", tt.wantScopes, p.Scopes)
+				}
+			}
+		})
+	}
+}
+
+func TestJWKS_Rotation(t *testing.T) {
+	oldSigner := newRSASigner(t, "2024")
+	newSigner := newRSASigner(t, "2025")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, oldSigner)
+
+	now := time.Now()
+	jwks := NewFileJWKS(path)
+	jwks.now = func() time.Time { return now }
+	validator := NewJWTValidator(jwks, testIssuer, testAudience)
+
+	if _, err := validator.Validate(t.Context(), oldSigner.sign(t, validClaims())); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	writeJWKS(t, path, newSigner)
+
+	// Unknown key IDs only trigger a reload once per minimum interval
+	if _, err := validator.Validate(t.Context(), newSigner.sign(t, validClaims())); err != ErrUnknownKey {
+		t.Fatalf("Expected ErrUnknownKey before the reload interval, got %v", err)
+	}
+
+	now = now.Add(minJWKSRefreshInterval)
+	if _, err := validator.Validate(t.Context(), newSigner.sign(t, validClaims())); err != nil {
+		t.Fatalf("Expected the rotated key to be picked up, got %v", err)
+	}
+
+	// A failed reload keeps the cached keys and is logged with the request
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	defer logger.SetOutput(os.Stdout)
+	os.Remove(path)
+	now = now.Add(DefaultJWKSRefreshInterval)
+	ctx := logger.WithTrace(t.Context(), logger.Trace{RequestID: "req-1"})
+	if _, err := validator.Validate(ctx, newSigner.sign(t, validClaims())); err != nil {
+		t.Errorf("Expected cached key after failed reload, got %v", err)
+	}
+	if !strings.Contains(buf.String(), `"message":"Failed to load JWKS"`) || !strings.Contains(buf.String(), `"requestId":"req-1"`) {
+		t.Errorf("Expected the failed reload to be logged with the request ID, got %s", buf.String())
+	}
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	signer := newECSigner(t, "ec-1")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, signer)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeFile(w, r, path)
+	}))
+	defer server.Close()
+
+	validator := NewJWTValidator(NewRemoteJWKS(server.URL, server.Client()), testIssuer, testAudience)
+	for i := 0; i < 3; i++ {
+		if _, err := validator.Validate(t.Context(), signer.sign(t, validClaims())); err != nil {
+			t.Fatalf("Validate failed: %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the key set to be fetched once, got %d requests", requests)
+	}
+}
+
+func TestMiddleware_JWT(t *testing.T) {
+	store, _ := newTestStore(t)
+	signer := newRSASigner(t, "rsa-1")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, signer)
+
+	authn := NewAuthenticator(store, WithJWTValidator(NewJWTValidator(NewFileJWKS(path), testIssuer, testAudience)))
+	var got *Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/items", nil)
+	req.Header.Set("Authorization", "Bearer "+signer.sign(t, validClaims()))
+	w := httptest.NewRecorder()
+	authn.Middleware(next).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || got == nil || got.UserID != "user-1" {
+		t.Fatalf("Expected authenticated request, got status %d and principal %+v", w.Code, got)
+	}
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	req = httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Authorization", "Bearer "+signer.sign(t, claims))
+	w = httptest.NewRecorder()
+	authn.Middleware(next).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for expired token, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
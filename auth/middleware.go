@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"service/models"
+	"service/problem"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrRevokedKey         = errors.New("api key has been revoked")
+)
+
+// BootstrapUserID is the principal of requests made with the bootstrap admin
+// key, which exists before any user does
+const BootstrapUserID = "bootstrap-admin"
+
+// CredentialStore looks up API keys and the users they belong to
+type CredentialStore interface {
+	GetAPIKeyByHash(hash string) (models.APIKey, error)
+	GetUser(id string) (models.User, error)
+}
+
+// Authenticator resolves request credentials to a Principal
+type Authenticator struct {
+	store         CredentialStore
+	bootstrapHash string
+	required      bool
+	jwt           *JWTValidator
+}
+
+// Option configures an Authenticator
+type Option func(*Authenticator)
+
+// WithBootstrapKey accepts key as an admin credential that is not stored
+// anywhere, so that the first users and keys can be created
+func WithBootstrapKey(key string) Option {
+	return func(a *Authenticator) {
+		if key != "" {
+			a.bootstrapHash = HashAPIKey(key)
+		}
+	}
+}
+
+// WithRequired rejects requests without credentials instead of treating them
+// as anonymous
+func WithRequired(required bool) Option {
+	return func(a *Authenticator) {
+		a.required = required
+	}
+}
+
+// WithJWTValidator also accepts bearer tokens issued by an identity provider,
+// validated by v
+func WithJWTValidator(v *JWTValidator) Option {
+	return func(a *Authenticator) {
+		a.jwt = v
+	}
+}
+
+func NewAuthenticator(store CredentialStore, opts ...Option) *Authenticator {
+	a := &Authenticator{store: store}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticate resolves an API key or, when a JWT validator is configured, an
+// identity provider token to the principal it was issued to
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	if a.jwt != nil && !IsAPIKey(key) && IsJWT(key) {
+		return a.jwt.Validate(ctx, key)
+	}
+
+	hash := HashAPIKey(key)
+	if a.bootstrapHash != "" && hash == a.bootstrapHash {
+		return &Principal{
+			UserID: BootstrapUserID,
+			Role:   models.RoleAdmin,
+			Scopes: []string{models.ScopeAdmin},
+		}, nil
+	}
+
+	apiKey, err := a.store.GetAPIKeyByHash(hash)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, ErrRevokedKey
+	}
+	user, err := a.store.GetUser(apiKey.UserID)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		UserID: user.ID,
+		Role:   user.Role,
+		Scopes: apiKey.Scopes,
+		KeyID:  apiKey.ID,
+	}, nil
+}
+
+// Middleware authenticates the API key or identity provider token sent as a
+// bearer token, or the API key sent in the X-API-Key header, and stores the
+// principal in the request context. Requests without credentials pass through
+// anonymously unless authentication is required. Invalid credentials are
+// always rejected with 401, and credentials lacking the scope the request
+// needs with 403.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := credential(r)
+		if key == "" {
+			if a.required {
+				unauthorized(w, r, "Authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := a.Authenticate(r.Context(), key)
+		if err != nil {
+			unauthorized(w, r, err.Error())
+			return
+		}
+		if !p.HasScope(RequiredScope(r)) {
+			problem.Error(w, r, http.StatusForbidden, "Insufficient scope")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// RequiredScope returns the scope a request needs: admin for /admin/ and
+// /debug/ endpoints, read for safe methods and write for everything else
+func RequiredScope(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/debug/") {
+		return models.ScopeAdmin
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.ScopeRead
+	default:
+		return models.ScopeWrite
+	}
+}
+
+// credential extracts an API key from the Authorization or X-API-Key header
+func credential(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// unauthorized writes a 401 response with a bearer challenge
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="shroomp"`)
+	problem.Error(w, r, http.StatusUnauthorized, message)
+}
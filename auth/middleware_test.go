@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"service/problem"
+	"testing"
+	"time"
+)
+
+type fakeCredentialStore struct {
+	keys  map[string]models.APIKey
+	users map[string]models.User
+}
+
+func (f *fakeCredentialStore) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	for _, key := range f.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrInvalidCredentials
+}
+
+func (f *fakeCredentialStore) GetUser(id string) (models.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// newTestStore returns a store with one read-only key, one read-write key and
+// one revoked key for user-1
+func newTestStore(t *testing.T) (*fakeCredentialStore, map[string]string) {
+	store := &fakeCredentialStore{
+		keys:  make(map[string]models.APIKey),
+		users: map[string]models.User{"user-1": {ID: "user-1", Role: models.RoleUser}},
+	}
+	plain := make(map[string]string)
+	revoked := time.Now()
+
+	for name, key := range map[string]models.APIKey{
+		"read":    {ID: "key-read", UserID: "user-1", Scopes: []string{models.ScopeRead}},
+		"write":   {ID: "key-write", UserID: "user-1", Scopes: []string{models.ScopeRead, models.ScopeWrite}},
+		"revoked": {ID: "key-revoked", UserID: "user-1", Scopes: []string{models.ScopeRead}, RevokedAt: &revoked},
+	} {
+		k, _, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey failed: %v", err)
+		}
+		key.Hash = hash
+		store.keys[key.ID] = key
+		plain[name] = k
+	}
+	return store, plain
+}
+
+func TestMiddleware(t *testing.T) {
+	store, keys := newTestStore(t)
+	const bootstrap = "bootstrap-secret"
+
+	tests := []struct {
+		name       string
+		required   bool
+		method     string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+		wantUser   string
+	}{
+		{"anonymous", false, http.MethodGet, "/items", "", "", http.StatusOK, ""},
+		{"anonymous when required", true, http.MethodGet, "/items", "", "", http.StatusUnauthorized, ""},
+		{"bearer key", false, http.MethodGet, "/items", "Authorization", "Bearer " + keys["read"], http.StatusOK, "user-1"},
+		{"x-api-key header", false, http.MethodPost, "/items", "X-API-Key", keys["write"], http.StatusOK, "user-1"},
+		{"unknown key", false, http.MethodGet, "/items", "X-API-Key", "shr_unknown", http.StatusUnauthorized, ""},
+		{"revoked key", false, http.MethodGet, "/items", "X-API-Key", keys["revoked"], http.StatusUnauthorized, ""},
+		{"read key writing", false, http.MethodPost, "/items", "X-API-Key", keys["read"], http.StatusForbidden, ""},
+		{"write key on admin endpoint", false, http.MethodGet, "/admin/keys", "X-API-Key", keys["write"], http.StatusForbidden, ""},
+		{"write key on debug endpoint", false, http.MethodGet, "/debug/pprof/heap", "X-API-Key", keys["write"], http.StatusForbidden, ""},
+		{"bootstrap key", true, http.MethodPost, "/admin/keys", "X-API-Key", bootstrap, http.StatusOK, BootstrapUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authn := NewAuthenticator(store, WithBootstrapKey(bootstrap), WithRequired(tt.required))
+
+			var got *Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			authn.Middleware(next).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate header on 401")
+			}
+			if w.Code >= 400 && w.Header().Get("Content-Type") != problem.ContentType {
+				t.Errorf("Expected a problem details response, got %s", w.Header().Get("Content-Type"))
+			}
+			if tt.wantUser == "" {
+				if got != nil {
+					t.Errorf("Expected no principal, got %+v", got)
+				}
+				return
+			}
+			if got == nil || got.UserID != tt.wantUser {
+				t.Errorf("Expected principal %s, got %+v", tt.wantUser, got)
+			}
+		})
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey failed: %v", err)
+	}
+	if !IsAPIKey(key) {
+		t.Errorf("Expected key to start with %s, got %s", APIKeyPrefix, key)
+	}
+	if key[:len(prefix)] != prefix {
+		t.Errorf("Expected prefix %s to start key", prefix)
+	}
+	if hash != HashAPIKey(key) {
+		t.Error("Expected hash to match HashAPIKey(key)")
+	}
+
+	other, _, _, _ := GenerateAPIKey()
+	if other == key {
+		t.Error("Expected distinct keys")
+	}
+}
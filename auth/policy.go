@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"service/models"
+	"service/problem"
+)
+
+// RoleAnonymous is the role of requests made without credentials
+const RoleAnonymous = "anonymous"
+
+// Role sets used by the default policy
+var (
+	everyone      = []string{RoleAnonymous, models.RoleUser, models.RoleModerator, models.RoleAdmin}
+	authenticated = []string{models.RoleUser, models.RoleModerator, models.RoleAdmin}
+	adminsOnly    = []string{models.RoleAdmin}
+)
+
+// Rule grants the listed roles access to a method on a route. Pattern
+// segments written as {name} match any single path segment.
+type Rule struct {
+	Method  string
+	Pattern string
+	Roles   []string
+}
+
+// Policy is a permission matrix evaluated per route and method. Requests to a
+// route that no rule grants are denied.
+type Policy struct {
+	rules []Rule
+}
+
+func NewPolicy(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// DefaultPolicy returns the permission matrix for every route served by the
+// API. Ownership of individual sightings is checked by the handlers on top of
+// it.
+func DefaultPolicy() *Policy {
+	return NewPolicy(
+		Rule{http.MethodGet, "/items", everyone},
+		Rule{http.MethodPost, "/items", everyone},
+		Rule{http.MethodGet, "/items/{id}", everyone},
+		Rule{http.MethodPut, "/items/{id}", everyone},
+		Rule{http.MethodPatch, "/items/{id}", authenticated},
+		Rule{http.MethodDelete, "/items/{id}", everyone},
+		Rule{http.MethodPost, "/items/{id}/restore", everyone},
+		Rule{http.MethodPost, "/items/{id}/revert", everyone},
+		Rule{http.MethodGet, "/items/{id}/history", everyone},
+		Rule{http.MethodGet, "/items/{id}/history/{rev}", everyone},
+		Rule{http.MethodPost, "/items:batch", everyone},
+		Rule{http.MethodGet, "/sync", everyone},
+		Rule{http.MethodPost, "/sync", everyone},
+		Rule{http.MethodGet, "/trash", everyone},
+		Rule{http.MethodDelete, "/trash", adminsOnly},
+		Rule{http.MethodDelete, "/trash/{id}", adminsOnly},
+		Rule{http.MethodGet, "/users", adminsOnly},
+		Rule{http.MethodPost, "/users", adminsOnly},
+		Rule{http.MethodGet, "/users/{id}", authenticated},
+		Rule{http.MethodPut, "/users/{id}", authenticated},
+		Rule{http.MethodGet, "/admin/keys", adminsOnly},
+		Rule{http.MethodPost, "/admin/keys", adminsOnly},
+		Rule{http.MethodDelete, "/admin/keys/{id}", adminsOnly},
+		Rule{http.MethodGet, "/healthz", everyone},
+		Rule{http.MethodGet, "/readyz", everyone},
+		Rule{http.MethodGet, "/status", adminsOnly},
+		Rule{http.MethodGet, "/metrics", everyone},
+	)
+}
+
+// DebugPolicy returns the permission matrix for the profiling and debug
+// endpoints, which only admins may use
+func DebugPolicy() *Policy {
+	return NewPolicy(
+		Rule{http.MethodGet, "/debug/pprof", adminsOnly},
+		Rule{http.MethodGet, "/debug/pprof/{profile}", adminsOnly},
+		Rule{http.MethodPost, "/debug/pprof/symbol", adminsOnly},
+		Rule{http.MethodGet, "/debug/vars", adminsOnly},
+		Rule{http.MethodGet, "/debug/goroutines", adminsOnly},
+		Rule{http.MethodGet, "/debug/storage/locks", adminsOnly},
+	)
+}
+
+// Allowed reports whether role may send a request with method to path. HEAD
+// requests are treated as GET.
+func (p *Policy) Allowed(role, method, path string) bool {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, rule := range p.rules {
+		if rule.Method == method && matchPattern(rule.Pattern, path) {
+			for _, r := range rule.Roles {
+				if r == role {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// Route returns the pattern of the first rule matching path, whatever the
+// method, or "" if none does. Patterns name routes without the unbounded
+// variety of IDs in paths, for use in metrics.
+func (p *Policy) Route(path string) string {
+	for _, rule := range p.rules {
+		if matchPattern(rule.Pattern, path) {
+			return rule.Pattern
+		}
+	}
+	return ""
+}
+
+// Methods returns the methods that rules grant on path to any role, in rule
+// order
+func (p *Policy) Methods(path string) []string {
+	var methods []string
+	for _, rule := range p.rules {
+		if matchPattern(rule.Pattern, path) && !slices.Contains(methods, rule.Method) {
+			methods = append(methods, rule.Method)
+		}
+	}
+	return methods
+}
+
+// Middleware rejects requests the policy does not allow for the principal's
+// role: anonymous requests with 401 so that clients know to authenticate, and
+// all others with 403. Paths no rule covers are denied with 404 before they
+// reach next, so that routes added without a rule stay unreachable, and
+// methods no rule grants on a covered path get 405. It must run after the
+// Authenticator middleware.
+func (p *Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := p.Methods(r.URL.Path)
+		if len(methods) == 0 {
+			problem.Error(w, r, http.StatusNotFound, "")
+			return
+		}
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if !slices.Contains(methods, method) {
+			problem.MethodNotAllowed(w, r, methods...)
+			return
+		}
+
+		principal := FromContext(r.Context())
+		if p.Allowed(principal.EffectiveRole(), r.Method, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if principal == nil && p.allowsAuthenticated(r.Method, r.URL.Path) {
+			unauthorized(w, r, "Authentication required")
+			return
+		}
+		problem.Error(w, r, http.StatusForbidden, "")
+	})
+}
+
+// allowsAuthenticated reports whether any authenticated role may send the
+// request
+func (p *Policy) allowsAuthenticated(method, path string) bool {
+	for _, role := range authenticated {
+		if p.Allowed(role, method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether path matches pattern segment by segment. A
+// trailing slash on path is ignored.
+func matchPattern(pattern, path string) bool {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	const (
+		anon  = RoleAnonymous
+		user  = models.RoleUser
+		mod   = models.RoleModerator
+		admin = models.RoleAdmin
+	)
+	all := []string{anon, user, mod, admin}
+
+	// One entry per route and method served by main.go, listing the roles
+	// that are allowed; every other role must be denied
+	tests := []struct {
+		method  string
+		path    string
+		allowed []string
+	}{
+		{http.MethodGet, "/items", all},
+		{http.MethodHead, "/items", all},
+		{http.MethodPost, "/items", all},
+		{http.MethodGet, "/items/abc", all},
+		{http.MethodPut, "/items/abc", all},
+		{http.MethodPatch, "/items/abc", []string{user, mod, admin}},
+		{http.MethodDelete, "/items/abc", all},
+		{http.MethodPost, "/items/abc/restore", all},
+		{http.MethodPost, "/items/abc/revert", all},
+		{http.MethodGet, "/items/abc/history", all},
+		{http.MethodGet, "/items/abc/history/3", all},
+		{http.MethodPost, "/items:batch", all},
+		{http.MethodGet, "/sync", all},
+		{http.MethodPost, "/sync", all},
+		{http.MethodGet, "/trash", all},
+		{http.MethodDelete, "/trash", []string{admin}},
+		{http.MethodDelete, "/trash/abc", []string{admin}},
+		{http.MethodGet, "/users", []string{admin}},
+		{http.MethodPost, "/users", []string{admin}},
+		{http.MethodGet, "/users/me", []string{user, mod, admin}},
+		{http.MethodPut, "/users/abc", []string{user, mod, admin}},
+		{http.MethodGet, "/admin/keys", []string{admin}},
+		{http.MethodPost, "/admin/keys", []string{admin}},
+		{http.MethodDelete, "/admin/keys/abc", []string{admin}},
+		{http.MethodGet, "/healthz", all},
+		{http.MethodGet, "/readyz", all},
+		{http.MethodGet, "/status", []string{admin}},
+		{http.MethodGet, "/metrics", all},
+
+		// Deny by default
+		{http.MethodDelete, "/items", nil},
+		{http.MethodPut, "/items/abc/restore", nil},
+		{http.MethodGet, "/items/abc/unknown", nil},
+		{http.MethodPost, "/trash/abc", nil},
+		{http.MethodDelete, "/users/abc", nil},
+		{http.MethodGet, "/admin/keys/abc", nil},
+		{http.MethodGet, "/unknown", nil},
+		{http.MethodGet, "/", nil},
+	}
+
+	policy := DefaultPolicy()
+	for _, tt := range tests {
+		for _, role := range all {
+			want := false
+			for _, r := range tt.allowed {
+				if r == role {
+					want = true
+				}
+			}
+			if got := policy.Allowed(role, tt.method, tt.path); got != want {
+				t.Errorf("%s %s as %s: expected allowed=%v, got %v", tt.method, tt.path, role, want, got)
+			}
+		}
+	}
+}
+
+func TestDebugPolicy(t *testing.T) {
+	policy := DebugPolicy()
+
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/debug/pprof/", true},
+		{http.MethodGet, "/debug/pprof/heap", true},
+		{http.MethodGet, "/debug/pprof/profile", true},
+		{http.MethodPost, "/debug/pprof/symbol", true},
+		{http.MethodGet, "/debug/vars", true},
+		{http.MethodGet, "/debug/goroutines", true},
+		{http.MethodGet, "/debug/storage/locks", true},
+		{http.MethodPost, "/debug/pprof/heap", false},
+		{http.MethodGet, "/items", false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Allowed(models.RoleAdmin, tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s as admin: expected allowed=%v, got %v", tt.method, tt.path, tt.want, got)
+		}
+		for _, role := range []string{RoleAnonymous, models.RoleUser, models.RoleModerator} {
+			if policy.Allowed(role, tt.method, tt.path) {
+				t.Errorf("%s %s as %s: expected denied", tt.method, tt.path, role)
+			}
+		}
+	}
+}
+
+func TestPolicy_Middleware(t *testing.T) {
+	policy := DefaultPolicy()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		principal  *Principal
+		wantStatus int
+	}{
+		{"anonymous allowed", http.MethodGet, "/items", nil, http.StatusOK},
+		{"anonymous needs login", http.MethodPatch, "/items/abc", nil, http.StatusUnauthorized},
+		{"anonymous admin route", http.MethodDelete, "/trash", nil, http.StatusUnauthorized},
+		{"anonymous unknown route", http.MethodGet, "/unknown", nil, http.StatusNotFound},
+		{"admin unknown route", http.MethodGet, "/unknown", &Principal{UserID: "a", Role: models.RoleAdmin, Scopes: []string{models.ScopeAdmin}}, http.StatusNotFound},
+		{"unknown method", http.MethodPost, "/items/abc", nil, http.StatusMethodNotAllowed},
+		{"head as get", http.MethodHead, "/items", nil, http.StatusOK},
+		{"user admin route", http.MethodDelete, "/trash", &Principal{UserID: "u", Role: models.RoleUser, Scopes: []string{models.ScopeWrite}}, http.StatusForbidden},
+		{"moderator admin route", http.MethodGet, "/users", &Principal{UserID: "m", Role: models.RoleModerator, Scopes: []string{models.ScopeRead}}, http.StatusForbidden},
+		{"admin without admin scope", http.MethodGet, "/users", &Principal{UserID: "a", Role: models.RoleAdmin, Scopes: []string{models.ScopeRead}}, http.StatusForbidden},
+		{"admin", http.MethodGet, "/users", &Principal{UserID: "a", Role: models.RoleAdmin, Scopes: []string{models.ScopeAdmin}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+			}
+			w := httptest.NewRecorder()
+			policy.Middleware(next).ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, PUT, PATCH, DELETE" {
+				t.Errorf("Expected Allow: GET, PUT, PATCH, DELETE, got %q", w.Header().Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestPolicy_Route(t *testing.T) {
+	policy := DefaultPolicy()
+
+	tests := []struct {
+		path  string
+		route string
+	}{
+		{"/items", "/items"},
+		{"/items/3f2a", "/items/{id}"},
+		{"/items/3f2a/", "/items/{id}"},
+		{"/items/3f2a/history/12", "/items/{id}/history/{rev}"},
+		{"/users/me", "/users/{id}"},
+		{"/healthz", "/healthz"},
+		{"/unknown", ""},
+		{"/items/3f2a/unknown", ""},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Route(tt.path); got != tt.route {
+			t.Errorf("Route(%q): expected %q, got %q", tt.path, tt.route, got)
+		}
+	}
+}
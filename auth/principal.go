@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+
+	"service/models"
+)
+
+// Principal is the authenticated identity a request is made on behalf of
+type Principal struct {
+	UserID string
+	Role   string
+	// Scopes limit what the credential used for the request may do
+	Scopes []string
+	// KeyID identifies the API key the request was authenticated with
+	KeyID string
+}
+
+// HasScope reports whether the principal was granted scope. The admin scope
+// implies every other scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope || s == models.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRole returns the role the principal acts with: RoleAnonymous for
+// unauthenticated requests, and the user role for admins whose credential
+// lacks the admin scope
+func (p *Principal) EffectiveRole() string {
+	switch {
+	case p == nil:
+		return RoleAnonymous
+	case p.Role == models.RoleAdmin && !p.IsAdmin():
+		return models.RoleUser
+	}
+	return p.Role
+}
+
+// IsModerator reports whether the principal may correct species
+// identifications, which admins may do as well
+func (p *Principal) IsModerator() bool {
+	switch p.EffectiveRole() {
+	case models.RoleModerator, models.RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// IsAdmin reports whether the principal has the admin role and authenticated
+// with a credential carrying the admin scope
+func (p *Principal) IsAdmin() bool {
+	return p != nil && p.Role == models.RoleAdmin && p.HasScope(models.ScopeAdmin)
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, or nil for anonymous
+// requests
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"service/logger"
+	"service/middleware"
+	"service/privacy"
+	"service/storage"
+)
+
+// Storage backends
+const (
+	BackendFile   = "file"
+	BackendMemory = "memory"
+)
+
+// Trace exporters
+const (
+	TracingNone     = "none"
+	TracingStdout   = "stdout"
+	TracingOTLPFile = "otlp-file"
+)
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// redacted replaces secrets in Redacted
+const redacted = "[redacted]"
+
+// Config is the complete service configuration
+type Config struct {
+	Port    int           `json:"port"`
+	Server  ServerConfig  `json:"server"`
+	Storage StorageConfig `json:"storage"`
+	Auth    AuthConfig    `json:"auth"`
+	Limits  LimitsConfig  `json:"limits"`
+	CORS    CORSConfig    `json:"cors"`
+	Privacy PrivacyConfig `json:"privacy"`
+	Logging LoggingConfig `json:"logging"`
+	Metrics MetricsConfig `json:"metrics"`
+	Tracing TracingConfig `json:"tracing"`
+	Debug   DebugConfig   `json:"debug"`
+}
+
+type ServerConfig struct {
+	ReadTimeout  Duration `json:"readTimeout"`
+	WriteTimeout Duration `json:"writeTimeout"`
+	IdleTimeout  Duration `json:"idleTimeout"`
+	// DrainDelay is how long the server keeps accepting requests after
+	// readiness starts failing, so that load balancers notice before
+	// connections are refused
+	DrainDelay Duration `json:"drainDelay"`
+	// ShutdownTimeout is how long in-flight requests may take to finish once
+	// the server is asked to stop
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// AllowUnknownFields accepts request bodies with fields the API does not
+	// define instead of rejecting them
+	AllowUnknownFields bool `json:"allowUnknownFields"`
+}
+
+type StorageConfig struct {
+	// Backend is "file" to persist to Path or "memory" to keep nothing
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+	// TrashRetentionDays is how long deleted sightings are kept, 0 for ever
+	TrashRetentionDays int `json:"trashRetentionDays"`
+	// MinFreeDiskMB is the free disk space below which the service is not
+	// ready, 0 to disable the check
+	MinFreeDiskMB int `json:"minFreeDiskMb"`
+}
+
+type AuthConfig struct {
+	Required      bool   `json:"required"`
+	AdminAPIKey   string `json:"adminApiKey"`
+	JWKSURL       string `json:"jwksUrl"`
+	JWKSFile      string `json:"jwksFile"`
+	JWTIssuer     string `json:"jwtIssuer"`
+	JWTAudience   string `json:"jwtAudience"`
+	JWTRoleClaim  string `json:"jwtRoleClaim"`
+	JWTScopeClaim string `json:"jwtScopeClaim"`
+	// EditUnowned lets everyone change sightings created anonymously instead
+	// of only admins
+	EditUnowned bool `json:"editUnowned"`
+}
+
+type LimitsConfig struct {
+	// Rate limits are written as "requests/duration[,burst]" or "off"
+	RateLimitRead   string   `json:"rateLimitRead"`
+	RateLimitWrite  string   `json:"rateLimitWrite"`
+	RateLimitUpload string   `json:"rateLimitUpload"`
+	RateLimitAuth   string   `json:"rateLimitAuth"`
+	TrustedProxies  []string `json:"trustedProxies"`
+	IdempotencyTTL  Duration `json:"idempotencyTtl"`
+	// MaxBodyKB limits request bodies without sightings, MaxUploadMB those
+	// with sightings, whose images are inline
+	MaxBodyKB   int `json:"maxBodyKb"`
+	MaxUploadMB int `json:"maxUploadMb"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	AllowCredentials bool     `json:"allowCredentials"`
+	MaxAge           Duration `json:"maxAge"`
+}
+
+type PrivacyConfig struct {
+	LocationGridDegrees float64 `json:"locationGridDegrees"`
+	// SensitiveSpecies maps species names to their minimum visibility
+	SensitiveSpecies map[string]string `json:"sensitiveSpecies"`
+}
+
+type LoggingConfig struct {
+	Level string `json:"level"`
+	// Format is json for Cloud Logging or text for local development
+	Format string `json:"format"`
+	// File also appends JSON entries to this file
+	File string `json:"file"`
+	// RedactKeys and RedactPatterns mask more metadata keys and text than
+	// logger's defaults; coordinates are rounded to LocationDecimals
+	RedactKeys       []string `json:"redactKeys"`
+	RedactPatterns   []string `json:"redactPatterns"`
+	LocationDecimals int      `json:"locationDecimals"`
+	// AccessLog writes one entry per request; AccessLogSampleRate is the
+	// fraction of fast, successful requests that are logged
+	AccessLog           bool    `json:"accessLog"`
+	AccessLogSampleRate float64 `json:"accessLogSampleRate"`
+	// SlowRequestThreshold flags slower requests in the access log
+	SlowRequestThreshold Duration `json:"slowRequestThreshold"`
+}
+
+type MetricsConfig struct {
+	// Enabled serves /metrics, which bypasses API authentication, so it
+	// requires Token
+	Enabled bool `json:"enabled"`
+	// Token must be sent as a bearer token to read /metrics
+	Token string `json:"token"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp-file, which appends OTLP JSON spans
+	// to File
+	Exporter string `json:"exporter"`
+	File     string `json:"file"`
+}
+
+type DebugConfig struct {
+	// Port serves profiling and debug endpoints to admins, 0 to disable them
+	Port int `json:"port"`
+}
+
+// Duration is a time.Duration written as a string such as "12h" in
+// configuration files
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("duration must be a string such as \"12h\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Default returns the configuration used when nothing is configured
+func Default() *Config {
+	return &Config{
+		Port: 8080,
+		Server: ServerConfig{
+			ReadTimeout:  Duration(30 * time.Second),
+			WriteTimeout: Duration(60 * time.Second),
+			IdleTimeout:  Duration(120 * time.Second),
+			// Cloud Run kills the container 10 seconds after SIGTERM, which
+			// leaves time to flush storage after draining
+			ShutdownTimeout: Duration(8 * time.Second),
+		},
+		Storage: StorageConfig{
+			Backend:            BackendFile,
+			Path:               storage.DefaultDataFile,
+			TrashRetentionDays: 30,
+			MinFreeDiskMB:      100,
+		},
+		Limits: LimitsConfig{
+			RateLimitRead:   "600/1m",
+			RateLimitWrite:  "120/1m",
+			RateLimitUpload: "30/1m",
+			RateLimitAuth:   "20/1m",
+			IdempotencyTTL:  Duration(storage.DefaultIdempotencyTTL),
+			MaxBodyKB:       64,
+			MaxUploadMB:     10,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+		},
+		Privacy: PrivacyConfig{
+			LocationGridDegrees: privacy.DefaultGrid,
+		},
+		Logging: LoggingConfig{
+			Level:                "info",
+			Format:               LogFormatJSON,
+			LocationDecimals:     logger.DefaultLocationDecimals,
+			AccessLog:            true,
+			AccessLogSampleRate:  1,
+			SlowRequestThreshold: Duration(middleware.DefaultSlowRequestThreshold),
+		},
+		Tracing: TracingConfig{
+			Exporter: TracingNone,
+			File:     "traces.jsonl",
+		},
+	}
+}
+
+// Validate reports every invalid setting
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port must be between 1 and 65535")
+	check(c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0, "server timeouts must not be negative")
+	check(c.Server.DrainDelay >= 0, "server.drainDelay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout must be positive")
+
+	check(c.Storage.Backend == BackendFile || c.Storage.Backend == BackendMemory, "storage.backend must be one of file, memory")
+	check(c.Storage.Backend != BackendFile || c.Storage.Path != "", "storage.path is required for the file backend")
+	check(c.Storage.TrashRetentionDays >= 0, "storage.trashRetentionDays must not be negative")
+	check(c.Storage.MinFreeDiskMB >= 0, "storage.minFreeDiskMb must not be negative")
+
+	if c.Auth.JWKSURL != "" || c.Auth.JWKSFile != "" {
+		check(c.Auth.JWTIssuer != "" && c.Auth.JWTAudience != "", "auth.jwtIssuer and auth.jwtAudience are required with a JWKS")
+	}
+
+	for _, limit := range []struct{ name, value string }{
+		{"limits.rateLimitRead", c.Limits.RateLimitRead},
+		{"limits.rateLimitWrite", c.Limits.RateLimitWrite},
+		{"limits.rateLimitUpload", c.Limits.RateLimitUpload},
+		{"limits.rateLimitAuth", c.Limits.RateLimitAuth},
+	} {
+		_, err := middleware.ParseLimit(limit.value)
+		check(err == nil, "%s: %v", limit.name, err)
+	}
+	for _, proxy := range c.Limits.TrustedProxies {
+		_, err := middleware.ParseTrustedProxies(proxy)
+		check(err == nil, "limits.trustedProxies: %v", err)
+	}
+	check(c.Limits.IdempotencyTTL > 0, "limits.idempotencyTtl must be positive")
+	check(c.Limits.MaxBodyKB > 0, "limits.maxBodyKb must be positive")
+	check(c.Limits.MaxUploadMB > 0, "limits.maxUploadMb must be positive")
+
+	_, err := middleware.NewCORS(c.CORSOptions()...)
+	check(err == nil, "cors: %v", err)
+	check(c.CORS.MaxAge >= 0, "cors.maxAge must not be negative")
+
+	check(c.Privacy.LocationGridDegrees > 0, "privacy.locationGridDegrees must be positive")
+	for species, visibility := range c.Privacy.SensitiveSpecies {
+		check(privacy.ValidVisibility(visibility) && visibility != "", "privacy.sensitiveSpecies: invalid visibility %q for %s", visibility, species)
+	}
+
+	_, err = logger.ParseLevel(c.Logging.Level)
+	check(err == nil, "logging.level: %v", err)
+	check(c.Logging.Format == LogFormatJSON || c.Logging.Format == LogFormatText, "logging.format must be one of json, text")
+	for _, pattern := range c.Logging.RedactPatterns {
+		_, err := regexp.Compile(pattern)
+		check(err == nil, "logging.redactPatterns: %v", err)
+	}
+	check(c.Logging.LocationDecimals >= 0, "logging.locationDecimals must not be negative")
+	check(c.Logging.AccessLogSampleRate >= 0 && c.Logging.AccessLogSampleRate <= 1, "logging.accessLogSampleRate must be between 0 and 1")
+	check(c.Logging.SlowRequestThreshold >= 0, "logging.slowRequestThreshold must not be negative")
+
+	check(!c.Metrics.Enabled || c.Metrics.Token != "", "metrics.token is required when metrics are enabled")
+
+	check(c.Tracing.Exporter == TracingNone || c.Tracing.Exporter == TracingStdout || c.Tracing.Exporter == TracingOTLPFile, "tracing.exporter must be one of none, stdout, otlp-file")
+	check(c.Tracing.Exporter != TracingOTLPFile || c.Tracing.File != "", "tracing.file is required for the otlp-file exporter")
+
+	check(c.Debug.Port >= 0 && c.Debug.Port < 65536, "debug.port must be between 0 and 65535")
+	check(c.Debug.Port == 0 || c.Debug.Port != c.Port, "debug.port must differ from port")
+
+	return errors.Join(errs...)
+}
+
+// CORSOptions returns the CORS policy options for the configuration
+func (c *Config) CORSOptions() []middleware.CORSOption {
+	return []middleware.CORSOption{
+		middleware.WithAllowedOrigins(c.CORS.AllowedOrigins...),
+		middleware.WithAllowCredentials(c.CORS.AllowCredentials),
+		middleware.WithMaxAge(time.Duration(c.CORS.MaxAge)),
+	}
+}
+
+// Redacted returns a copy of the configuration that is safe to log
+func (c *Config) Redacted() Config {
+	r := *c
+	if r.Auth.AdminAPIKey != "" {
+		r.Auth.AdminAPIKey = redacted
+	}
+	if r.Metrics.Token != "" {
+		r.Metrics.Token = redacted
+	}
+	return r
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	c, err := load(nil, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if c.Port != 8080 || c.Storage.Backend != BackendFile || c.Storage.Path != "data.json" {
+		t.Errorf("Unexpected defaults: %+v", c)
+	}
+	if time.Duration(c.Limits.IdempotencyTTL) != 24*time.Hour {
+		t.Errorf("Expected 24h idempotency TTL, got %v", time.Duration(c.Limits.IdempotencyTTL))
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"port": 9000,
+		"storage": {"path": "file.json", "trashRetentionDays": 7},
+		"limits": {"rateLimitRead": "100/1m", "idempotencyTtl": "1h"},
+		"logging": {"level": "debug"}
+	}`)
+
+	c, err := load(
+		[]string{"-config", path, "-data-file", "flag.json", "-auth-required"},
+		env(map[string]string{
+			"DATA_FILE":       "env.json",
+			"RATE_LIMIT_READ": "200/1m",
+			"LOG_LEVEL":       "warning",
+		}),
+		io.Discard,
+	)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"file over default", c.Port, 9000},
+		{"file over default", c.Storage.TrashRetentionDays, 7},
+		{"file over default", time.Duration(c.Limits.IdempotencyTTL), time.Hour},
+		{"env over file", c.Limits.RateLimitRead, "200/1m"},
+		{"env over file", c.Logging.Level, "warning"},
+		{"flag over env", c.Storage.Path, "flag.json"},
+		{"boolean flag without value", c.Auth.Required, true},
+		{"default kept", c.Limits.RateLimitWrite, "120/1m"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestLoad_ConfigFileFromEnv(t *testing.T) {
+	path := writeConfig(t, `{"storage": {"backend": "memory"}}`)
+	c, err := load(nil, env(map[string]string{"CONFIG_FILE": path}), io.Discard)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if c.Storage.Backend != BackendMemory {
+		t.Errorf("Expected memory backend, got %s", c.Storage.Backend)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		want string
+	}{
+		{"unknown file key", nil, nil, `{"prot": 9000}`, "unknown field"},
+		{"invalid duration in file", nil, nil, `{"limits": {"idempotencyTtl": 60}}`, "duration"},
+		{"invalid env number", nil, map[string]string{"PORT": "http"}, "", "invalid PORT"},
+		{"invalid env boolean", nil, map[string]string{"AUTH_REQUIRED": "yes please"}, "", "invalid AUTH_REQUIRED"},
+		{"invalid flag", []string{"-cors-max-age", "long"}, nil, "", "invalid -cors-max-age"},
+		{"unknown flag", []string{"-verbose"}, nil, "", "not defined"},
+		{"positional argument", []string{"serve"}, nil, "", "unexpected arguments"},
+		{"invalid species", nil, map[string]string{"SENSITIVE_SPECIES": "Morel:secret"}, "", "invalid SENSITIVE_SPECIES"},
+		{"validation", nil, map[string]string{"STORAGE_BACKEND": "sql"}, "", "storage.backend"},
+		{"yaml file", []string{"-config", "config.yaml"}, nil, "", "YAML is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, tt.file)}, args...)
+			}
+			_, err := load(args, env(tt.env), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_RedactPatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{"env, one per line", nil, map[string]string{"LOG_REDACT_PATTERNS": "\\d{3,4}\n  [a-z]{2,}-key  \n"}, []string{`\d{3,4}`, `[a-z]{2,}-key`}},
+		{"repeated flag", []string{"-log-redact-patterns", `\d{3,4}`, "-log-redact-patterns", `x{1,2}`}, map[string]string{"LOG_REDACT_PATTERNS": "env"}, []string{`\d{3,4}`, `x{1,2}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := load(tt.args, env(tt.env), io.Discard)
+			if err != nil {
+				t.Fatalf("load failed: %v", err)
+			}
+			if !slices.Equal(c.Logging.RedactPatterns, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, c.Logging.RedactPatterns)
+			}
+		})
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	if _, err := load([]string{"-h"}, env(nil), io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"port", func(c *Config) { c.Port = 70000 }, "port"},
+		{"drain delay", func(c *Config) { c.Server.DrainDelay = Duration(-time.Second) }, "server.drainDelay"},
+		{"file backend without path", func(c *Config) { c.Storage.Path = "" }, "storage.path"},
+		{"negative retention", func(c *Config) { c.Storage.TrashRetentionDays = -1 }, "storage.trashRetentionDays"},
+		{"JWKS without issuer", func(c *Config) { c.Auth.JWKSURL = "https://idp.example.com/jwks" }, "auth.jwtIssuer"},
+		{"rate limit", func(c *Config) { c.Limits.RateLimitUpload = "lots" }, "limits.rateLimitUpload"},
+		{"trusted proxy", func(c *Config) { c.Limits.TrustedProxies = []string{"proxy"} }, "limits.trustedProxies"},
+		{"idempotency TTL", func(c *Config) { c.Limits.IdempotencyTTL = 0 }, "limits.idempotencyTtl"},
+		{"body limit", func(c *Config) { c.Limits.MaxBodyKB = 0 }, "limits.maxBodyKb"},
+		{"upload limit", func(c *Config) { c.Limits.MaxUploadMB = -1 }, "limits.maxUploadMb"},
+		{"wildcard with credentials", func(c *Config) { c.CORS.AllowCredentials = true }, "cors"},
+		{"CORS origin", func(c *Config) { c.CORS.AllowedOrigins = []string{"example.com"} }, "cors"},
+		{"grid", func(c *Config) { c.Privacy.LocationGridDegrees = 0 }, "privacy.locationGridDegrees"},
+		{"species visibility", func(c *Config) { c.Privacy.SensitiveSpecies = map[string]string{"Morel": "hidden"} }, "privacy.sensitiveSpecies"},
+		{"log level", func(c *Config) { c.Logging.Level = "loud" }, "logging.level"},
+		{"log format", func(c *Config) { c.Logging.Format = "xml" }, "logging.format"},
+		{"redact pattern", func(c *Config) { c.Logging.RedactPatterns = []string{"("} }, "logging.redactPatterns"},
+		{"sample rate", func(c *Config) { c.Logging.AccessLogSampleRate = 1.5 }, "logging.accessLogSampleRate"},
+		{"metrics without token", func(c *Config) { c.Metrics.Enabled = true }, "metrics.token"},
+		{"tracing exporter", func(c *Config) { c.Tracing.Exporter = "jaeger" }, "tracing.exporter"},
+		{"tracing file", func(c *Config) { c.Tracing.Exporter = TracingOTLPFile; c.Tracing.File = "" }, "tracing.file"},
+		{"debug port", func(c *Config) { c.Debug.Port = 70000 }, "debug.port must be between"},
+		{"debug port clash", func(c *Config) { c.Debug.Port = c.Port }, "debug.port must differ"},
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("Expected defaults to be valid, got %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	c := Default()
+	c.Port = 0
+	c.Logging.Level = "loud"
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "port") || !strings.Contains(err.Error(), "logging.level") {
+		t.Errorf("Expected both errors, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Auth.AdminAPIKey = "shr_secret"
+	c.Metrics.Token = "scrape-secret"
+
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "shr_secret") || strings.Contains(string(data), "scrape-secret") {
+		t.Errorf("Expected secrets to be redacted, got %s", data)
+	}
+	if !strings.Contains(string(data), `"adminApiKey":"[redacted]"`) {
+		t.Errorf("Expected redaction marker, got %s", data)
+	}
+	if c.Auth.AdminAPIKey != "shr_secret" {
+		t.Error("Expected the original configuration to be left untouched")
+	}
+}
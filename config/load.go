@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"service/privacy"
+)
+
+// setting is a configuration value that can be set from the environment and
+// the command line
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   setter
+}
+
+// setter parses a value into a Config field
+type setter struct {
+	apply func(c *Config, v string) error
+	// boolean settings may be given as flags without a value
+	boolean bool
+	// repeatable settings may be given as flags several times; the values are
+	// joined with newlines
+	repeatable bool
+}
+
+var settings = []setting{
+	{"port", "PORT", "port to listen on", setInt(func(c *Config) *int { return &c.Port })},
+	{"read-timeout", "READ_TIMEOUT", "maximum time to read a request, 0 for none", setDuration(func(c *Config) *Duration { return &c.Server.ReadTimeout })},
+	{"write-timeout", "WRITE_TIMEOUT", "maximum time to write a response, 0 for none", setDuration(func(c *Config) *Duration { return &c.Server.WriteTimeout })},
+	{"idle-timeout", "IDLE_TIMEOUT", "how long idle keep-alive connections are kept open, 0 for none", setDuration(func(c *Config) *Duration { return &c.Server.IdleTimeout })},
+	{"drain-delay", "DRAIN_DELAY", "how long to keep serving after readiness fails at shutdown", setDuration(func(c *Config) *Duration { return &c.Server.DrainDelay })},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "how long in-flight requests may take to finish at shutdown", setDuration(func(c *Config) *Duration { return &c.Server.ShutdownTimeout })},
+	{"allow-unknown-fields", "ALLOW_UNKNOWN_FIELDS", "accept request bodies with fields the API does not define", setBool(func(c *Config) *bool { return &c.Server.AllowUnknownFields })},
+
+	{"storage-backend", "STORAGE_BACKEND", "storage backend, file or memory", setString(func(c *Config) *string { return &c.Storage.Backend })},
+	{"data-file", "DATA_FILE", "path of the data file", setString(func(c *Config) *string { return &c.Storage.Path })},
+	{"trash-retention-days", "TRASH_RETENTION_DAYS", "days deleted sightings are kept, 0 for ever", setInt(func(c *Config) *int { return &c.Storage.TrashRetentionDays })},
+	{"min-free-disk-mb", "MIN_FREE_DISK_MB", "free disk space in MB below which the service is not ready, 0 to disable", setInt(func(c *Config) *int { return &c.Storage.MinFreeDiskMB })},
+
+	{"auth-required", "AUTH_REQUIRED", "reject anonymous requests", setBool(func(c *Config) *bool { return &c.Auth.Required })},
+	{"edit-unowned", "EDIT_UNOWNED", "let everyone change sightings created anonymously", setBool(func(c *Config) *bool { return &c.Auth.EditUnowned })},
+	{"admin-api-key", "ADMIN_API_KEY", "bootstrap admin API key", setString(func(c *Config) *string { return &c.Auth.AdminAPIKey })},
+	{"jwks-url", "JWKS_URL", "URL of the identity provider key set", setString(func(c *Config) *string { return &c.Auth.JWKSURL })},
+	{"jwks-file", "JWKS_FILE", "path of the identity provider key set", setString(func(c *Config) *string { return &c.Auth.JWKSFile })},
+	{"jwt-issuer", "JWT_ISSUER", "required token issuer", setString(func(c *Config) *string { return &c.Auth.JWTIssuer })},
+	{"jwt-audience", "JWT_AUDIENCE", "required token audience", setString(func(c *Config) *string { return &c.Auth.JWTAudience })},
+	{"jwt-role-claim", "JWT_ROLE_CLAIM", "token claim holding roles", setString(func(c *Config) *string { return &c.Auth.JWTRoleClaim })},
+	{"jwt-scope-claim", "JWT_SCOPE_CLAIM", "token claim holding scopes", setString(func(c *Config) *string { return &c.Auth.JWTScopeClaim })},
+
+	{"rate-limit-read", "RATE_LIMIT_READ", "read limit per client, requests/duration[,burst] or off", setString(func(c *Config) *string { return &c.Limits.RateLimitRead })},
+	{"rate-limit-write", "RATE_LIMIT_WRITE", "write limit per client", setString(func(c *Config) *string { return &c.Limits.RateLimitWrite })},
+	{"rate-limit-upload", "RATE_LIMIT_UPLOAD", "upload limit per client", setString(func(c *Config) *string { return &c.Limits.RateLimitUpload })},
+	{"rate-limit-auth", "RATE_LIMIT_AUTH", "failed authentication limit per client IP", setString(func(c *Config) *string { return &c.Limits.RateLimitAuth })},
+	{"trusted-proxies", "TRUSTED_PROXIES", "comma separated proxies whose X-Forwarded-For is honoured", setList(func(c *Config) *[]string { return &c.Limits.TrustedProxies })},
+	{"idempotency-ttl", "IDEMPOTENCY_TTL", "how long idempotency keys are remembered", setDuration(func(c *Config) *Duration { return &c.Limits.IdempotencyTTL })},
+	{"max-body-kb", "MAX_BODY_KB", "largest request body in KB without sightings", setInt(func(c *Config) *int { return &c.Limits.MaxBodyKB })},
+	{"max-upload-mb", "MAX_UPLOAD_MB", "largest request body in MB with sightings and their images", setInt(func(c *Config) *int { return &c.Limits.MaxUploadMB })},
+
+	{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma separated origins allowed to make cross-origin requests", setList(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+	{"cors-allow-credentials", "CORS_ALLOW_CREDENTIALS", "allow credentialed cross-origin requests", setBool(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+	{"cors-max-age", "CORS_MAX_AGE", "how long browsers may cache preflight responses", setDuration(func(c *Config) *Duration { return &c.CORS.MaxAge })},
+
+	{"location-grid-degrees", "LOCATION_GRID_DEGREES", "grid size obscured coordinates are snapped to", setFloat(func(c *Config) *float64 { return &c.Privacy.LocationGridDegrees })},
+	{"sensitive-species", "SENSITIVE_SPECIES", "sensitive species such as Morel,Matsutake:private", setter{apply: setSensitiveSpecies}},
+
+	{"log-level", "LOG_LEVEL", "least severe log level written", setString(func(c *Config) *string { return &c.Logging.Level })},
+	{"log-format", "LOG_FORMAT", "log format, json or text", setString(func(c *Config) *string { return &c.Logging.Format })},
+	{"log-file", "LOG_FILE", "file JSON log entries are also appended to", setString(func(c *Config) *string { return &c.Logging.File })},
+	{"log-redact-keys", "LOG_REDACT_KEYS", "comma-separated metadata keys masked in logs, besides the defaults", setList(func(c *Config) *[]string { return &c.Logging.RedactKeys })},
+	{"log-redact-patterns", "LOG_REDACT_PATTERNS", "regular expression masked in logs, besides the defaults; repeat the flag or put one per line in the env", setLines(func(c *Config) *[]string { return &c.Logging.RedactPatterns })},
+	{"log-location-decimals", "LOG_LOCATION_DECIMALS", "decimal places coordinates are rounded to in logs", setInt(func(c *Config) *int { return &c.Logging.LocationDecimals })},
+	{"access-log", "ACCESS_LOG", "log every request", setBool(func(c *Config) *bool { return &c.Logging.AccessLog })},
+	{"access-log-sample-rate", "ACCESS_LOG_SAMPLE_RATE", "fraction of fast, successful requests logged", setFloat(func(c *Config) *float64 { return &c.Logging.AccessLogSampleRate })},
+	{"slow-request-threshold", "SLOW_REQUEST_THRESHOLD", "latency from which requests are flagged as slow, 0 to disable", setDuration(func(c *Config) *Duration { return &c.Logging.SlowRequestThreshold })},
+
+	{"metrics-enabled", "METRICS_ENABLED", "serve Prometheus metrics on /metrics", setBool(func(c *Config) *bool { return &c.Metrics.Enabled })},
+	{"metrics-token", "METRICS_TOKEN", "bearer token required to read /metrics", setString(func(c *Config) *string { return &c.Metrics.Token })},
+	{"tracing-exporter", "TRACING_EXPORTER", "where spans are exported: none, stdout or otlp-file", setString(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"tracing-file", "TRACING_FILE", "file the otlp-file exporter appends spans to", setString(func(c *Config) *string { return &c.Tracing.File })},
+
+	{"debug-port", "DEBUG_PORT", "port serving profiling and debug endpoints to admins, 0 to disable", setInt(func(c *Config) *int { return &c.Debug.Port })},
+}
+
+// Load builds the configuration from, in increasing order of precedence, the
+// defaults, the JSON file named by -config or CONFIG_FILE, environment
+// variables and the command line flags in args. Only JSON files are
+// supported. The result is validated.
+func Load(args []string) (*Config, error) {
+	return load(args, os.LookupEnv, os.Stderr)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Config, error) {
+	fs := flag.NewFlagSet("shroomp", flag.ContinueOnError)
+	fs.SetOutput(output)
+	file := fs.String("config", "", "path of a JSON configuration file; YAML is not supported (env CONFIG_FILE)")
+
+	// Flags are applied after the file and the environment, in the order given
+	var flagged []func(c *Config) error
+	repeated := make(map[string]*[]string)
+	for _, s := range settings {
+		s := s
+		define := fs.Func
+		if s.set.boolean {
+			define = fs.BoolFunc
+		}
+		define(s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env), func(v string) error {
+			values := []string{v}
+			if s.set.repeatable {
+				if earlier, ok := repeated[s.flag]; ok {
+					*earlier = append(*earlier, v)
+					return nil
+				}
+				repeated[s.flag] = &values
+			}
+			flagged = append(flagged, func(c *Config) error {
+				if err := s.set.apply(c, strings.Join(values, "\n")); err != nil {
+					return fmt.Errorf("invalid -%s: %w", s.flag, err)
+				}
+				return nil
+			})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	c := Default()
+
+	path := *file
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok && v != "" {
+			if err := s.set.apply(c, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, set := range flagged {
+		if err := set(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile overlays the settings in the JSON file at path on c. Unknown keys
+// are rejected so that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return fmt.Errorf("config file %s: YAML is not supported, use JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func setString(field func(*Config) *string) setter {
+	return setter{apply: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func setInt(field func(*Config) *int) setter {
+	return setter{apply: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func setFloat(field func(*Config) *float64) setter {
+	return setter{apply: func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+func setBool(field func(*Config) *bool) setter {
+	return setter{boolean: true, apply: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", v)
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func setDuration(field func(*Config) *Duration) setter {
+	return setter{apply: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}}
+}
+
+// setList splits a comma separated value
+func setList(field func(*Config) *[]string) setter {
+	return setter{apply: func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+// setLines splits a value with one item per line, for lists such as regular
+// expressions whose items may contain commas
+func setLines(field func(*Config) *[]string) setter {
+	return setter{repeatable: true, apply: func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, "\n") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func setSensitiveSpecies(c *Config, v string) error {
+	species, err := privacy.ParseSensitiveSpecies(v)
+	if err != nil {
+		return err
+	}
+	c.Privacy.SensitiveSpecies = species
+	return nil
+}
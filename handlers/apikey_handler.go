@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"service/auth"
+	"service/logger"
+	"service/models"
+	"service/problem"
+	"service/storage"
+	"service/validation"
+
+	"github.com/google/uuid"
+)
+
+// CreateAPIKeyRequest is the body accepted by POST /admin/keys
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	UserID string   `json:"userId"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreateAPIKeyResponse is returned once, when a key is created; the key
+// itself cannot be retrieved again
+type CreateAPIKeyResponse struct {
+	Key    string        `json:"key"`
+	APIKey models.APIKey `json:"apiKey"`
+}
+
+type APIKeyHandler struct {
+	store   *storage.Store
+	decoder Decoder
+}
+
+func NewAPIKeyHandler(store *storage.Store, decoder Decoder) *APIKeyHandler {
+	return &APIKeyHandler{store: store, decoder: decoder}
+}
+
+// HandleKeys handles POST (create) and GET (list all) requests for API keys;
+// both are admin only
+func (h *APIKeyHandler) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.createKey(w, r)
+	case http.MethodGet:
+		keys := h.store.GetAPIKeys()
+		for i := range keys {
+			keys[i].Hash = ""
+		}
+		writeJSON(w, r, http.StatusOK, keys)
+	default:
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandleKeyByID handles DELETE requests that revoke an API key (admin only)
+func (h *APIKeyHandler) HandleKeyByID(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/admin/keys/")
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "Key ID required")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		problem.MethodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+
+	if _, err := h.store.RevokeAPIKey(id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Error(w, r, http.StatusNotFound, "Key not found")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error revoking API key", map[string]interface{}{
+			"error":  err.Error(),
+			"key_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createKey issues a new API key for an existing user
+func (h *APIKeyHandler) createKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+
+	if err := h.decoder.decodeJSON(w, r, &req); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	v := validation.New()
+	v.Required("name", req.Name != "")
+	v.Check(len(req.Scopes) > 0, "scopes", problem.CodeRequired, "scopes are required")
+	for i, scope := range req.Scopes {
+		v.At("scopes").Check(auth.ValidScope(scope), strconv.Itoa(i), problem.CodeFormat, "scopes must be read, write or admin")
+	}
+	if !v.Valid() {
+		invalid(w, r, v.Err())
+		return
+	}
+
+	user, err := h.store.GetUser(req.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			v.Check(false, "userId", problem.CodeFormat, "User not found")
+			invalid(w, r, v.Err())
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error getting user", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": req.UserID,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	for i, scope := range req.Scopes {
+		v.At("scopes").Check(scope != models.ScopeAdmin || user.Role == models.RoleAdmin, strconv.Itoa(i), problem.CodeFormat, "admin scope requires an admin user")
+	}
+	if !v.Valid() {
+		invalid(w, r, v.Err())
+		return
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error generating API key", map[string]interface{}{
+			"error": err.Error(),
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	created, err := h.store.CreateAPIKey(models.APIKey{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		UserID:    user.ID,
+		Scopes:    req.Scopes,
+		Prefix:    prefix,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error creating API key", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	created.Hash = ""
+	writeJSON(w, r, http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: created})
+}
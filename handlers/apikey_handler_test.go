@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"service/auth"
+	"service/models"
+	"service/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestAPIKeyHandler(t *testing.T) (*APIKeyHandler, *storage.Store, func()) {
+	os.Remove("data.json")
+
+	store := storage.NewStore()
+	for _, u := range []models.User{
+		{ID: "user-1", Name: "Alice", Email: "alice@example.com", Role: models.RoleUser, CreatedAt: time.Now()},
+		{ID: "admin-1", Name: "Bob", Email: "bob@example.com", Role: models.RoleAdmin, CreatedAt: time.Now()},
+	} {
+		if _, err := store.CreateUser(u); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	handler := NewAPIKeyHandler(store, Decoder{})
+
+	cleanup := func() {
+		os.Remove("data.json")
+	}
+
+	return handler, store, cleanup
+}
+
+func TestHandleKeys_CreateListRevoke(t *testing.T) {
+	handler, store, cleanup := createTestAPIKeyHandler(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(CreateAPIKeyRequest{Name: "phone", UserID: "user-1", Scopes: []string{models.ScopeRead, models.ScopeWrite}})
+	req := asUser(httptest.NewRequest(http.MethodPost, "/admin/keys", bytes.NewBuffer(body)), "admin-1", models.RoleAdmin)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.HandleKeys(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created CreateAPIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !auth.IsAPIKey(created.Key) || created.APIKey.Hash != "" {
+		t.Errorf("Expected plaintext key and no hash, got %+v", created)
+	}
+
+	// The issued key authenticates as its user
+	p, err := auth.NewAuthenticator(store).Authenticate(t.Context(), created.Key)
+	if err != nil || p.UserID != "user-1" {
+		t.Fatalf("Authenticate returned %+v, %v", p, err)
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodGet, "/admin/keys", nil), "admin-1", models.RoleAdmin)
+	w = httptest.NewRecorder()
+	handler.HandleKeys(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "hash") {
+		t.Error("Expected key hashes to be omitted from the listing")
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodDelete, "/admin/keys/"+created.APIKey.ID, nil), "admin-1", models.RoleAdmin)
+	w = httptest.NewRecorder()
+	handler.HandleKeyByID(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if _, err := auth.NewAuthenticator(store).Authenticate(t.Context(), created.Key); err != auth.ErrRevokedKey {
+		t.Errorf("Expected ErrRevokedKey after revocation, got %v", err)
+	}
+}
+
+func TestHandleKeys_Validation(t *testing.T) {
+	handler, _, cleanup := createTestAPIKeyHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		req  CreateAPIKeyRequest
+	}{
+		{"missing name", CreateAPIKeyRequest{UserID: "user-1", Scopes: []string{models.ScopeRead}}},
+		{"missing scopes", CreateAPIKeyRequest{Name: "k", UserID: "user-1"}},
+		{"unknown scope", CreateAPIKeyRequest{Name: "k", UserID: "user-1", Scopes: []string{"delete"}}},
+		{"unknown user", CreateAPIKeyRequest{Name: "k", UserID: "missing", Scopes: []string{models.ScopeRead}}},
+		{"admin scope for user", CreateAPIKeyRequest{Name: "k", UserID: "user-1", Scopes: []string{models.ScopeAdmin}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.req)
+			req := asUser(httptest.NewRequest(http.MethodPost, "/admin/keys", bytes.NewBuffer(body)), "admin-1", models.RoleAdmin)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.HandleKeys(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleKeys_RequiresAdmin(t *testing.T) {
+	handler, _, cleanup := createTestAPIKeyHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	w := httptest.NewRecorder()
+	handler.HandleKeys(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for anonymous, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodGet, "/admin/keys", nil), "user-1", models.RoleUser)
+	w = httptest.NewRecorder()
+	handler.HandleKeys(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for non-admin, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodDelete, "/admin/keys/missing", nil), "admin-1", models.RoleAdmin)
+	w = httptest.NewRecorder()
+	handler.HandleKeyByID(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"service/logger"
+	"service/models"
+	"service/problem"
+	"service/storage"
+	"service/validation"
+
+	"github.com/google/uuid"
+)
+
+// MaxBatchOperations caps the number of operations accepted in one batch
+const MaxBatchOperations = 500
+
+// BatchRequest is the body accepted by POST /items:batch
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is a single create, update or delete within a batch
+type BatchOperation struct {
+	Op   storage.OpType `json:"op"`
+	ID   string         `json:"id,omitempty"`
+	Item *models.Item   `json:"item,omitempty"`
+}
+
+// BatchResult reports the outcome of one operation, in request order
+type BatchResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	ID     string       `json:"id,omitempty"`
+	Status int          `json:"status"`
+	Item   *models.Item `json:"item,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	// Errors lists the fields that made the operation invalid
+	Errors []problem.FieldError `json:"errors,omitempty"`
+}
+
+// BatchResponse is returned by POST /items:batch
+type BatchResponse struct {
+	Atomic  bool          `json:"atomic"`
+	Applied bool          `json:"applied"`
+	Results []BatchResult `json:"results"`
+}
+
+// HandleBatch handles POST /items:batch, applying several create, update and
+// delete operations with a single persistence write
+func (h *ItemHandler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var req BatchRequest
+	if err := h.decoder.decodeUpload(w, r, &req); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	v := validation.New()
+	if !v.Check(len(req.Operations) > 0, "operations", problem.CodeRequired, "operations must not be empty") {
+		invalid(w, r, v.Err())
+		return
+	}
+	if len(req.Operations) > MaxBatchOperations {
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, "too many operations")
+		return
+	}
+
+	resp := BatchResponse{
+		Atomic:  req.Atomic,
+		Results: make([]BatchResult, len(req.Operations)),
+	}
+
+	// Validate every operation up front so that invalid input never reaches
+	// the store, which checks ownership as it applies them; index maps each
+	// store op to its position in req.Operations
+	now := time.Now()
+	actor := requestActor(r)
+	guard := h.changeGuard(r)
+	var ops []storage.Op
+	var index []int
+	rejected := false
+	for i, bo := range req.Operations {
+		res := &resp.Results[i]
+		res.Index = i
+		res.Op = string(bo.Op)
+
+		op, err := prepareBatchOp(validation.New().Index("operations", i), bo, now)
+		res.ID = op.ID
+		if err != nil {
+			res.Status = http.StatusBadRequest
+			res.Error = err.Error()
+			res.Errors = problem.FieldErrors(err)
+			rejected = true
+			continue
+		}
+		op.Actor = actor
+		op.Guard = guard
+		op.Item.Owner = requestOwner(r)
+		ops = append(ops, op)
+		index = append(index, i)
+	}
+
+	if rejected && req.Atomic {
+		status := 0
+		for i := range resp.Results {
+			if resp.Results[i].Status == 0 {
+				resp.Results[i].Status = http.StatusFailedDependency
+				resp.Results[i].Error = storage.ErrBatchAborted.Error()
+			} else if status == 0 {
+				status = resp.Results[i].Status
+			}
+		}
+		writeJSON(w, r, status, resp)
+		return
+	}
+
+	results, err := h.store.Batch(r.Context(), ops, req.Atomic)
+	if err != nil && !errors.Is(err, storage.ErrBatchAborted) {
+		logger.ErrorContext(r.Context(), "Error applying batch", map[string]interface{}{
+			"error":           err.Error(),
+			"operation_count": len(ops),
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	aborted := errors.Is(err, storage.ErrBatchAborted)
+
+	status := http.StatusOK
+	for j, result := range results {
+		res := &resp.Results[index[j]]
+		switch {
+		case result.Err == nil && aborted:
+			// Applied before the failure, then rolled back
+			res.Status = http.StatusFailedDependency
+			res.Error = storage.ErrBatchAborted.Error()
+		case result.Err == nil:
+			res.Status = batchSuccessStatus(ops[j].Type)
+			if ops[j].Type != storage.OpDelete {
+				item := h.present(r, result.Item)
+				res.Item = &item
+			}
+		case errors.Is(result.Err, storage.ErrBatchAborted):
+			res.Status = http.StatusFailedDependency
+			res.Error = result.Err.Error()
+		default:
+			res.Status = batchErrorStatus(result.Err)
+			res.Error = result.Err.Error()
+			if aborted {
+				status = res.Status
+			}
+		}
+	}
+	resp.Applied = !aborted
+
+	writeJSON(w, r, status, resp)
+}
+
+// prepareBatchOp validates a batch operation and converts it to a store
+// operation, generating IDs and timestamps the same way createItem and
+// updateItem do. Violations are recorded in v, which is located at the
+// operation within the request.
+func prepareBatchOp(v *validation.Validator, bo BatchOperation, now time.Time) (storage.Op, error) {
+	op := storage.Op{Type: bo.Op, ID: bo.ID}
+
+	switch bo.Op {
+	case storage.OpCreate:
+		if !v.Required("item", bo.Item != nil) {
+			return op, v.Err()
+		}
+		item := *bo.Item
+		if checkSighting(v.At("item"), &item, now); !v.Valid() {
+			return op, v.Err()
+		}
+		if item.ID == "" {
+			item.ID = bo.ID
+		}
+		if item.ID == "" {
+			item.ID = uuid.New().String()
+		}
+		item.CreatedAt = now
+		item.UpdatedAt = now
+		op.ID = item.ID
+		op.Item = item
+	case storage.OpUpdate:
+		v.Required("id", bo.ID != "")
+		if !v.Required("item", bo.Item != nil) {
+			return op, v.Err()
+		}
+		item := *bo.Item
+		if checkSighting(v.At("item"), &item, now); !v.Valid() {
+			return op, v.Err()
+		}
+		item.ID = bo.ID
+		item.UpdatedAt = now
+		op.Item = item
+	case storage.OpDelete:
+		if !v.Required("id", bo.ID != "") {
+			return op, v.Err()
+		}
+	default:
+		v.OneOf("op", string(bo.Op), string(storage.OpCreate), string(storage.OpUpdate), string(storage.OpDelete))
+		return op, v.Err()
+	}
+
+	return op, nil
+}
+
+// batchSuccessStatus returns the status code the equivalent single-item
+// endpoint would have returned
+func batchSuccessStatus(op storage.OpType) int {
+	switch op {
+	case storage.OpCreate:
+		return http.StatusCreated
+	case storage.OpDelete:
+		return http.StatusNoContent
+	default:
+		return http.StatusOK
+	}
+}
+
+// batchErrorStatus maps a store error to a per-operation status code
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, storage.ErrInvalidOp):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
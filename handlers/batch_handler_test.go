@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"service/storage"
+	"testing"
+	"time"
+)
+
+func TestHandleBatch_NonAtomic(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	existing := models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now}
+	if _, err := handler.store.Create(t.Context(), existing); err != nil {
+		t.Fatalf("Failed to create test item: %v", err)
+	}
+
+	batch := BatchRequest{
+		Operations: []BatchOperation{
+			{Op: storage.OpCreate, Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 2, DateTime: now}},
+			{Op: storage.OpUpdate, ID: "test-1", Item: &models.Item{MushroomName: "Updated", Location: "Forest", Count: 7, DateTime: now}},
+			{Op: storage.OpDelete, ID: "non-existent"},
+			{Op: storage.OpCreate, Item: &models.Item{Location: "Woods", Count: 2, DateTime: now}},
+		},
+	}
+
+	body, _ := json.Marshal(batch)
+	req := httptest.NewRequest(http.MethodPost, "/items:batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleBatch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusBadRequest}
+	if len(resp.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(resp.Results))
+	}
+	for i, status := range expected {
+		if resp.Results[i].Status != status {
+			t.Errorf("Result %d: expected status %d, got %d", i, status, resp.Results[i].Status)
+		}
+	}
+	if !resp.Applied {
+		t.Error("Expected non-atomic batch to be applied")
+	}
+
+	if resp.Results[0].Item == nil || resp.Results[0].Item.ID == "" {
+		t.Error("Expected created item with generated ID")
+	}
+	updated, _ := handler.store.Get(t.Context(), "test-1")
+	if updated.MushroomName != "Updated" {
+		t.Errorf("Expected MushroomName Updated, got %s", updated.MushroomName)
+	}
+}
+
+func TestHandleBatch_AtomicAbort(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	batch := BatchRequest{
+		Atomic: true,
+		Operations: []BatchOperation{
+			{Op: storage.OpCreate, ID: "new-1", Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 2, DateTime: now}},
+			{Op: storage.OpDelete, ID: "non-existent"},
+		},
+	}
+
+	body, _ := json.Marshal(batch)
+	req := httptest.NewRequest(http.MethodPost, "/items:batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleBatch(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var resp BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Applied {
+		t.Error("Expected atomic batch not to be applied")
+	}
+	if resp.Results[0].Status != http.StatusFailedDependency {
+		t.Errorf("Expected rolled back op status %d, got %d", http.StatusFailedDependency, resp.Results[0].Status)
+	}
+	if _, err := handler.store.Get(t.Context(), "new-1"); err != storage.ErrNotFound {
+		t.Errorf("Expected created item to be rolled back, got %v", err)
+	}
+}
+
+func TestHandleBatch_AtomicValidationError(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	batch := BatchRequest{
+		Atomic: true,
+		Operations: []BatchOperation{
+			{Op: storage.OpCreate, ID: "new-1", Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 2, DateTime: now}},
+			{Op: "rename", ID: "new-1"},
+		},
+	}
+
+	body, _ := json.Marshal(batch)
+	req := httptest.NewRequest(http.MethodPost, "/items:batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleBatch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if len(handler.store.GetAll(t.Context())) != 0 {
+		t.Error("Expected no items to be created")
+	}
+}
+
+func TestHandleBatch_FieldErrors(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	batch := BatchRequest{
+		Operations: []BatchOperation{
+			{Op: storage.OpCreate, Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 2, DateTime: now}},
+			{Op: storage.OpCreate, Item: &models.Item{Location: "Woods", Count: 0, DateTime: now}},
+			{Op: storage.OpUpdate},
+		},
+	}
+
+	body, _ := json.Marshal(batch)
+	req := httptest.NewRequest(http.MethodPost, "/items:batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleBatch(w, req)
+
+	var resp BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Results[0].Errors) != 0 {
+		t.Errorf("Expected no errors for a valid operation, got %+v", resp.Results[0].Errors)
+	}
+	tests := []struct {
+		result int
+		fields []string
+	}{
+		{1, []string{"/operations/1/item/mushroomName", "/operations/1/item/count"}},
+		{2, []string{"/operations/2/id", "/operations/2/item"}},
+	}
+	for _, tt := range tests {
+		errs := resp.Results[tt.result].Errors
+		if len(errs) != len(tt.fields) {
+			t.Errorf("Result %d: expected errors on %v, got %+v", tt.result, tt.fields, errs)
+			continue
+		}
+		for i, field := range tt.fields {
+			if errs[i].Field != field {
+				t.Errorf("Result %d: expected error on %s, got %+v", tt.result, field, errs[i])
+			}
+		}
+	}
+}
+
+func TestHandleBatch_Invalid(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		expected int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid json", http.MethodPost, "invalid json", http.StatusBadRequest},
+		{"empty operations", http.MethodPost, `{"operations":[]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/items:batch", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.HandleBatch(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime/pprof"
+
+	"service/problem"
+	"service/storage"
+)
+
+type DebugHandler struct {
+	store *storage.Store
+}
+
+// NewDebugHandler serves runtime and storage diagnostics. The endpoints reveal
+// internals and must only be served to admins.
+func NewDebugHandler(store *storage.Store) *DebugHandler {
+	return &DebugHandler{store: store}
+}
+
+// HandleGoroutines serves GET /debug/goroutines, the stack of every goroutine
+// as in a crash dump
+func (h *DebugHandler) HandleGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// HandleStorageLocks serves GET /debug/storage/locks, the contention on the
+// store lock since startup
+func (h *DebugHandler) HandleStorageLocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, h.store.LockStats())
+}
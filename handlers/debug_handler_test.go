@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"service/storage"
+)
+
+func TestDebugHandler_Goroutines(t *testing.T) {
+	h := NewDebugHandler(storage.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	h.HandleGoroutines(w, httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine ") {
+		t.Errorf("Expected a goroutine dump, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleGoroutines(w, httptest.NewRequest(http.MethodPost, "/debug/goroutines", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestDebugHandler_StorageLocks(t *testing.T) {
+	store := storage.NewMemoryStore()
+	store.GetAll(t.Context())
+	h := NewDebugHandler(store)
+
+	w := httptest.NewRecorder()
+	h.HandleStorageLocks(w, httptest.NewRequest(http.MethodGet, "/debug/storage/locks", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var stats storage.LockStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.Read.Acquisitions == 0 {
+		t.Errorf("Expected the read to be counted, got %+v", stats)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"service/problem"
+	"service/tracing"
+)
+
+// Default request body limits, in bytes
+const (
+	// DefaultMaxBodyBytes limits bodies without sightings, such as users
+	DefaultMaxBodyBytes = 64 << 10
+	// DefaultMaxUploadBytes limits bodies with sightings, whose images are
+	// inline
+	DefaultMaxUploadBytes = 10 << 20
+)
+
+var (
+	errUnsupportedMediaType = errors.New("Content-Type must be application/json")
+	errEmptyBody            = errors.New("request body is empty")
+	errTrailingData         = errors.New("request body must contain a single JSON value")
+)
+
+// Decoder reads JSON request bodies. It rejects bodies that are not
+// application/json, exceed the route's limit, hold more than one value or,
+// unless AllowUnknownFields, have fields the target does not. The zero value
+// uses the default limits.
+type Decoder struct {
+	MaxBodyBytes       int64
+	MaxUploadBytes     int64
+	AllowUnknownFields bool
+}
+
+// decodeJSON decodes a body without sightings into v
+func (d Decoder) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return d.decode(w, r, v, d.maxBody())
+}
+
+// decodeUpload decodes a body with sightings into v
+func (d Decoder) decodeUpload(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return d.decode(w, r, v, d.maxUpload())
+}
+
+func (d Decoder) maxBody() int64 {
+	if d.MaxBodyBytes > 0 {
+		return d.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+func (d Decoder) maxUpload() int64 {
+	if d.MaxUploadBytes > 0 {
+		return d.MaxUploadBytes
+	}
+	return DefaultMaxUploadBytes
+}
+
+// decode decodes the body of r, of at most limit bytes, into v in a span of
+// its own, so that traces show how long large payloads take to parse
+func (d Decoder) decode(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) error {
+	_, span := tracing.Start(r.Context(), "decode")
+	defer span.End()
+	if r.ContentLength >= 0 {
+		span.SetAttribute("http.request.body.size", r.ContentLength)
+	}
+
+	err := d.read(w, r, v, limit)
+	span.SetError(err)
+	return err
+}
+
+func (d Decoder) read(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) error {
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return errUnsupportedMediaType
+	}
+	if r.ContentLength > limit {
+		return &http.MaxBytesError{Limit: limit}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	if !d.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errEmptyBody
+		}
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// isJSON reports whether contentType is application/json or a +json type
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// invalidBody replies to a request whose body could not be decoded: 413 for
+// bodies over the limit, 415 for other media types and 400 otherwise
+func invalidBody(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		tooLarge  *http.MaxBytesError
+		syntax    *json.SyntaxError
+		wrongType *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, "Request body must not exceed "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+	case errors.Is(err, errUnsupportedMediaType):
+		w.Header().Set("Accept-Post", "application/json")
+		problem.Error(w, r, http.StatusUnsupportedMediaType, err.Error())
+	case errors.As(err, &syntax):
+		writeInvalidBody(w, r, fmt.Sprintf("request body is not valid JSON at byte %d: %v", syntax.Offset, err))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		writeInvalidBody(w, r, "request body ends before the JSON value is complete")
+	case errors.As(err, &wrongType) && wrongType.Field != "":
+		writeInvalidBody(w, r, wrongType.Field+" must be "+jsonKind(wrongType.Type))
+	default:
+		writeInvalidBody(w, r, strings.TrimPrefix(err.Error(), "json: "))
+	}
+}
+
+func writeInvalidBody(w http.ResponseWriter, r *http.Request, detail string) {
+	problem.Write(w, r, problem.Typed(problem.TypeInvalidBody, http.StatusBadRequest, "Invalid request body", detail))
+}
+
+// jsonKind names the JSON value that decodes into t
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Pointer:
+		return jsonKind(t.Elem())
+	default:
+		return "an object"
+	}
+}
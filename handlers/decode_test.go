@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"service/problem"
+)
+
+func TestDecoder(t *testing.T) {
+	type target struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	tests := []struct {
+		name        string
+		decoder     Decoder
+		contentType string
+		body        string
+		unsized     bool
+		status      int
+		detail      string
+	}{
+		{"valid", Decoder{}, "application/json", `{"name":"a","count":1}`, false, http.StatusOK, ""},
+		{"charset and whitespace", Decoder{}, "application/json; charset=utf-8", " {\"name\":\"a\"}\n ", false, http.StatusOK, ""},
+		{"json suffix", Decoder{}, "application/merge-patch+json", `{"name":"a"}`, false, http.StatusOK, ""},
+		{"missing content type", Decoder{}, "", `{"name":"a"}`, false, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"form content type", Decoder{}, "application/x-www-form-urlencoded", `name=a`, false, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"unknown field", Decoder{}, "application/json", `{"name":"a","colour":"red"}`, false, http.StatusBadRequest, `unknown field "colour"`},
+		{"unknown field allowed", Decoder{AllowUnknownFields: true}, "application/json", `{"name":"a","colour":"red"}`, false, http.StatusOK, ""},
+		{"trailing value", Decoder{}, "application/json", `{"name":"a"}{"name":"b"}`, false, http.StatusBadRequest, "request body must contain a single JSON value"},
+		{"trailing garbage", Decoder{}, "application/json", `{"name":"a"} garbage`, false, http.StatusBadRequest, "request body must contain a single JSON value"},
+		{"empty", Decoder{}, "application/json", "", false, http.StatusBadRequest, "request body is empty"},
+		{"truncated", Decoder{}, "application/json", `{"name":`, false, http.StatusBadRequest, "request body ends before the JSON value is complete"},
+		{"syntax error", Decoder{}, "application/json", `{"name" "a"}`, false, http.StatusBadRequest, "request body is not valid JSON at byte 9: invalid character '\"' after object key"},
+		{"wrong type", Decoder{}, "application/json", `{"count":"many"}`, false, http.StatusBadRequest, "count must be an integer"},
+		{"over limit", Decoder{MaxBodyBytes: 16}, "application/json", `{"name":"abcdefghijklmnop"}`, false, http.StatusRequestEntityTooLarge, "Request body must not exceed 16 bytes"},
+		{"over limit unsized", Decoder{MaxBodyBytes: 16}, "application/json", `{"name":"abcdefghijklmnop"}`, true, http.StatusRequestEntityTooLarge, "Request body must not exceed 16 bytes"},
+		{"trailing data over limit", Decoder{MaxBodyBytes: 16}, "application/json", `{"name":"a"}          `, true, http.StatusRequestEntityTooLarge, "Request body must not exceed 16 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.unsized {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/users", body)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			var v target
+			if err := tt.decoder.decodeJSON(w, req, &v); err != nil {
+				invalidBody(w, req, err)
+			}
+
+			if tt.status == http.StatusOK {
+				if w.Code != http.StatusOK || v.Name != "a" {
+					t.Errorf("Expected body to decode, got %d %s", w.Code, w.Body)
+				}
+				return
+			}
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if p := decodeProblem(t, w); p.Detail != tt.detail {
+				t.Errorf("Expected detail %q, got %q", tt.detail, p.Detail)
+			}
+		})
+	}
+}
+
+func TestDecoder_UploadLimit(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+	WithDecoder(Decoder{MaxBodyBytes: 16, MaxUploadBytes: 256})(handler)
+	item := `{"mushroomName":"Morel","location":"Woods","count":2,"dateTime":"` + time.Now().Format(time.RFC3339) + `"}`
+
+	tests := []struct {
+		name   string
+		body   string
+		key    string
+		status int
+	}{
+		{"within upload limit", item, "", http.StatusCreated},
+		{"image over upload limit", item[:len(item)-1] + `,"image":"` + strings.Repeat("A", 256) + `"}`, "", http.StatusRequestEntityTooLarge},
+		{"idempotent over upload limit", item[:len(item)-1] + `,"image":"` + strings.Repeat("A", 256) + `"}`, "key-1", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/items", io.MultiReader(bytes.NewBufferString(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			handler.HandleItems(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if tt.status != http.StatusCreated && w.Header().Get("Content-Type") != problem.ContentType {
+				t.Errorf("Expected a problem response, got %s", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	items := handler.store.GetAll(t.Context())
+	if len(items) != 1 {
+		t.Errorf("Expected only the item within the limit to be stored, got %d", len(items))
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"service/logger"
+	"service/problem"
+	"service/storage"
+)
+
+// DefaultMinFreeDisk is the free disk space, in bytes, below which the
+// service reports that it is not ready
+const DefaultMinFreeDisk = 100 << 20
+
+// readinessFailures are the messages /readyz reports for failed checks. The
+// probe is unauthenticated, so the underlying errors, which may name paths,
+// are only logged and shown by GET /status.
+var readinessFailures = map[string]string{
+	"storage": "storage unavailable",
+	"disk":    "low disk space",
+}
+
+// HealthResponse is returned by GET /healthz and GET /readyz
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// StatusResponse is returned by GET /status
+type StatusResponse struct {
+	Version       string        `json:"version"`
+	Commit        string        `json:"commit,omitempty"`
+	GoVersion     string        `json:"goVersion"`
+	StartedAt     time.Time     `json:"startedAt"`
+	Uptime        string        `json:"uptime"`
+	UptimeSeconds int64         `json:"uptimeSeconds"`
+	Ready         bool          `json:"ready"`
+	Storage       storage.Stats `json:"storage"`
+	// Checks holds the outcome of each readiness check, with the error of
+	// failed ones
+	Checks map[string]string `json:"checks"`
+}
+
+type HealthHandler struct {
+	store       *storage.Store
+	version     string
+	minFreeDisk uint64
+	started     time.Time
+	stopping    atomic.Bool
+}
+
+// HealthOption configures a HealthHandler
+type HealthOption func(*HealthHandler)
+
+// WithVersion sets the build version reported by GET /status
+func WithVersion(version string) HealthOption {
+	return func(h *HealthHandler) {
+		h.version = version
+	}
+}
+
+// WithMinFreeDisk sets the free disk space, in bytes, below which the
+// service is not ready; 0 disables the check
+func WithMinFreeDisk(bytes uint64) HealthOption {
+	return func(h *HealthHandler) {
+		h.minFreeDisk = bytes
+	}
+}
+
+func NewHealthHandler(store *storage.Store, opts ...HealthOption) *HealthHandler {
+	h := &HealthHandler{
+		store:       store,
+		version:     "dev",
+		minFreeDisk: DefaultMinFreeDisk,
+		started:     time.Now(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ShuttingDown makes readiness fail from now on, so that load balancers stop
+// sending requests while in-flight ones drain
+func (h *HealthHandler) ShuttingDown() {
+	h.stopping.Store(true)
+}
+
+// HandleHealthz reports that the process is up and serving requests
+func (h *HealthHandler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// HandleReadyz reports whether the service can take traffic: it is not
+// shutting down, storage is loaded and writable and the disk is not full.
+// Failures are answered with 503 Service Unavailable and a generic message per
+// failed check; the details are logged.
+func (h *HealthHandler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	checks, ready := h.checks()
+	status := http.StatusOK
+	resp := HealthResponse{Status: "ready", Checks: checks}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		resp.Status = "not ready"
+	}
+	for name, result := range checks {
+		msg, ok := readinessFailures[name]
+		if !ok || result == "ok" {
+			continue
+		}
+		logger.WarningContext(r.Context(), "Readiness check failed", map[string]interface{}{
+			"check": name,
+			"error": result,
+		})
+		checks[name] = msg
+	}
+	writeJSON(w, r, status, resp)
+}
+
+// HandleStatus reports the build, uptime and storage statistics; it is admin
+// only
+func (h *HealthHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	uptime := time.Since(h.started)
+	checks, ready := h.checks()
+	writeJSON(w, r, http.StatusOK, StatusResponse{
+		Version:       h.version,
+		Commit:        buildCommit(),
+		GoVersion:     runtime.Version(),
+		StartedAt:     h.started.UTC(),
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		Ready:         ready,
+		Storage:       h.store.Stats(),
+		Checks:        checks,
+	})
+}
+
+// checks runs the readiness checks and reports each outcome by name
+func (h *HealthHandler) checks() (map[string]string, bool) {
+	checks := make(map[string]string)
+	ready := true
+	fail := func(name, msg string) {
+		checks[name] = msg
+		ready = false
+	}
+
+	if h.stopping.Load() {
+		fail("shutdown", "shutting down")
+	}
+
+	if err := h.store.Check(); err != nil {
+		fail("storage", err.Error())
+	} else {
+		checks["storage"] = "ok"
+	}
+
+	if h.minFreeDisk > 0 {
+		free, err := h.store.FreeSpace()
+		switch {
+		case errors.Is(err, storage.ErrNotPersisted), errors.Is(err, errors.ErrUnsupported):
+		case err != nil:
+			fail("disk", err.Error())
+		case free < h.minFreeDisk:
+			fail("disk", fmt.Sprintf("%d bytes free, %d required", free, h.minFreeDisk))
+		default:
+			checks["disk"] = "ok"
+		}
+	}
+
+	return checks, ready
+}
+
+// buildCommit returns the VCS revision the binary was built from, if known
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
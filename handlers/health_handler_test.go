@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"service/models"
+	"service/storage"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	handler := NewHealthHandler(storage.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	handler.HandleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.HandleHealthz(w, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		handler  func() *HealthHandler
+		status   int
+		failures []string
+	}{
+		{
+			name:    "memory store",
+			handler: func() *HealthHandler { return NewHealthHandler(storage.NewMemoryStore()) },
+			status:  http.StatusOK,
+		},
+		{
+			name: "file store",
+			handler: func() *HealthHandler {
+				return NewHealthHandler(storage.NewFileStore(filepath.Join(dir, "data.json")), WithMinFreeDisk(1))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:     "data file not loaded",
+			handler:  func() *HealthHandler { return NewHealthHandler(storage.NewFileStore(corrupt)) },
+			status:   http.StatusServiceUnavailable,
+			failures: []string{"storage"},
+		},
+		{
+			name: "data directory missing",
+			handler: func() *HealthHandler {
+				return NewHealthHandler(storage.NewFileStore(filepath.Join(dir, "missing", "data.json")))
+			},
+			status:   http.StatusServiceUnavailable,
+			failures: []string{"storage", "disk"},
+		},
+		{
+			name: "disk full",
+			handler: func() *HealthHandler {
+				return NewHealthHandler(storage.NewFileStore(filepath.Join(dir, "data.json")), WithMinFreeDisk(1<<62))
+			},
+			status:   http.StatusServiceUnavailable,
+			failures: []string{"disk"},
+		},
+		{
+			name: "shutting down",
+			handler: func() *HealthHandler {
+				h := NewHealthHandler(storage.NewMemoryStore())
+				h.ShuttingDown()
+				return h
+			},
+			status:   http.StatusServiceUnavailable,
+			failures: []string{"shutdown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler().HandleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), dir) {
+				t.Errorf("Expected no file paths in the probe response, got %s", w.Body.String())
+			}
+			var resp HealthResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for _, name := range tt.failures {
+				if resp.Checks[name] == "" || resp.Checks[name] == "ok" {
+					t.Errorf("Expected check %s to fail, got %v", name, resp.Checks)
+				}
+				if msg, ok := readinessFailures[name]; ok && resp.Checks[name] != msg {
+					t.Errorf("Expected check %s to report %q, got %q", name, msg, resp.Checks[name])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: time.Now()}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-2", Location: "Forest", Count: 1, DateTime: time.Now()}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := store.Delete(t.Context(), "test-2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	handler := NewHealthHandler(store, WithVersion("1.2.3"))
+
+	w := httptest.NewRecorder()
+	handler.HandleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for anonymous request, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.HandleStatus(w, asUser(httptest.NewRequest(http.MethodGet, "/status", nil), "user-1", models.RoleUser))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for user, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.HandleStatus(w, asUser(httptest.NewRequest(http.MethodGet, "/status", nil), "admin-1", models.RoleAdmin))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp StatusResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Version != "1.2.3" || !resp.Ready || resp.GoVersion == "" {
+		t.Errorf("Unexpected status: %+v", resp)
+	}
+	if resp.Storage.Backend != "memory" || resp.Storage.Items != 1 || resp.Storage.Trash != 1 || resp.Storage.Revision != 3 {
+		t.Errorf("Unexpected storage stats: %+v", resp.Storage)
+	}
+	if resp.Checks["storage"] != "ok" {
+		t.Errorf("Expected storage check ok, got %v", resp.Checks)
+	}
+}
+
+func TestHandleStatus_CheckDetails(t *testing.T) {
+	handler := NewHealthHandler(storage.NewFileStore(filepath.Join(t.TempDir(), "data.json")), WithMinFreeDisk(1<<62))
+
+	w := httptest.NewRecorder()
+	handler.HandleStatus(w, asUser(httptest.NewRequest(http.MethodGet, "/status", nil), "admin-1", models.RoleAdmin))
+	var resp StatusResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Ready || !strings.Contains(resp.Checks["disk"], "bytes free") {
+		t.Errorf("Expected the disk check details, got ready=%v checks=%v", resp.Ready, resp.Checks)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"service/logger"
+	"service/problem"
+	"service/storage"
+)
+
+// RevertRequest is the body accepted by POST /items/{id}/revert
+type RevertRequest struct {
+	Revision int64 `json:"revision"`
+}
+
+// getHistory lists every version of an item, oldest first, without the full
+// content of each version
+func (h *ItemHandler) getHistory(w http.ResponseWriter, r *http.Request, id string) {
+	entries, err := h.store.History(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error getting item history", map[string]interface{}{
+			"error":   err.Error(),
+			"item_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	entries = h.presentHistory(r, id, entries)
+	for i := range entries {
+		entries[i].Item = nil
+	}
+	writeJSON(w, r, http.StatusOK, entries)
+}
+
+// getRevision returns a single version of an item, including its content
+func (h *ItemHandler) getRevision(w http.ResponseWriter, r *http.Request, id, rev string) {
+	revision, err := strconv.ParseInt(rev, 10, 64)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+
+	entry, err := h.store.HistoryAt(id, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
+		case errors.Is(err, storage.ErrRevisionNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Revision not found")
+		default:
+			logger.ErrorContext(r.Context(), "Error getting item revision", map[string]interface{}{
+				"error":    err.Error(),
+				"item_id":  id,
+				"revision": revision,
+			})
+			problem.Error(w, r, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, h.presentHistory(r, id, []storage.HistoryEntry{entry})[0])
+}
+
+// revertItem restores the content of an item to an earlier revision
+func (h *ItemHandler) revertItem(w http.ResponseWriter, r *http.Request, id string) {
+	var req RevertRequest
+	if err := h.decoder.decodeJSON(w, r, &req); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	if req.Revision < 1 {
+		invalid(w, r, problem.Invalid("/revision", problem.CodeRequired, "revision is required"))
+		return
+	}
+
+	item, err := h.store.Revert(r.Context(), id, req.Revision, requestActor(r), h.changeGuard(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
+		case errors.Is(err, storage.ErrForbidden):
+			problem.Error(w, r, http.StatusForbidden, "")
+		case errors.Is(err, storage.ErrRevisionNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Revision not found")
+		default:
+			logger.ErrorContext(r.Context(), "Error reverting item", map[string]interface{}{
+				"error":    err.Error(),
+				"item_id":  id,
+				"revision": req.Revision,
+			})
+			problem.Error(w, r, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, h.present(r, item))
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"service/storage"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandleItemByID_History(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	original, _ := handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now})
+	edit := original
+	edit.Count = 7
+	handler.store.Update(t.Context(), "test-1", edit, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/items/test-1/history", nil)
+	w := httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var entries []storage.HistoryEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(entries))
+	}
+	if entries[0].Item != nil {
+		t.Error("Expected history list to omit item content")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/items/test-1/history/"+strconv.FormatInt(original.Revision, 10), nil)
+	w = httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var entry storage.HistoryEntry
+	if err := json.NewDecoder(w.Body).Decode(&entry); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if entry.Item == nil || entry.Item.Count != 5 {
+		t.Errorf("Expected original version with count 5, got %+v", entry.Item)
+	}
+}
+
+func TestHandleItemByID_HistoryErrors(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: time.Now()})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{"unknown item", http.MethodGet, "/items/non-existent/history", http.StatusNotFound},
+		{"unknown revision", http.MethodGet, "/items/test-1/history/999", http.StatusNotFound},
+		{"invalid revision", http.MethodGet, "/items/test-1/history/latest", http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/items/test-1/history", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			handler.HandleItemByID(w, req)
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleItemByID_Revert(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	original, _ := handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now})
+	edit := original
+	edit.MushroomName = "Jack-o'-lantern"
+	handler.store.Update(t.Context(), "test-1", edit, nil)
+
+	body, _ := json.Marshal(RevertRequest{Revision: original.Revision})
+	req := httptest.NewRequest(http.MethodPost, "/items/test-1/revert", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	current, _ := handler.store.Get(t.Context(), "test-1")
+	if current.MushroomName != "Chanterelle" {
+		t.Errorf("Expected MushroomName Chanterelle, got %s", current.MushroomName)
+	}
+
+	body, _ = json.Marshal(RevertRequest{Revision: 999})
+	req = httptest.NewRequest(http.MethodPost, "/items/test-1/revert", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
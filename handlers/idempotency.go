@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"service/auth"
+	"service/middleware"
+	"service/problem"
+	"service/storage"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the client's key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a stored record
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// withIdempotency runs next at most once per Idempotency-Key and client. Retries
+// with the same key and body replay the stored response; reusing a key with a
+// different body is rejected with 422. Requests without the header are passed
+// through.
+func (h *ItemHandler) withIdempotency(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request)) {
+	clientKey := r.Header.Get(IdempotencyKeyHeader)
+	if clientKey == "" {
+		next(w, r)
+		return
+	}
+	if len(clientKey) > maxIdempotencyKeyLength {
+		problem.Error(w, r, http.StatusBadRequest, "Idempotency-Key is too long")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.decoder.maxUpload()))
+	if err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Keys are only unique per client, and a response must never be replayed
+	// to a client other than the one it was written for
+	key := h.idempotencyScope(r) + " " + clientKey
+	rec, err := h.idempotency.Begin(key, requestFingerprint(r, body))
+	switch {
+	case errors.Is(err, storage.ErrIdempotencyMismatch):
+		problem.Write(w, r, problem.Typed(problem.TypeIdempotencyMismatch, http.StatusUnprocessableEntity, "Idempotency key reused", err.Error()))
+		return
+	case errors.Is(err, storage.ErrIdempotencyInProgress):
+		problem.Write(w, r, problem.Typed(problem.TypeIdempotencyInProgress, http.StatusConflict, "Request in progress", err.Error()))
+		return
+	case rec != nil:
+		for name, values := range rec.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(rec.Status)
+		w.Write(rec.Body)
+		return
+	}
+
+	// Headers set before next, such as X-Request-Id and RateLimit-*, belong to
+	// this request and are not replayed
+	before := w.Header().Clone()
+	cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+	completed := false
+	defer func() {
+		// Server errors and panics are not remembered so that a retry can
+		// succeed
+		if !completed {
+			h.idempotency.Release(key)
+		}
+	}()
+	next(cw, r)
+
+	if cw.status >= http.StatusInternalServerError {
+		return
+	}
+	h.idempotency.Complete(key, cw.status, headerSetSince(before, cw.Header()), cw.body.Bytes())
+	completed = true
+}
+
+// idempotencyScope identifies the client sending r: its user, or its IP
+// address when anonymous
+func (h *ItemHandler) idempotencyScope(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return "user:" + p.UserID
+	}
+	return "ip:" + middleware.ClientIP(r, h.trustedProxies)
+}
+
+// headerSetSince returns the fields of header that were added or changed since
+// before
+func headerSetSince(before, header http.Header) http.Header {
+	set := make(http.Header)
+	for name, values := range header {
+		if !slices.Equal(before[name], values) {
+			set[name] = slices.Clone(values)
+		}
+	}
+	return set
+}
+
+// requestFingerprint identifies a request by method, path and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	io.WriteString(sum, r.Method)
+	io.WriteString(sum, " ")
+	io.WriteString(sum, r.URL.Path)
+	io.WriteString(sum, "\n")
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// captureWriter records the status and body written through it
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	cw.status = status
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
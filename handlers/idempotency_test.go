@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"service/problem"
+	"testing"
+	"time"
+)
+
+func postWithKey(handler *ItemHandler, key string, item models.Item) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(item)
+	req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	handler.HandleItems(w, req)
+	return w
+}
+
+func TestHandleItems_POST_IdempotentRetry(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	item := models.Item{MushroomName: "Chanterelle", Location: "Forest Trail", Count: 5, DateTime: time.Now()}
+
+	first := postWithKey(handler, "retry-1", item)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, first.Code)
+	}
+
+	second := postWithKey(handler, "retry-1", item)
+	if second.Code != http.StatusCreated {
+		t.Fatalf("Expected replayed status %d, got %d", http.StatusCreated, second.Code)
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("Expected replayed response to be marked")
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("Expected identical bodies, got %s and %s", first.Body.String(), second.Body.String())
+	}
+
+	if n := len(handler.store.GetAll(t.Context())); n != 1 {
+		t.Errorf("Expected 1 item after retry, got %d", n)
+	}
+}
+
+func TestHandleItems_POST_IdempotencyKeyReuse(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	item := models.Item{MushroomName: "Chanterelle", Location: "Forest Trail", Count: 5, DateTime: time.Now()}
+	if w := postWithKey(handler, "reuse-1", item); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	item.Count = 6
+	w := postWithKey(handler, "reuse-1", item)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if p := decodeProblem(t, w); p.Type != problem.TypeIdempotencyMismatch {
+		t.Errorf("Expected type %s, got %s", problem.TypeIdempotencyMismatch, p.Type)
+	}
+}
+
+func TestHandleItems_POST_IdempotentValidationError(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	item := models.Item{Location: "Forest Trail", Count: 5, DateTime: time.Now()}
+
+	for i := 0; i < 2; i++ {
+		w := postWithKey(handler, "invalid-1", item)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Attempt %d: expected status %d, got %d", i, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestHandleItems_POST_IdempotencyScopedByClient(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(models.Item{MushroomName: "Chanterelle", Location: "Forest Trail", Count: 5, DateTime: time.Now()})
+	post := func(userID, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "shared-1")
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = asUser(req, userID, models.RoleUser)
+		}
+		w := httptest.NewRecorder()
+		handler.HandleItems(w, req)
+		return w
+	}
+
+	for _, caller := range []struct{ userID, remoteAddr string }{
+		{"user-1", "192.0.2.1:1234"},
+		{"user-2", "192.0.2.1:1234"},
+		{"", "192.0.2.1:1234"},
+		{"", "192.0.2.2:1234"},
+	} {
+		w := post(caller.userID, caller.remoteAddr)
+		if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+			t.Errorf("Expected %+v to get a fresh 201, got %d replayed=%q", caller, w.Code, w.Header().Get(IdempotentReplayedHeader))
+		}
+	}
+	if w := post("user-1", "192.0.2.9:1234"); w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("Expected a retry by the same user from another address to be replayed")
+	}
+	if n := len(handler.store.GetAll(t.Context())); n != 4 {
+		t.Errorf("Expected one item per client, got %d", n)
+	}
+}
+
+func TestHandleItems_POST_IdempotentReplayHeaders(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(models.Item{MushroomName: "Chanterelle", Location: "Forest Trail", Count: 5, DateTime: time.Now()})
+	post := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "headers-1")
+		w := httptest.NewRecorder()
+		// Set by middleware before the handler runs
+		w.Header().Set("X-Request-Id", requestID)
+		w.Header().Set("RateLimit-Remaining", requestID)
+		handler.HandleItems(w, req)
+		return w
+	}
+
+	post("req-1")
+	w := post("req-2")
+	if w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatal("Expected the retry to be replayed")
+	}
+	if got := w.Header().Get("X-Request-Id"); got != "req-2" {
+		t.Errorf("Expected the retry's own X-Request-Id, got %q", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "req-2" {
+		t.Errorf("Expected the retry's own RateLimit-Remaining, got %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected the handler's Content-Type to be replayed, got %q", got)
+	}
+}
+
+func TestWithIdempotency_PanicReleasesKey(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	request := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBufferString(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "panic-1")
+		return req
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to propagate")
+			}
+		}()
+		handler.withIdempotency(httptest.NewRecorder(), request(), func(http.ResponseWriter, *http.Request) {
+			panic("handler failed")
+		})
+	}()
+
+	ran := false
+	handler.withIdempotency(httptest.NewRecorder(), request(), func(w http.ResponseWriter, r *http.Request) {
+		ran = true
+		w.WriteHeader(http.StatusCreated)
+	})
+	if !ran {
+		t.Error("Expected the retry after a panic to run rather than be reported in progress")
+	}
+}
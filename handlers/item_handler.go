@@ -4,42 +4,124 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
 	"service/logger"
 	"service/models"
+	"service/privacy"
+	"service/problem"
 	"service/storage"
+	"service/validation"
 
 	"github.com/google/uuid"
 )
 
 type ItemHandler struct {
-	store *storage.Store
+	store       *storage.Store
+	idempotency *storage.IdempotencyStore
+	privacy     *privacy.Policy
+	decoder     Decoder
+	// trustedProxies are the proxies whose X-Forwarded-For identifies
+	// anonymous clients
+	trustedProxies []netip.Prefix
+	// editUnowned lets everyone change sightings without an owner
+	editUnowned bool
 }
 
-func NewItemHandler(store *storage.Store) *ItemHandler {
-	return &ItemHandler{store: store}
+// Option configures an ItemHandler
+type Option func(*ItemHandler)
+
+// WithIdempotencyStore sets the store used to deduplicate retried POSTs
+func WithIdempotencyStore(s *storage.IdempotencyStore) Option {
+	return func(h *ItemHandler) {
+		h.idempotency = s
+	}
+}
+
+// WithDecoder sets how request bodies are decoded
+func WithDecoder(d Decoder) Option {
+	return func(h *ItemHandler) {
+		h.decoder = d
+	}
+}
+
+// WithTrustedProxies sets the proxies whose X-Forwarded-For header is
+// honoured when telling anonymous clients apart
+func WithTrustedProxies(proxies []netip.Prefix) Option {
+	return func(h *ItemHandler) {
+		h.trustedProxies = proxies
+	}
+}
+
+func NewItemHandler(store *storage.Store, opts ...Option) *ItemHandler {
+	h := &ItemHandler{store: store}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.idempotency == nil {
+		h.idempotency = storage.NewIdempotencyStore(storage.DefaultIdempotencyTTL)
+	}
+	if h.privacy == nil {
+		h.privacy = privacy.NewPolicy()
+	}
+	return h
 }
 
 // HandleItems handles POST (create) and GET (list all) requests
 func (h *ItemHandler) HandleItems(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		h.createItem(w, r)
+		h.withIdempotency(w, r, h.createItem)
 	case http.MethodGet:
 		h.getAllItems(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
-// HandleItemByID handles GET (read), PUT (update), and DELETE requests for specific items
+// HandleItemByID handles GET (read), PUT (update), and DELETE requests for specific items,
+// POST /items/{id}/restore to take an item out of the trash, and the revision
+// history endpoints GET /items/{id}/history[/{rev}] and POST /items/{id}/revert
 func (h *ItemHandler) HandleItemByID(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from path
-	id := strings.TrimPrefix(r.URL.Path, "/items/")
+	// Extract ID and optional action from path
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/items/"), "/")
 	if id == "" {
-		http.Error(w, "Item ID required", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "Item ID required")
+		return
+	}
+
+	action, revision, _ := strings.Cut(action, "/")
+	switch {
+	case action == "":
+	case action == "restore" && revision == "":
+		if r.Method != http.MethodPost {
+			problem.MethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		h.restoreItem(w, r, id)
+		return
+	case action == "revert" && revision == "":
+		if r.Method != http.MethodPost {
+			problem.MethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		h.revertItem(w, r, id)
+		return
+	case action == "history":
+		if r.Method != http.MethodGet {
+			problem.MethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		if revision == "" {
+			h.getHistory(w, r, id)
+		} else {
+			h.getRevision(w, r, id, revision)
+		}
+		return
+	default:
+		problem.Error(w, r, http.StatusNotFound, "")
 		return
 	}
 
@@ -48,42 +130,63 @@ func (h *ItemHandler) HandleItemByID(w http.ResponseWriter, r *http.Request) {
 		h.getItem(w, r, id)
 	case http.MethodPut:
 		h.updateItem(w, r, id)
+	case http.MethodPatch:
+		h.updateSpecies(w, r, id)
 	case http.MethodDelete:
 		h.deleteItem(w, r, id)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
 	}
 }
 
-// validateSighting validates required fields for a mushroom sighting
+// Limits on sightings
+const (
+	// MaxSightingCount caps the number of mushrooms one sighting may report
+	MaxSightingCount = 10000
+	// MaxClockSkew is how far in the future a sighting's dateTime may lie,
+	// for clients whose clocks run fast
+	MaxClockSkew = 5 * time.Minute
+)
+
+// validateSighting reports every rule a mushroom sighting breaks
 func validateSighting(item *models.Item) error {
-	if item.MushroomName == "" {
-		return errors.New("mushroomName is required")
-	}
-	if item.Location == "" {
-		return errors.New("location is required")
+	v := validation.New()
+	checkSighting(v, item, time.Now())
+	return v.Err()
+}
+
+// checkSighting records the rules item breaks in v, at v's location
+func checkSighting(v *validation.Validator, item *models.Item, now time.Time) {
+	v.Required("mushroomName", item.MushroomName != "")
+	v.Required("location", item.Location != "")
+	v.Min("count", float64(item.Count), 1)
+	v.Max("count", float64(item.Count), MaxSightingCount)
+	if v.Required("dateTime", !item.DateTime.IsZero()) {
+		v.NotAfter("dateTime", item.DateTime, now.Add(MaxClockSkew), "dateTime must not be in the future")
 	}
-	if item.Count < 1 {
-		return errors.New("count must be at least 1")
+	v.Check(item.Latitude != nil || item.Longitude == nil, "latitude", problem.CodeRequired, "latitude and longitude must be set together")
+	v.Check(item.Longitude != nil || item.Latitude == nil, "longitude", problem.CodeRequired, "latitude and longitude must be set together")
+	if item.Latitude != nil {
+		v.Between("latitude", *item.Latitude, -90, 90)
 	}
-	if item.DateTime.IsZero() {
-		return errors.New("dateTime is required")
+	if item.Longitude != nil {
+		v.Between("longitude", *item.Longitude, -180, 180)
 	}
-	return nil
+	v.Check(privacy.ValidVisibility(item.Visibility), "visibility", problem.CodeFormat, "visibility must be one of public, obscured, private")
 }
 
 // createItem creates a new item
 func (h *ItemHandler) createItem(w http.ResponseWriter, r *http.Request) {
 	var item models.Item
 
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := h.decoder.decodeUpload(w, r, &item); err != nil {
+		invalidBody(w, r, err)
 		return
 	}
 
 	// Validate required fields
-	if err := validateSighting(&item); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validateSightingTraced(r, &item); err != nil {
+		invalid(w, r, err)
 		return
 	}
 
@@ -96,25 +199,28 @@ func (h *ItemHandler) createItem(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 	item.CreatedAt = now
 	item.UpdatedAt = now
+	item.UpdatedBy = requestActor(r)
+	item.Owner = requestOwner(r)
 
-	if err := h.store.Create(item); err != nil {
+	created, err := h.store.Create(r.Context(), item)
+	if err != nil {
 		if errors.Is(err, storage.ErrAlreadyExists) {
-			http.Error(w, "Item already exists", http.StatusConflict)
+			problem.Write(w, r, problem.Typed(problem.TypeAlreadyExists, http.StatusConflict, "Already exists", "Item already exists"))
 			return
 		}
-		logger.Error("Error creating item", map[string]interface{}{
+		logger.ErrorContext(r.Context(), "Error creating item", map[string]interface{}{
 			"error":    err.Error(),
 			"item_id":  item.ID,
 			"location": item.Location,
 		})
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, "")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		logger.Error("Failed to encode response", map[string]interface{}{
+	if err := json.NewEncoder(w).Encode(h.present(r, created)); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode response", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
@@ -122,11 +228,11 @@ func (h *ItemHandler) createItem(w http.ResponseWriter, r *http.Request) {
 
 // getAllItems retrieves all items
 func (h *ItemHandler) getAllItems(w http.ResponseWriter, r *http.Request) {
-	items := h.store.GetAll()
+	items := h.presentAll(r, h.store.GetAll(r.Context()))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(items); err != nil {
-		logger.Error("Failed to encode response", map[string]interface{}{
+		logger.ErrorContext(r.Context(), "Failed to encode response", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
@@ -134,23 +240,23 @@ func (h *ItemHandler) getAllItems(w http.ResponseWriter, r *http.Request) {
 
 // getItem retrieves a specific item by ID
 func (h *ItemHandler) getItem(w http.ResponseWriter, r *http.Request, id string) {
-	item, err := h.store.Get(id)
+	item, err := h.store.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
-			http.Error(w, "Item not found", http.StatusNotFound)
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
 			return
 		}
-		logger.Error("Error getting item", map[string]interface{}{
+		logger.ErrorContext(r.Context(), "Error getting item", map[string]interface{}{
 			"error":   err.Error(),
 			"item_id": id,
 		})
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, "")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		logger.Error("Failed to encode response", map[string]interface{}{
+	if err := json.NewEncoder(w).Encode(h.present(r, item)); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode response", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
@@ -160,55 +266,106 @@ func (h *ItemHandler) getItem(w http.ResponseWriter, r *http.Request, id string)
 func (h *ItemHandler) updateItem(w http.ResponseWriter, r *http.Request, id string) {
 	var item models.Item
 
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := h.decoder.decodeUpload(w, r, &item); err != nil {
+		invalidBody(w, r, err)
 		return
 	}
 
 	// Validate required fields
-	if err := validateSighting(&item); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validateSightingTraced(r, &item); err != nil {
+		invalid(w, r, err)
 		return
 	}
 
 	// Preserve the ID from the URL
 	item.ID = id
 	item.UpdatedAt = time.Now()
+	item.UpdatedBy = requestActor(r)
 
-	if err := h.store.Update(id, item); err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			http.Error(w, "Item not found", http.StatusNotFound)
+	updated, err := h.store.Update(r.Context(), id, item, h.changeGuard(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
+			return
+		case errors.Is(err, storage.ErrForbidden):
+			problem.Error(w, r, http.StatusForbidden, "")
 			return
 		}
-		logger.Error("Error updating item", map[string]interface{}{
+		logger.ErrorContext(r.Context(), "Error updating item", map[string]interface{}{
 			"error":    err.Error(),
 			"item_id":  id,
 			"location": item.Location,
 		})
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, "")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		logger.Error("Failed to encode response", map[string]interface{}{
+	if err := json.NewEncoder(w).Encode(h.present(r, updated)); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode response", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 }
 
-// deleteItem removes an item
+// SpeciesUpdate is the body accepted by PATCH /items/{id}
+type SpeciesUpdate struct {
+	MushroomName string `json:"mushroomName"`
+}
+
+// updateSpecies corrects the species identification of a sighting, leaving
+// every other field untouched. Moderators may do this for any sighting.
+func (h *ItemHandler) updateSpecies(w http.ResponseWriter, r *http.Request, id string) {
+	var req SpeciesUpdate
+
+	if err := h.decoder.decodeJSON(w, r, &req); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	v := validation.New()
+	if !v.Required("mushroomName", req.MushroomName != "") {
+		invalid(w, r, v.Err())
+		return
+	}
+
+	updated, err := h.store.UpdateSpecies(r.Context(), id, req.MushroomName, requestActor(r), h.identifyGuard(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
+			return
+		case errors.Is(err, storage.ErrForbidden):
+			problem.Error(w, r, http.StatusForbidden, "")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error updating species", map[string]interface{}{
+			"error":   err.Error(),
+			"item_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, h.present(r, updated))
+}
+
+// deleteItem moves an item to the trash
 func (h *ItemHandler) deleteItem(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.store.Delete(id); err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			http.Error(w, "Item not found", http.StatusNotFound)
+	if err := h.store.DeleteBy(r.Context(), id, requestActor(r), h.changeGuard(r)); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Item not found")
+			return
+		case errors.Is(err, storage.ErrForbidden):
+			problem.Error(w, r, http.StatusForbidden, "")
 			return
 		}
-		logger.Error("Error deleting item", map[string]interface{}{
+		logger.ErrorContext(r.Context(), "Error deleting item", map[string]interface{}{
 			"error":   err.Error(),
 			"item_id": id,
 		})
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, "")
 		return
 	}
 
@@ -7,17 +7,33 @@ import (
 	"net/http/httptest"
 	"os"
 	"service/models"
+	"service/problem"
 	"service/storage"
 	"testing"
 	"time"
 )
 
+// decodeProblem decodes the problem details in w
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	if got := w.Header().Get("Content-Type"); got != problem.ContentType {
+		t.Errorf("Expected Content-Type %s, got %s", problem.ContentType, got)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	return p
+}
+
 func createTestHandler(t *testing.T) (*ItemHandler, func()) {
 	// Clean up any existing test file
 	os.Remove("data.json") // NewStore uses "data.json" as default
 
 	store := storage.NewStore()
-	handler := NewItemHandler(store)
+	// Most tests change sightings anonymously, as in a deployment without
+	// accounts
+	handler := NewItemHandler(store, WithEditUnowned(true))
 
 	cleanup := func() {
 		os.Remove("data.json")
@@ -72,6 +88,7 @@ func TestHandleItems_POST_ValidationError(t *testing.T) {
 	tests := []struct {
 		name     string
 		item     models.Item
+		field    string
 		expected string
 	}{
 		{
@@ -81,6 +98,7 @@ func TestHandleItems_POST_ValidationError(t *testing.T) {
 				Count:    5,
 				DateTime: time.Now(),
 			},
+			field:    "/mushroomName",
 			expected: "mushroomName is required",
 		},
 		{
@@ -90,6 +108,7 @@ func TestHandleItems_POST_ValidationError(t *testing.T) {
 				Count:        5,
 				DateTime:     time.Now(),
 			},
+			field:    "/location",
 			expected: "location is required",
 		},
 		{
@@ -100,6 +119,7 @@ func TestHandleItems_POST_ValidationError(t *testing.T) {
 				Count:        0,
 				DateTime:     time.Now(),
 			},
+			field:    "/count",
 			expected: "count must be at least 1",
 		},
 		{
@@ -110,6 +130,7 @@ func TestHandleItems_POST_ValidationError(t *testing.T) {
 				Count:        5,
 				DateTime:     time.Time{},
 			},
+			field:    "/dateTime",
 			expected: "dateTime is required",
 		},
 	}
@@ -126,10 +147,71 @@ func TestHandleItems_POST_ValidationError(t *testing.T) {
 			if w.Code != http.StatusBadRequest {
 				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
 			}
+			p := decodeProblem(t, w)
+			if p.Type != problem.TypeValidation || len(p.Errors) != 1 || p.Errors[0].Field != tt.field || p.Errors[0].Detail != tt.expected {
+				t.Errorf("Expected a validation problem on %s, got %+v", tt.field, p)
+			}
 		})
 	}
 }
 
+func TestHandleItems_POST_AllValidationErrors(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	body := `{"location":"Forest","count":20000,"dateTime":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `","latitude":95}`
+	req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleItems(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	want := []problem.FieldError{
+		{Field: "/mushroomName", Code: problem.CodeRequired},
+		{Field: "/count", Code: problem.CodeMax},
+		{Field: "/dateTime", Code: problem.CodeMax},
+		{Field: "/longitude", Code: problem.CodeRequired},
+		{Field: "/latitude", Code: problem.CodeMax},
+	}
+	p := decodeProblem(t, w)
+	if len(p.Errors) != len(want) {
+		t.Fatalf("Expected %d field errors, got %+v", len(want), p.Errors)
+	}
+	for i, fe := range want {
+		if p.Errors[i].Field != fe.Field || p.Errors[i].Code != fe.Code {
+			t.Errorf("Expected %s %s, got %+v", fe.Field, fe.Code, p.Errors[i])
+		}
+	}
+}
+
+func TestHandleItems_POST_IgnoresDeletedAt(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	body, _ := json.Marshal(models.Item{MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, DeletedAt: &now})
+	req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleItems(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	var created models.Item
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.DeletedAt != nil {
+		t.Error("Expected deletedAt from the client to be ignored")
+	}
+	if _, err := handler.store.Get(t.Context(), created.ID); err != nil {
+		t.Errorf("Expected the sighting to be active, got %v", err)
+	}
+}
+
 func TestHandleItems_POST_InvalidJSON(t *testing.T) {
 	handler, cleanup := createTestHandler(t)
 	defer cleanup()
@@ -143,6 +225,9 @@ func TestHandleItems_POST_InvalidJSON(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
+	if p := decodeProblem(t, w); p.Type != problem.TypeInvalidBody || p.Detail == "" {
+		t.Errorf("Expected an invalid body problem with the parse error, got %+v", p)
+	}
 }
 
 func TestHandleItems_GET_Success(t *testing.T) {
@@ -157,7 +242,7 @@ func TestHandleItems_GET_Success(t *testing.T) {
 	}
 
 	for _, item := range items {
-		if err := handler.store.Create(item); err != nil {
+		if _, err := handler.store.Create(t.Context(), item); err != nil {
 			t.Fatalf("Failed to create test item: %v", err)
 		}
 	}
@@ -193,6 +278,12 @@ func TestHandleItems_MethodNotAllowed(t *testing.T) {
 	if w.Code != http.StatusMethodNotAllowed {
 		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
 	}
+	if got := w.Header().Get("Allow"); got != "GET, POST" {
+		t.Errorf("Expected Allow: GET, POST, got %q", got)
+	}
+	if p := decodeProblem(t, w); p.Status != http.StatusMethodNotAllowed || p.Instance != "/items" {
+		t.Errorf("Unexpected problem %+v", p)
+	}
 }
 
 func TestHandleItemByID_GET_Success(t *testing.T) {
@@ -210,7 +301,7 @@ func TestHandleItemByID_GET_Success(t *testing.T) {
 		UpdatedAt:    now,
 	}
 
-	if err := handler.store.Create(item); err != nil {
+	if _, err := handler.store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Failed to create test item: %v", err)
 	}
 
@@ -262,7 +353,7 @@ func TestHandleItemByID_PUT_Success(t *testing.T) {
 		UpdatedAt:    now,
 	}
 
-	if err := handler.store.Create(item); err != nil {
+	if _, err := handler.store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Failed to create test item: %v", err)
 	}
 
@@ -333,7 +424,7 @@ func TestHandleItemByID_PUT_ValidationError(t *testing.T) {
 		UpdatedAt:    now,
 	}
 
-	if err := handler.store.Create(item); err != nil {
+	if _, err := handler.store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Failed to create test item: %v", err)
 	}
 
@@ -385,7 +476,7 @@ func TestHandleItemByID_DELETE_Success(t *testing.T) {
 		UpdatedAt:    now,
 	}
 
-	if err := handler.store.Create(item); err != nil {
+	if _, err := handler.store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Failed to create test item: %v", err)
 	}
 
@@ -399,7 +490,7 @@ func TestHandleItemByID_DELETE_Success(t *testing.T) {
 	}
 
 	// Verify item is deleted
-	_, err := handler.store.Get("test-1")
+	_, err := handler.store.Get(t.Context(), "test-1")
 	if err != storage.ErrNotFound {
 		t.Errorf("Expected item to be deleted, but still exists")
 	}
@@ -445,6 +536,9 @@ func TestHandleItemByID_MethodNotAllowed(t *testing.T) {
 	if w.Code != http.StatusMethodNotAllowed {
 		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
 	}
+	if got := w.Header().Get("Allow"); got != "GET, PUT, PATCH, DELETE" {
+		t.Errorf("Expected Allow: GET, PUT, PATCH, DELETE, got %q", got)
+	}
 }
 
 func TestValidateSighting(t *testing.T) {
@@ -503,6 +597,36 @@ func TestValidateSighting(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "count above maximum",
+			item: models.Item{
+				MushroomName: "Chanterelle",
+				Location:     "Forest",
+				Count:        MaxSightingCount + 1,
+				DateTime:     time.Now(),
+			},
+			expectErr: true,
+		},
+		{
+			name: "dateTime within clock skew",
+			item: models.Item{
+				MushroomName: "Chanterelle",
+				Location:     "Forest",
+				Count:        5,
+				DateTime:     time.Now().Add(MaxClockSkew / 2),
+			},
+			expectErr: false,
+		},
+		{
+			name: "dateTime in the future",
+			item: models.Item{
+				MushroomName: "Chanterelle",
+				Location:     "Forest",
+				Count:        5,
+				DateTime:     time.Now().Add(time.Hour),
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"service/metrics"
+	"service/problem"
+)
+
+type MetricsHandler struct {
+	registry *metrics.Registry
+	token    string
+}
+
+// NewMetricsHandler serves registry. A non-empty token must be presented as a
+// bearer token, as Prometheus does with its authorization setting.
+func NewMetricsHandler(registry *metrics.Registry, token string) *MetricsHandler {
+	return &MetricsHandler{registry: registry, token: token}
+}
+
+// HandleMetrics serves GET /metrics in the Prometheus text format
+func (h *MetricsHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	if h.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			problem.Error(w, r, http.StatusUnauthorized, "")
+			return
+		}
+	}
+	h.registry.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"service/metrics"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewGaugeFunc("test_value", "A test value.", func() float64 { return 7 })
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{"open", "", "", http.StatusOK},
+		{"token required", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			NewMetricsHandler(registry, tt.token).HandleMetrics(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status == http.StatusOK {
+				if w.Header().Get("Content-Type") != metrics.ContentType {
+					t.Errorf("Expected content type %s, got %s", metrics.ContentType, w.Header().Get("Content-Type"))
+				}
+				if !strings.Contains(w.Body.String(), "test_value 7") {
+					t.Errorf("Expected metric in body, got %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
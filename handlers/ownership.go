@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service/auth"
+	"service/models"
+	"service/problem"
+	"service/storage"
+)
+
+// AnonymousActor is recorded as the actor of changes made without an
+// authenticated user
+const AnonymousActor = "anonymous"
+
+// requestActor identifies who is making a change, for the revision history
+func requestActor(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.UserID
+	}
+	return AnonymousActor
+}
+
+// requestOwner returns the owner recorded on sightings created by r, empty
+// for anonymous requests
+func requestOwner(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.UserID
+	}
+	return ""
+}
+
+// WithEditUnowned lets everyone change sightings without an owner, which were
+// created anonymously. By default only admins may.
+func WithEditUnowned(allowed bool) Option {
+	return func(h *ItemHandler) {
+		h.editUnowned = allowed
+	}
+}
+
+// canModify reports whether p may change, delete or restore item. Sightings
+// without an owner were created anonymously; unless editUnowned is set only
+// admins may change them.
+func (h *ItemHandler) canModify(p *auth.Principal, item models.Item) bool {
+	if item.Owner == "" {
+		return h.editUnowned || p.IsAdmin()
+	}
+	return p.IsAdmin() || (p != nil && p.UserID == item.Owner)
+}
+
+// changeGuard lets the store refuse changes the principal of r may not make
+func (h *ItemHandler) changeGuard(r *http.Request) storage.Guard {
+	p := auth.FromContext(r.Context())
+	return func(item models.Item) bool {
+		return h.canModify(p, item)
+	}
+}
+
+// identifyGuard lets the store refuse species corrections the principal of r
+// may not make. Moderators may correct any sighting.
+func (h *ItemHandler) identifyGuard(r *http.Request) storage.Guard {
+	p := auth.FromContext(r.Context())
+	return func(item models.Item) bool {
+		return p.IsModerator() || h.canModify(p, item)
+	}
+}
+
+// authorizeAdmin returns true if the principal of r is an admin. Otherwise it
+// writes 401 Unauthorized for anonymous requests or 403 Forbidden and returns
+// false.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	p := auth.FromContext(r.Context())
+	switch {
+	case p == nil:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shroomp"`)
+		problem.Error(w, r, http.StatusUnauthorized, "Authentication required")
+		return false
+	case !p.IsAdmin():
+		problem.Error(w, r, http.StatusForbidden, "")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service/auth"
+	"service/models"
+	"testing"
+	"time"
+)
+
+// asUser attaches an authenticated principal to req, with every scope its
+// role can be granted
+func asUser(req *http.Request, userID, role string) *http.Request {
+	scopes := []string{models.ScopeRead, models.ScopeWrite}
+	if role == models.RoleAdmin {
+		scopes = []string{models.ScopeAdmin}
+	}
+	return req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, Role: role, Scopes: scopes}))
+}
+
+func TestHandleItems_POST_SetsOwner(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	item := models.Item{MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: time.Now(), Owner: "someone-else"}
+	body, _ := json.Marshal(item)
+	req := asUser(httptest.NewRequest(http.MethodPost, "/items", bytes.NewBuffer(body)), "user-1", models.RoleUser)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleItems(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var created models.Item
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.Owner != "user-1" {
+		t.Errorf("Expected owner user-1, got %q", created.Owner)
+	}
+	if created.UpdatedBy != "user-1" {
+		t.Errorf("Expected updatedBy user-1, got %q", created.UpdatedBy)
+	}
+}
+
+func TestHandleItemByID_OwnerAuthorization(t *testing.T) {
+	now := time.Now()
+	update := models.Item{MushroomName: "Updated", Location: "Forest", Count: 2, DateTime: now}
+
+	tests := []struct {
+		name        string
+		owner       string
+		userID      string
+		role        string
+		method      string
+		editUnowned bool
+		expected    int
+	}{
+		{"owner updates", "user-1", "user-1", models.RoleUser, http.MethodPut, false, http.StatusOK},
+		{"owner deletes", "user-1", "user-1", models.RoleUser, http.MethodDelete, false, http.StatusNoContent},
+		{"other user updates", "user-1", "user-2", models.RoleUser, http.MethodPut, false, http.StatusForbidden},
+		{"other user deletes", "user-1", "user-2", models.RoleUser, http.MethodDelete, false, http.StatusForbidden},
+		{"anonymous updates", "user-1", "", "", http.MethodPut, true, http.StatusForbidden},
+		{"admin updates", "user-1", "admin-1", models.RoleAdmin, http.MethodPut, false, http.StatusOK},
+		{"admin deletes", "user-1", "admin-1", models.RoleAdmin, http.MethodDelete, false, http.StatusNoContent},
+		{"moderator updates", "user-1", "mod-1", models.RoleModerator, http.MethodPut, false, http.StatusForbidden},
+		{"moderator deletes", "user-1", "mod-1", models.RoleModerator, http.MethodDelete, false, http.StatusForbidden},
+		{"anonymous updates unowned", "", "", "", http.MethodPut, false, http.StatusForbidden},
+		{"user deletes unowned", "", "user-1", models.RoleUser, http.MethodDelete, false, http.StatusForbidden},
+		{"admin updates unowned", "", "admin-1", models.RoleAdmin, http.MethodPut, false, http.StatusOK},
+		{"anonymous updates unowned when open", "", "", "", http.MethodPut, true, http.StatusOK},
+		{"user deletes unowned when open", "", "user-1", models.RoleUser, http.MethodDelete, true, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := createTestHandler(t)
+			defer cleanup()
+			WithEditUnowned(tt.editUnowned)(handler)
+
+			item := models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, Owner: tt.owner}
+			if _, err := handler.store.Create(t.Context(), item); err != nil {
+				t.Fatalf("Failed to create test item: %v", err)
+			}
+
+			body, _ := json.Marshal(update)
+			req := httptest.NewRequest(tt.method, "/items/test-1", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.userID != "" {
+				req = asUser(req, tt.userID, tt.role)
+			}
+			w := httptest.NewRecorder()
+
+			handler.HandleItemByID(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleItemByID_PATCH_Species(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		role     string
+		expected int
+	}{
+		{"owner", "user-1", models.RoleUser, http.StatusOK},
+		{"moderator", "mod-1", models.RoleModerator, http.StatusOK},
+		{"admin", "admin-1", models.RoleAdmin, http.StatusOK},
+		{"other user", "user-2", models.RoleUser, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := createTestHandler(t)
+			defer cleanup()
+
+			now := time.Now()
+			handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, Owner: "user-1"})
+
+			body, _ := json.Marshal(SpeciesUpdate{MushroomName: "False Chanterelle"})
+			req := asUser(httptest.NewRequest(http.MethodPatch, "/items/test-1", bytes.NewBuffer(body)), tt.userID, tt.role)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.HandleItemByID(w, req)
+
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			current, _ := handler.store.Get(t.Context(), "test-1")
+			if tt.expected == http.StatusOK {
+				if current.MushroomName != "False Chanterelle" || current.Location != "Forest" || current.Count != 5 {
+					t.Errorf("Expected only the species to change, got %+v", current)
+				}
+				if current.UpdatedBy != tt.userID {
+					t.Errorf("Expected UpdatedBy %s, got %s", tt.userID, current.UpdatedBy)
+				}
+			} else if current.MushroomName != "Chanterelle" {
+				t.Errorf("Expected species to stay unchanged, got %s", current.MushroomName)
+			}
+		})
+	}
+}
+
+func TestHandleItemByID_PUT_KeepsOwner(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, Owner: "user-1"})
+
+	body, _ := json.Marshal(models.Item{MushroomName: "Updated", Location: "Forest", Count: 2, DateTime: now, Owner: "admin-1"})
+	req := asUser(httptest.NewRequest(http.MethodPut, "/items/test-1", bytes.NewBuffer(body)), "admin-1", models.RoleAdmin)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleItemByID(w, req)
+
+	current, _ := handler.store.Get(t.Context(), "test-1")
+	if current.Owner != "user-1" {
+		t.Errorf("Expected owner to stay user-1, got %q", current.Owner)
+	}
+}
+
+func TestHandleBatch_OwnerAuthorization(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, Owner: "user-1"})
+
+	body, _ := json.Marshal(BatchRequest{Operations: []BatchOperation{
+		{Op: "delete", ID: "test-1"},
+		{Op: "create", Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 1, DateTime: now}},
+	}})
+	req := asUser(httptest.NewRequest(http.MethodPost, "/items:batch", bytes.NewBuffer(body)), "user-2", models.RoleUser)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleBatch(w, req)
+
+	var resp BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Results[0].Status != http.StatusForbidden {
+		t.Errorf("Expected status %d for delete, got %d", http.StatusForbidden, resp.Results[0].Status)
+	}
+	if resp.Results[1].Item == nil || resp.Results[1].Item.Owner != "user-2" {
+		t.Errorf("Expected created item owned by user-2, got %+v", resp.Results[1].Item)
+	}
+}
+
+func TestHandleBatch_OwnerAuthorizationAtomic(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, Owner: "user-1"})
+
+	body, _ := json.Marshal(BatchRequest{Atomic: true, Operations: []BatchOperation{
+		{Op: "create", Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 1, DateTime: now}},
+		{Op: "delete", ID: "test-1"},
+	}})
+	req := asUser(httptest.NewRequest(http.MethodPost, "/items:batch", bytes.NewBuffer(body)), "user-2", models.RoleUser)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleBatch(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if items := handler.store.GetAll(t.Context()); len(items) != 1 || items[0].ID != "test-1" {
+		t.Errorf("Expected the batch to be rolled back, got %+v", items)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service/auth"
+	"service/models"
+	"service/privacy"
+	"service/storage"
+)
+
+// locationFields are the history fields hidden together with the location
+var locationFields = map[string]bool{
+	"location":  true,
+	"latitude":  true,
+	"longitude": true,
+}
+
+// WithPrivacyPolicy sets the policy used to hide the location of sightings
+// from everyone but their owners
+func WithPrivacyPolicy(p *privacy.Policy) Option {
+	return func(h *ItemHandler) {
+		h.privacy = p
+	}
+}
+
+// canSeeLocation reports whether p may see the exact location of item: its
+// owner and admins can
+func canSeeLocation(p *auth.Principal, item models.Item) bool {
+	return p.IsAdmin() || (p != nil && item.Owner != "" && p.UserID == item.Owner)
+}
+
+// present returns item as the principal of r may see it
+func (h *ItemHandler) present(r *http.Request, item models.Item) models.Item {
+	if canSeeLocation(auth.FromContext(r.Context()), item) {
+		return item
+	}
+	return h.privacy.Redact(item)
+}
+
+// presentAll applies present to every item in place and returns items
+func (h *ItemHandler) presentAll(r *http.Request, items []models.Item) []models.Item {
+	for i := range items {
+		items[i] = h.present(r, items[i])
+	}
+	return items
+}
+
+// presentHistory hides the location recorded in history entries from
+// everyone but the owner. Each entry is hidden according to the stricter of
+// the visibility of that version and of the current version, so that making
+// a sighting private also hides where it used to be.
+func (h *ItemHandler) presentHistory(r *http.Request, id string, entries []storage.HistoryEntry) []storage.HistoryEntry {
+	// History is kept for sightings in the trash, so look there too. If the
+	// sighting is gone, hide everything.
+	current, err := h.store.GetIncludingDeleted(id)
+	if err != nil {
+		current = models.Item{Visibility: models.VisibilityPrivate}
+	}
+	if canSeeLocation(auth.FromContext(r.Context()), current) {
+		return entries
+	}
+
+	for i := range entries {
+		visibility := h.privacy.Visibility(current)
+		if entries[i].Item != nil {
+			visibility = privacy.Stricter(visibility, h.privacy.Visibility(*entries[i].Item))
+			item := h.privacy.Apply(*entries[i].Item, visibility)
+			entries[i].Item = &item
+		}
+		if visibility == models.VisibilityPublic {
+			continue
+		}
+
+		changes := make([]storage.FieldChange, len(entries[i].Changes))
+		for j, change := range entries[i].Changes {
+			if locationFields[change.Field] {
+				change.From, change.To = nil, nil
+			}
+			changes[j] = change
+		}
+		entries[i].Changes = changes
+	}
+	return entries
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"service/privacy"
+	"service/storage"
+	"testing"
+	"time"
+)
+
+func coordinate(v float64) *float64 {
+	return &v
+}
+
+func TestHandleItemByID_LocationPrivacy(t *testing.T) {
+	base, cleanup := createTestHandler(t)
+	defer cleanup()
+	handler := NewItemHandler(base.store, WithPrivacyPolicy(privacy.NewPolicy(sensitiveSpecies("Morel"))))
+
+	now := time.Now()
+	items := []models.Item{
+		{ID: "public", MushroomName: "Chanterelle", Location: "By the lake", Latitude: coordinate(52.5234), Longitude: coordinate(13.4171), Count: 1, DateTime: now, Owner: "user-1"},
+		{ID: "obscured", MushroomName: "Chanterelle", Location: "By the lake", Latitude: coordinate(52.5234), Longitude: coordinate(13.4171), Visibility: models.VisibilityObscured, Count: 1, DateTime: now, Owner: "user-1"},
+		{ID: "private", MushroomName: "Chanterelle", Location: "By the lake", Latitude: coordinate(52.5234), Longitude: coordinate(13.4171), Visibility: models.VisibilityPrivate, Count: 1, DateTime: now, Owner: "user-1"},
+		{ID: "sensitive", MushroomName: "Morel", Location: "By the lake", Latitude: coordinate(52.5234), Longitude: coordinate(13.4171), Count: 1, DateTime: now, Owner: "user-1"},
+	}
+	for _, item := range items {
+		if _, err := handler.store.Create(t.Context(), item); err != nil {
+			t.Fatalf("Failed to create test item: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		id           string
+		userID       string
+		role         string
+		wantLocation string
+		wantLat      *float64
+	}{
+		{"public to others", "public", "user-2", models.RoleUser, "By the lake", coordinate(52.5234)},
+		{"obscured to owner", "obscured", "user-1", models.RoleUser, "By the lake", coordinate(52.5234)},
+		{"obscured to admin", "obscured", "admin-1", models.RoleAdmin, "By the lake", coordinate(52.5234)},
+		{"obscured to others", "obscured", "user-2", models.RoleUser, privacy.RedactedLocation, coordinate(52.55)},
+		{"obscured to anonymous", "obscured", "", "", privacy.RedactedLocation, coordinate(52.55)},
+		{"obscured to moderator", "obscured", "mod-1", models.RoleModerator, privacy.RedactedLocation, coordinate(52.55)},
+		{"private to others", "private", "user-2", models.RoleUser, privacy.RedactedLocation, nil},
+		{"sensitive species to others", "sensitive", "user-2", models.RoleUser, privacy.RedactedLocation, coordinate(52.55)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/items/"+tt.id, nil)
+			if tt.userID != "" {
+				req = asUser(req, tt.userID, tt.role)
+			}
+			w := httptest.NewRecorder()
+			handler.HandleItemByID(w, req)
+
+			var got models.Item
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got.Location != tt.wantLocation {
+				t.Errorf("Expected location %q, got %q", tt.wantLocation, got.Location)
+			}
+			switch {
+			case tt.wantLat == nil && got.Latitude != nil:
+				t.Errorf("Expected no latitude, got %v", *got.Latitude)
+			case tt.wantLat != nil && (got.Latitude == nil || *got.Latitude-*tt.wantLat > 1e-9 || *tt.wantLat-*got.Latitude > 1e-9):
+				t.Errorf("Expected latitude %v, got %v", *tt.wantLat, got.Latitude)
+			}
+		})
+	}
+
+	// Listings are redacted the same way
+	req := asUser(httptest.NewRequest(http.MethodGet, "/items", nil), "user-2", models.RoleUser)
+	w := httptest.NewRecorder()
+	handler.HandleItems(w, req)
+	var list []models.Item
+	json.NewDecoder(w.Body).Decode(&list)
+	for _, item := range list {
+		if item.ID != "public" && item.Location != privacy.RedactedLocation {
+			t.Errorf("Expected %s to be redacted in listing, got %q", item.ID, item.Location)
+		}
+	}
+}
+
+// sensitiveSpecies marks species as obscured
+func sensitiveSpecies(species ...string) privacy.Option {
+	m := make(map[string]string)
+	for _, s := range species {
+		m[s] = models.VisibilityObscured
+	}
+	return privacy.WithSensitiveSpecies(m)
+}
+
+func TestHandleItemByID_HistoryHidesLocation(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	item := models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "By the lake", Count: 1, DateTime: now, Owner: "user-1"}
+	handler.store.Create(t.Context(), item)
+
+	// The owner moves the sighting and makes it private; the old public
+	// location must not leak through the history
+	item.Location = "Under the bridge"
+	item.Visibility = models.VisibilityPrivate
+	handler.store.Update(t.Context(), "test-1", item, nil)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/items/test-1/history", nil), "user-2", models.RoleUser)
+	w := httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+	if bytes.Contains(w.Body.Bytes(), []byte("lake")) || bytes.Contains(w.Body.Bytes(), []byte("bridge")) {
+		t.Errorf("Expected history to hide locations, got %s", w.Body.String())
+	}
+
+	var entries []storage.HistoryEntry
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 2 || len(entries[1].Changes) == 0 {
+		t.Fatalf("Expected two entries with changes, got %+v", entries)
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodGet, "/items/test-1/history/1", nil), "user-2", models.RoleUser)
+	w = httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+	if bytes.Contains(w.Body.Bytes(), []byte("lake")) {
+		t.Errorf("Expected revision to hide location, got %s", w.Body.String())
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodGet, "/items/test-1/history/1", nil), "user-1", models.RoleUser)
+	w = httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+	if !bytes.Contains(w.Body.Bytes(), []byte("lake")) {
+		t.Errorf("Expected owner to see the location, got %s", w.Body.String())
+	}
+}
+
+func TestHandleItems_POST_ValidatesCoordinates(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	tests := []struct {
+		name string
+		item models.Item
+	}{
+		{"latitude without longitude", models.Item{Latitude: coordinate(52)}},
+		{"latitude out of range", models.Item{Latitude: coordinate(91), Longitude: coordinate(13)}},
+		{"longitude out of range", models.Item{Latitude: coordinate(52), Longitude: coordinate(-181)}},
+		{"unknown visibility", models.Item{Visibility: "friends"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			item.MushroomName = "Chanterelle"
+			item.Location = "Forest"
+			item.Count = 1
+			item.DateTime = now
+			body, _ := json.Marshal(item)
+			req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.HandleItems(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service/problem"
+)
+
+// invalid replies with 400 listing the rules the request broke
+func invalid(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Write(w, r, problem.Validation(err))
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"service/logger"
+	"service/models"
+	"service/problem"
+	"service/storage"
+	"service/validation"
+)
+
+const (
+	// DefaultSyncLimit is the page size used when a pull does not set limit
+	DefaultSyncLimit = 500
+	// MaxSyncLimit caps the page size a client may request
+	MaxSyncLimit = 1000
+)
+
+// Sync upload operations
+const (
+	SyncOpUpsert = "upsert"
+	SyncOpDelete = "delete"
+)
+
+// Sync upload result statuses
+const (
+	SyncStatusApplied  = "applied"
+	SyncStatusConflict = "conflict"
+	SyncStatusRejected = "rejected"
+)
+
+// SyncPullResponse is returned by GET /sync
+type SyncPullResponse struct {
+	Changes []models.Item       `json:"changes"`
+	Deleted []storage.Tombstone `json:"deleted"`
+	Token   string              `json:"token"`
+	HasMore bool                `json:"hasMore"`
+}
+
+// SyncPushRequest is the body accepted by POST /sync
+type SyncPushRequest struct {
+	Changes []SyncChange `json:"changes"`
+}
+
+// SyncChange is a local change uploaded by a client. BaseRevision is the
+// revision of the server copy the change was made against, 0 for sightings
+// created offline.
+type SyncChange struct {
+	Op           string       `json:"op"`
+	ID           string       `json:"id,omitempty"`
+	BaseRevision int64        `json:"baseRevision"`
+	Item         *models.Item `json:"item,omitempty"`
+}
+
+// SyncChangeResult reports what happened to one uploaded change
+type SyncChangeResult struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Revision int64  `json:"revision,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Errors lists the fields that made a rejected change invalid
+	Errors        []problem.FieldError `json:"errors,omitempty"`
+	ServerItem    *models.Item         `json:"serverItem,omitempty"`
+	ServerDeleted *storage.Tombstone   `json:"serverDeleted,omitempty"`
+}
+
+// SyncPushResponse is returned by POST /sync
+type SyncPushResponse struct {
+	Results []SyncChangeResult `json:"results"`
+}
+
+// HandleSync handles GET (pull changes since a token) and POST (upload local
+// changes) requests for offline clients
+func (h *ItemHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.pullChanges(w, r)
+	case http.MethodPost:
+		h.pushChanges(w, r)
+	default:
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// pullChanges returns every creation, update and deletion after the revision
+// encoded in the token query parameter
+func (h *ItemHandler) pullChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := storage.ParseChangeToken(r.URL.Query().Get("token"))
+	if err != nil {
+		invalid(w, r, problem.Invalid("token", problem.CodeFormat, err.Error()))
+		return
+	}
+	// A token ahead of the store was issued against other data (for example
+	// before a restore); the client must start over with a full sync
+	if since > h.store.Revision() {
+		problem.Write(w, r, problem.Typed(problem.TypeChangeTokenExpired, http.StatusGone,
+			"Change token expired", "change token is no longer valid, full sync required"))
+		return
+	}
+
+	limit := DefaultSyncLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		code := problem.CodeFormat
+		switch {
+		case err == nil && n < 1:
+			code = problem.CodeMin
+		case err == nil && n > MaxSyncLimit:
+			code = problem.CodeMax
+		}
+		if err != nil || n < 1 || n > MaxSyncLimit {
+			invalid(w, r, problem.Invalid("limit", code, "limit must be between 1 and "+strconv.Itoa(MaxSyncLimit)))
+			return
+		}
+		limit = n
+	}
+
+	set := h.store.Changes(r.Context(), since, limit)
+	writeJSON(w, r, http.StatusOK, SyncPullResponse{
+		Changes: h.presentAll(r, set.Items),
+		Deleted: set.Tombstones,
+		Token:   storage.EncodeChangeToken(set.Revision),
+		HasMore: set.HasMore,
+	})
+}
+
+// pushChanges applies uploaded changes whose base revision still matches the
+// server. Conflicting changes are not applied; the server copy is returned
+// instead so the client can resolve the conflict and upload again. Deleting a
+// sighting that is already in the trash or purged is applied, reporting the
+// revision of the existing deletion.
+func (h *ItemHandler) pushChanges(w http.ResponseWriter, r *http.Request) {
+	var req SyncPushRequest
+	if err := h.decoder.decodeUpload(w, r, &req); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	if len(req.Changes) > MaxBatchOperations {
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, "too many changes")
+		return
+	}
+
+	resp := SyncPushResponse{Results: make([]SyncChangeResult, len(req.Changes))}
+	now := time.Now()
+	actor := requestActor(r)
+	guard := h.changeGuard(r)
+	var ops []storage.Op
+	var index []int
+	for i, change := range req.Changes {
+		res := &resp.Results[i]
+		res.Index = i
+
+		op, err := prepareSyncOp(validation.New().Index("changes", i), change, now)
+		res.ID = op.ID
+		if err != nil {
+			res.Status = SyncStatusRejected
+			res.Error = err.Error()
+			res.Errors = problem.FieldErrors(err)
+			continue
+		}
+		op.Actor = actor
+		op.Guard = guard
+		op.Item.Owner = requestOwner(r)
+		ops = append(ops, op)
+		index = append(index, i)
+	}
+
+	results, err := h.store.Batch(r.Context(), ops, false)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error applying sync changes", map[string]interface{}{
+			"error":        err.Error(),
+			"change_count": len(ops),
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	for j, result := range results {
+		res := &resp.Results[index[j]]
+		switch {
+		case result.Err == nil && ops[j].Type == storage.OpDelete:
+			res.Status = SyncStatusApplied
+			res.Revision = result.Tombstone.Revision
+		case result.Err == nil:
+			res.Status = SyncStatusApplied
+			res.Revision = result.Item.Revision
+		case ops[j].Type == storage.OpDelete && result.Tombstone != nil:
+			// Deleting something that is already deleted is neither a
+			// conflict nor an error, whatever revision it was based on
+			res.Status = SyncStatusApplied
+			res.Revision = result.Tombstone.Revision
+		case errors.Is(result.Err, storage.ErrConflict):
+			res.Status = SyncStatusConflict
+			res.Error = result.Err.Error()
+			if result.Tombstone != nil {
+				res.ServerDeleted = result.Tombstone
+			} else {
+				item := h.present(r, result.Item)
+				res.ServerItem = &item
+			}
+		default:
+			res.Status = SyncStatusRejected
+			res.Error = result.Err.Error()
+		}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// prepareSyncOp converts an uploaded change to a conditional store operation,
+// recording violations in v, which is located at the change within the request
+func prepareSyncOp(v *validation.Validator, change SyncChange, now time.Time) (storage.Op, error) {
+	base := change.BaseRevision
+	if !v.Min("baseRevision", float64(base), 0) {
+		return storage.Op{ID: change.ID}, v.Err()
+	}
+
+	var bo BatchOperation
+	switch change.Op {
+	case SyncOpUpsert:
+		if !v.Required("item", change.Item != nil) {
+			return storage.Op{ID: change.ID}, v.Err()
+		}
+		id := change.ID
+		if id == "" {
+			id = change.Item.ID
+		}
+		if !v.Required("id", id != "") {
+			return storage.Op{}, v.Err()
+		}
+		item := *change.Item
+		item.ID = id
+		bo = BatchOperation{Op: storage.OpUpdate, ID: id, Item: &item}
+		if base == 0 {
+			bo.Op = storage.OpCreate
+		}
+	case SyncOpDelete:
+		bo = BatchOperation{Op: storage.OpDelete, ID: change.ID}
+	default:
+		v.OneOf("op", change.Op, SyncOpUpsert, SyncOpDelete)
+		return storage.Op{ID: change.ID}, v.Err()
+	}
+
+	op, err := prepareBatchOp(v, bo, now)
+	if err != nil {
+		return op, err
+	}
+	op.IfRevision = &base
+	return op, nil
+}
+
+// writeJSON writes v as a JSON response to r with the given status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode response", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"service/logger"
+	"service/models"
+	"service/problem"
+	"service/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pull(t *testing.T, handler *ItemHandler, token string) SyncPullResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/sync?token="+token, nil)
+	w := httptest.NewRecorder()
+	handler.HandleSync(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp SyncPullResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func push(t *testing.T, handler *ItemHandler, changes []SyncChange) SyncPushResponse {
+	t.Helper()
+	body, _ := json.Marshal(SyncPushRequest{Changes: changes})
+	req := httptest.NewRequest(http.MethodPost, "/sync", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.HandleSync(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp SyncPushResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestHandleSync_PullIncremental(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now})
+
+	initial := pull(t, handler, "")
+	if len(initial.Changes) != 1 {
+		t.Fatalf("Expected 1 change in full sync, got %d", len(initial.Changes))
+	}
+
+	handler.store.Create(t.Context(), models.Item{ID: "test-2", MushroomName: "Morel", Location: "Woods", Count: 3, DateTime: now})
+	handler.store.Delete(t.Context(), "test-1")
+
+	next := pull(t, handler, initial.Token)
+	if len(next.Changes) != 1 || next.Changes[0].ID != "test-2" {
+		t.Errorf("Expected only test-2 to have changed, got %v", next.Changes)
+	}
+	if len(next.Deleted) != 1 || next.Deleted[0].ID != "test-1" {
+		t.Errorf("Expected tombstone for test-1, got %v", next.Deleted)
+	}
+
+	empty := pull(t, handler, next.Token)
+	if len(empty.Changes) != 0 || len(empty.Deleted) != 0 {
+		t.Errorf("Expected no changes, got %v and %v", empty.Changes, empty.Deleted)
+	}
+}
+
+func TestHandleSync_PullInvalidToken(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+		typ      string
+		field    string
+	}{
+		{"malformed token", "token=garbage", http.StatusBadRequest, problem.TypeValidation, "token"},
+		{"future token", "token=" + storage.EncodeChangeToken(99), http.StatusGone, problem.TypeChangeTokenExpired, ""},
+		{"invalid limit", "limit=0", http.StatusBadRequest, problem.TypeValidation, "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/sync?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			handler.HandleSync(w, req)
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			p := decodeProblem(t, w)
+			if p.Type != tt.typ || (tt.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.field)) {
+				t.Errorf("Expected a %s problem on %q, got %+v", tt.typ, tt.field, p)
+			}
+		})
+	}
+}
+
+func TestHandleSync_PushWithConflict(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	server, _ := handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now})
+	base := server.Revision
+	server.Count = 8
+	handler.store.Update(t.Context(), "test-1", server, nil)
+
+	resp := push(t, handler, []SyncChange{
+		{Op: SyncOpUpsert, ID: "offline-1", Item: &models.Item{MushroomName: "Morel", Location: "Woods", Count: 2, DateTime: now}},
+		{Op: SyncOpUpsert, ID: "test-1", BaseRevision: base, Item: &models.Item{MushroomName: "Chanterelle", Location: "Forest", Count: 6, DateTime: now}},
+		{Op: SyncOpDelete, ID: "never-existed"},
+		{Op: "rename", ID: "test-1"},
+	})
+
+	expected := []string{SyncStatusApplied, SyncStatusConflict, SyncStatusRejected, SyncStatusRejected}
+	for i, status := range expected {
+		if resp.Results[i].Status != status {
+			t.Errorf("Result %d: expected status %s, got %s", i, status, resp.Results[i].Status)
+		}
+	}
+	if errs := resp.Results[3].Errors; len(errs) != 1 || errs[0].Field != "/changes/3/op" || errs[0].Code != problem.CodeFormat {
+		t.Errorf("Expected a format error on /changes/3/op, got %+v", errs)
+	}
+	if resp.Results[0].Revision == 0 {
+		t.Error("Expected applied change to report its revision")
+	}
+	if resp.Results[1].ServerItem == nil || resp.Results[1].ServerItem.Count != 8 {
+		t.Errorf("Expected server copy with count 8, got %v", resp.Results[1].ServerItem)
+	}
+
+	current, _ := handler.store.Get(t.Context(), "test-1")
+	if current.Count != 8 {
+		t.Errorf("Expected server version to win, got count %d", current.Count)
+	}
+}
+
+func TestHandleSync_PushDelete(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	server, _ := handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now})
+
+	for i := 0; i < 2; i++ {
+		resp := push(t, handler, []SyncChange{{Op: SyncOpDelete, ID: "test-1", BaseRevision: server.Revision}})
+		if resp.Results[0].Status != SyncStatusApplied {
+			t.Errorf("Attempt %d: expected delete to be applied, got %s", i, resp.Results[0].Status)
+		}
+	}
+
+	if _, err := handler.store.Get(t.Context(), "test-1"); err != storage.ErrNotFound {
+		t.Errorf("Expected item to be deleted, got %v", err)
+	}
+}
+
+func TestHandleSync_PushDeleteAlreadyDeleted(t *testing.T) {
+	tests := []struct {
+		name  string
+		purge bool
+		stale bool
+	}{
+		{"trashed, current base", false, false},
+		{"trashed, stale base", false, true},
+		{"purged, current base", true, false},
+		{"purged, stale base", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := createTestHandler(t)
+			defer cleanup()
+
+			created, _ := handler.store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: time.Now()})
+			handler.store.Delete(t.Context(), "test-1")
+			if tt.purge {
+				handler.store.Purge(t.Context(), "test-1")
+			}
+			deleted := handler.store.Changes(t.Context(), 0, 10).Tombstones[0]
+			base := deleted.Revision
+			if tt.stale {
+				base = created.Revision
+			}
+
+			resp := push(t, handler, []SyncChange{{Op: SyncOpDelete, ID: "test-1", BaseRevision: base}})
+			if res := resp.Results[0]; res.Status != SyncStatusApplied || res.Revision != deleted.Revision {
+				t.Errorf("Expected the delete to be applied at revision %d, got %+v", deleted.Revision, res)
+			}
+			if set := handler.store.Changes(t.Context(), 0, 10); len(set.Tombstones) != 1 || set.Tombstones[0].Revision != deleted.Revision {
+				t.Errorf("Expected the deletion to be left alone, got %+v", set.Tombstones)
+			}
+		})
+	}
+}
+
+func TestWriteJSON_EncodeErrorLoggedWithRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	defer logger.SetOutput(os.Stdout)
+
+	req := httptest.NewRequest(http.MethodGet, "/sync", nil)
+	req = req.WithContext(logger.WithTrace(req.Context(), logger.Trace{RequestID: "req-1"}))
+	writeJSON(httptest.NewRecorder(), req, http.StatusOK, map[string]interface{}{"fn": func() {}})
+
+	if !strings.Contains(buf.String(), `"message":"Failed to encode response"`) || !strings.Contains(buf.String(), `"requestId":"req-1"`) {
+		t.Errorf("Expected the failure to be logged with the request ID, got %s", buf.String())
+	}
+}
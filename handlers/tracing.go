@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service/models"
+	"service/tracing"
+)
+
+// validateSightingTraced runs validateSighting in a span of its own
+func validateSightingTraced(r *http.Request, item *models.Item) error {
+	_, span := tracing.Start(r.Context(), "validate")
+	defer span.End()
+	return validateSighting(item)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"service/auth"
+	"service/logger"
+	"service/models"
+	"service/problem"
+	"service/storage"
+)
+
+// HandleTrash handles GET (list deleted items) and DELETE (purge all deleted
+// items, admin only) requests for the trash
+func (h *ItemHandler) HandleTrash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getTrash(w, r)
+	case http.MethodDelete:
+		if !authorizeAdmin(w, r) {
+			return
+		}
+		h.emptyTrash(w, r)
+	default:
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// HandleTrashItem handles DELETE requests that permanently purge a single
+// item from the trash (admin only)
+func (h *ItemHandler) HandleTrashItem(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/trash/")
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "Item ID required")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		problem.MethodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	if err := h.store.Purge(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Error(w, r, http.StatusNotFound, "Item not found in trash")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error purging item", map[string]interface{}{
+			"error":   err.Error(),
+			"item_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getTrash lists the deleted items the requester could restore
+func (h *ItemHandler) getTrash(w http.ResponseWriter, r *http.Request) {
+	p := auth.FromContext(r.Context())
+	items := make([]models.Item, 0)
+	for _, item := range h.store.GetTrash() {
+		if h.canModify(p, item) {
+			items = append(items, h.present(r, item))
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, items)
+}
+
+// restoreItem takes an item out of the trash
+func (h *ItemHandler) restoreItem(w http.ResponseWriter, r *http.Request, id string) {
+	item, err := h.store.Restore(r.Context(), id, requestActor(r), h.changeGuard(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "Item not found in trash")
+			return
+		case errors.Is(err, storage.ErrForbidden):
+			problem.Error(w, r, http.StatusForbidden, "")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error restoring item", map[string]interface{}{
+			"error":   err.Error(),
+			"item_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, h.present(r, item))
+}
+
+// emptyTrash permanently purges every deleted item
+func (h *ItemHandler) emptyTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := h.store.PurgeDeletedBefore(r.Context(), time.Now())
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error emptying trash", map[string]interface{}{
+			"error":  err.Error(),
+			"purged": purged,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]int{"purged": purged})
+}
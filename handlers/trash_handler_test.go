@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service/models"
+	"testing"
+	"time"
+)
+
+func createTrashedItem(t *testing.T, handler *ItemHandler, id string) {
+	t.Helper()
+	item := models.Item{ID: id, MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: time.Now()}
+	if _, err := handler.store.Create(t.Context(), item); err != nil {
+		t.Fatalf("Failed to create test item: %v", err)
+	}
+	if err := handler.store.Delete(t.Context(), id); err != nil {
+		t.Fatalf("Failed to delete test item: %v", err)
+	}
+}
+
+func TestHandleTrash_GET(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	createTrashedItem(t, handler, "test-1")
+
+	req := httptest.NewRequest(http.MethodGet, "/trash", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleTrash(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var trash []models.Item
+	if err := json.NewDecoder(w.Body).Decode(&trash); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(trash) != 1 || trash[0].DeletedAt == nil {
+		t.Errorf("Expected one deleted item, got %v", trash)
+	}
+}
+
+func TestHandleTrash_DELETE(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	createTrashedItem(t, handler, "test-1")
+	createTrashedItem(t, handler, "test-2")
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/trash", nil), "admin-1", models.RoleAdmin)
+	w := httptest.NewRecorder()
+
+	handler.HandleTrash(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(handler.store.GetTrash()) != 0 {
+		t.Error("Expected trash to be empty")
+	}
+}
+
+func TestHandleTrashItem_DELETE(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	createTrashedItem(t, handler, "test-1")
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/trash/test-1", nil), "admin-1", models.RoleAdmin)
+	w := httptest.NewRecorder()
+
+	handler.HandleTrashItem(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodDelete, "/trash/test-1", nil), "admin-1", models.RoleAdmin)
+	w = httptest.NewRecorder()
+
+	handler.HandleTrashItem(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleTrash_PurgeRequiresAdmin(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	createTrashedItem(t, handler, "test-1")
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/trash/test-1", nil), "user-1", models.RoleUser)
+	w := httptest.NewRecorder()
+	handler.HandleTrashItem(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/trash", nil)
+	w = httptest.NewRecorder()
+	handler.HandleTrash(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleItemByID_Restore(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	createTrashedItem(t, handler, "test-1")
+
+	req := httptest.NewRequest(http.MethodGet, "/items/test-1", nil)
+	w := httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted item to be hidden, got status %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/items/test-1/restore", nil)
+	w = httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if _, err := handler.store.Get(t.Context(), "test-1"); err != nil {
+		t.Errorf("Expected restored item to be readable, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/items/test-1/restore", nil)
+	w = httptest.NewRecorder()
+	handler.HandleItemByID(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d restoring an active item, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleItemByID_RestoreInvalid(t *testing.T) {
+	handler, cleanup := createTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{"wrong method", http.MethodGet, "/items/test-1/restore", http.StatusMethodNotAllowed},
+		{"unknown action", http.MethodPost, "/items/test-1/archive", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			handler.HandleItemByID(w, req)
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
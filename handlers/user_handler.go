@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"service/auth"
+	"service/logger"
+	"service/models"
+	"service/problem"
+	"service/storage"
+	"service/validation"
+
+	"github.com/google/uuid"
+)
+
+type UserHandler struct {
+	store   *storage.Store
+	decoder Decoder
+}
+
+func NewUserHandler(store *storage.Store, decoder Decoder) *UserHandler {
+	return &UserHandler{store: store, decoder: decoder}
+}
+
+// HandleUsers handles POST (create) and GET (list all) requests; both are
+// admin only
+func (h *UserHandler) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.createUser(w, r)
+	case http.MethodGet:
+		writeJSON(w, r, http.StatusOK, h.store.GetUsers())
+	default:
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandleUserByID handles GET (read) and PUT (update) requests for specific
+// users. /users/me refers to the authenticated user. Users may read and
+// update their own account but only admins can change roles.
+func (h *UserHandler) HandleUserByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/users/")
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "User ID required")
+		return
+	}
+
+	p := auth.FromContext(r.Context())
+	if id == "me" {
+		if p == nil {
+			problem.Error(w, r, http.StatusUnauthorized, "")
+			return
+		}
+		id = p.UserID
+	}
+	if !p.IsAdmin() && (p == nil || p.UserID != id) {
+		problem.Error(w, r, http.StatusForbidden, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getUser(w, r, id)
+	case http.MethodPut:
+		h.updateUser(w, r, id)
+	default:
+		problem.MethodNotAllowed(w, r, http.MethodGet, http.MethodPut)
+	}
+}
+
+// validateUser reports every rule a user breaks
+func validateUser(user *models.User) error {
+	v := validation.New()
+	v.Required("name", user.Name != "")
+	v.Check(strings.Contains(user.Email, "@"), "email", problem.CodeFormat, "email must be a valid email address")
+	v.OneOf("role", user.Role, models.RoleUser, models.RoleModerator, models.RoleAdmin)
+	return v.Err()
+}
+
+// createUser creates a new user
+func (h *UserHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+
+	if err := h.decoder.decodeJSON(w, r, &user); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if err := validateUser(&user); err != nil {
+		invalid(w, r, err)
+		return
+	}
+
+	user.ID = uuid.New().String()
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	created, err := h.store.CreateUser(user)
+	if err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			problem.Write(w, r, problem.Typed(problem.TypeAlreadyExists, http.StatusConflict, "Already exists", "User with this email already exists"))
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error creating user", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+// getUser retrieves a specific user by ID
+func (h *UserHandler) getUser(w http.ResponseWriter, r *http.Request, id string) {
+	user, err := h.store.GetUser(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Error(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error getting user", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, user)
+}
+
+// updateUser updates an existing user
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, id string) {
+	var user models.User
+
+	if err := h.decoder.decodeJSON(w, r, &user); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+
+	current, err := h.store.GetUser(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Error(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.ErrorContext(r.Context(), "Error getting user", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": id,
+		})
+		problem.Error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	if user.Role == "" {
+		user.Role = current.Role
+	}
+	if user.Role != current.Role && !auth.FromContext(r.Context()).IsAdmin() {
+		problem.Error(w, r, http.StatusForbidden, "Only admins can change roles")
+		return
+	}
+	if err := validateUser(&user); err != nil {
+		invalid(w, r, err)
+		return
+	}
+
+	user.UpdatedAt = time.Now()
+	updated, err := h.store.UpdateUser(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			problem.Error(w, r, http.StatusNotFound, "User not found")
+		case errors.Is(err, storage.ErrAlreadyExists):
+			problem.Write(w, r, problem.Typed(problem.TypeAlreadyExists, http.StatusConflict, "Already exists", "User with this email already exists"))
+		default:
+			logger.ErrorContext(r.Context(), "Error updating user", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": id,
+			})
+			problem.Error(w, r, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, updated)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"service/models"
+	"service/storage"
+	"testing"
+	"time"
+)
+
+func createTestUserHandler(t *testing.T) (*UserHandler, func()) {
+	os.Remove("data.json")
+
+	store := storage.NewStore()
+	handler := NewUserHandler(store, Decoder{})
+
+	cleanup := func() {
+		os.Remove("data.json")
+	}
+
+	return handler, cleanup
+}
+
+func TestHandleUsers_POST(t *testing.T) {
+	handler, cleanup := createTestUserHandler(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(models.User{Name: "Alice", Email: "alice@example.com"})
+	req := asUser(httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body)), "admin-1", models.RoleAdmin)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandleUsers(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var created models.User
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.ID == "" || created.Role != models.RoleUser {
+		t.Errorf("Expected generated ID and default role, got %+v", created)
+	}
+
+	req = asUser(httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body)), "admin-1", models.RoleAdmin)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.HandleUsers(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for duplicate email, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestHandleUsers_Validation(t *testing.T) {
+	handler, cleanup := createTestUserHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		user models.User
+	}{
+		{"missing name", models.User{Email: "alice@example.com"}},
+		{"invalid email", models.User{Name: "Alice", Email: "alice"}},
+		{"unknown role", models.User{Name: "Alice", Email: "alice@example.com", Role: "superuser"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.user)
+			req := asUser(httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body)), "admin-1", models.RoleAdmin)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.HandleUsers(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleUsers_RequiresAdmin(t *testing.T) {
+	handler, cleanup := createTestUserHandler(t)
+	defer cleanup()
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/users", nil), "user-1", models.RoleUser)
+	w := httptest.NewRecorder()
+	handler.HandleUsers(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHandleUserByID(t *testing.T) {
+	handler, cleanup := createTestUserHandler(t)
+	defer cleanup()
+
+	now := time.Now()
+	handler.store.CreateUser(models.User{ID: "user-1", Name: "Alice", Email: "alice@example.com", Role: models.RoleUser, CreatedAt: now})
+	handler.store.CreateUser(models.User{ID: "user-2", Name: "Bob", Email: "bob@example.com", Role: models.RoleUser, CreatedAt: now})
+
+	promote, _ := json.Marshal(models.User{Name: "Alice", Email: "alice@example.com", Role: models.RoleAdmin})
+	rename, _ := json.Marshal(models.User{Name: "Alice B", Email: "alice@example.com"})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     []byte
+		userID   string
+		role     string
+		expected int
+	}{
+		{"read self", http.MethodGet, "/users/user-1", nil, "user-1", models.RoleUser, http.StatusOK},
+		{"read me", http.MethodGet, "/users/me", nil, "user-1", models.RoleUser, http.StatusOK},
+		{"read me anonymously", http.MethodGet, "/users/me", nil, "", "", http.StatusUnauthorized},
+		{"read other", http.MethodGet, "/users/user-2", nil, "user-1", models.RoleUser, http.StatusForbidden},
+		{"admin reads other", http.MethodGet, "/users/user-2", nil, "admin-1", models.RoleAdmin, http.StatusOK},
+		{"admin reads missing", http.MethodGet, "/users/missing", nil, "admin-1", models.RoleAdmin, http.StatusNotFound},
+		{"rename self", http.MethodPut, "/users/user-1", rename, "user-1", models.RoleUser, http.StatusOK},
+		{"promote self", http.MethodPut, "/users/user-1", promote, "user-1", models.RoleUser, http.StatusForbidden},
+		{"admin promotes", http.MethodPut, "/users/user-1", promote, "admin-1", models.RoleAdmin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBuffer(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.userID != "" {
+				req = asUser(req, tt.userID, tt.role)
+			}
+			w := httptest.NewRecorder()
+			handler.HandleUserByID(w, req)
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
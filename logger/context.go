@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"context"
+	"os"
+)
+
+// Trace identifies the request an entry was logged during, so that entries
+// can be correlated with each other and with the request's trace
+type Trace struct {
+	RequestID string
+	// TraceID and SpanID are the W3C trace context IDs in lowercase hex;
+	// ParentSpanID is the caller's span, if the trace was continued
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Sampled      bool
+}
+
+type contextKey struct{}
+
+// WithTrace returns a copy of ctx carrying t
+func WithTrace(ctx context.Context, t Trace) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// TraceFromContext returns the trace carried by ctx, if any
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	t, ok := ctx.Value(contextKey{}).(Trace)
+	return t, ok
+}
+
+// addTrace fills in the request ID and Cloud Logging trace fields of entry
+// from ctx
+func addTrace(ctx context.Context, entry *LogEntry) {
+	t, ok := TraceFromContext(ctx)
+	if !ok {
+		return
+	}
+	entry.RequestID = t.RequestID
+	if t.TraceID != "" {
+		entry.Trace = traceName(t.TraceID)
+		entry.SpanID = t.SpanID
+		entry.TraceSampled = t.Sampled
+	}
+}
+
+// traceName returns the resource name Cloud Logging links to Cloud Trace,
+// or the bare trace ID when the project is unknown
+func traceName(traceID string) string {
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		return "projects/" + project + "/traces/" + traceID
+	}
+	return traceID
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying l, such as a child logger with
+// fields bound for one request
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
+
+// DebugContext logs a debug message with the logger and trace carried by ctx
+func DebugContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	FromContext(ctx).DebugContext(ctx, message, metadata)
+}
+
+// InfoContext logs an info message with the logger and trace carried by ctx
+func InfoContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	FromContext(ctx).InfoContext(ctx, message, metadata)
+}
+
+// WarningContext logs a warning message with the logger and trace carried by
+// ctx
+func WarningContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	FromContext(ctx).WarningContext(ctx, message, metadata)
+}
+
+// ErrorContext logs an error message with the logger and trace carried by ctx
+func ErrorContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	FromContext(ctx).ErrorContext(ctx, message, metadata)
+}
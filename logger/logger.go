@@ -1,9 +1,12 @@
 package logger
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +19,24 @@ const (
 	SeverityFatal   = "FATAL"
 )
 
+// severityRank orders severities from least to most severe
+var severityRank = map[string]int32{
+	SeverityDebug:   0,
+	SeverityInfo:    1,
+	SeverityWarning: 2,
+	SeverityError:   3,
+	SeverityFatal:   4,
+}
+
+// ParseLevel returns the severity named by level, in any case
+func ParseLevel(level string) (string, error) {
+	severity := strings.ToUpper(strings.TrimSpace(level))
+	if _, ok := severityRank[severity]; !ok {
+		return "", fmt.Errorf("unknown log level %q", level)
+	}
+	return severity, nil
+}
+
 // LogEntry represents a structured log entry
 type LogEntry struct {
 	Timestamp string                 `json:"timestamp"`
@@ -23,25 +44,81 @@ type LogEntry struct {
 	Message   string                 `json:"message"`
 	Service   string                 `json:"service"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	// HTTPRequest is shown by Cloud Logging as the request the entry is about
+	HTTPRequest *HTTPRequest `json:"httpRequest,omitempty"`
+	// RequestID and the trace fields tie the entry to the request it was
+	// logged during; Cloud Logging groups entries by trace
+	RequestID    string `json:"requestId,omitempty"`
+	Trace        string `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID       string `json:"logging.googleapis.com/spanId,omitempty"`
+	TraceSampled bool   `json:"logging.googleapis.com/trace_sampled,omitempty"`
 }
 
-// logStructured writes a structured log entry to stdout
-func logStructured(severity, message string, metadata map[string]interface{}) {
-	entry := LogEntry{
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Severity:  severity,
-		Message:   message,
-		Service:   getServiceName(),
-		Metadata:  metadata,
+// HTTPRequest is the Cloud Logging httpRequest object. Sizes are strings and
+// latency is a duration such as "0.123s", as in the Cloud Logging JSON format.
+type HTTPRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	RequestSize   string `json:"requestSize,omitempty"`
+	Status        int    `json:"status"`
+	ResponseSize  string `json:"responseSize,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Latency       string `json:"latency"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// Logger writes entries at or above its minimum level to its sinks. Child
+// loggers made with With share the level and sinks of their parent.
+type Logger struct {
+	minRank  *atomic.Int32
+	sinks    []Sink
+	redactor *Redactor
+	service  string
+	fields   map[string]interface{}
+}
+
+// Option configures a Logger
+type Option func(*Logger)
+
+// WithSinks sets where entries are written; the default is JSON on stdout
+func WithSinks(sinks ...Sink) Option {
+	return func(l *Logger) {
+		l.sinks = sinks
 	}
+}
 
-	jsonEntry, err := json.Marshal(entry)
-	if err != nil {
-		// Fallback to standard logging if JSON marshaling fails
-		log.Printf("Failed to marshal log entry: %v", err)
-		return
+// WithRedactor sets how secrets and personal data are masked before entries
+// reach the sinks; nil turns masking off
+func WithRedactor(r *Redactor) Option {
+	return func(l *Logger) {
+		l.redactor = r
+	}
+}
+
+// WithService sets the service name of entries, which defaults to the Cloud
+// Run service name
+func WithService(name string) Option {
+	return func(l *Logger) {
+		l.service = name
 	}
-	log.Println(string(jsonEntry))
+}
+
+// New returns a logger writing entries at INFO and above, masked by the
+// default redactor
+func New(opts ...Option) *Logger {
+	l := &Logger{
+		minRank:  new(atomic.Int32),
+		sinks:    []Sink{NewJSONSink(os.Stdout)},
+		redactor: NewRedactor(),
+		service:  getServiceName(),
+	}
+	l.minRank.Store(severityRank[SeverityInfo])
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // getServiceName returns the service name from environment or a default
@@ -57,28 +134,183 @@ func getServiceName() string {
 	return "shroomp-service"
 }
 
+// SetLevel drops entries less severe than level, such as "info", for l and
+// every logger sharing its level
+func (l *Logger) SetLevel(level string) error {
+	severity, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.minRank.Store(severityRank[severity])
+	return nil
+}
+
+// Enabled reports whether entries of severity are written
+func (l *Logger) Enabled(severity string) bool {
+	return severityRank[severity] >= l.minRank.Load()
+}
+
+// With returns a child logger adding fields to the metadata of every entry;
+// metadata passed when logging takes precedence
+func (l *Logger) With(fields map[string]interface{}) *Logger {
+	child := *l
+	child.fields = make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		child.fields[k] = v
+	}
+	for k, v := range fields {
+		child.fields[k] = v
+	}
+	return &child
+}
+
+// log writes an entry, unless it is below the minimum level, with the trace
+// carried by ctx
+func (l *Logger) log(ctx context.Context, at time.Time, severity, message string, httpRequest *HTTPRequest, metadata map[string]interface{}) {
+	if !l.Enabled(severity) {
+		return
+	}
+	entry := LogEntry{
+		Timestamp:   at.UTC().Format(time.RFC3339Nano),
+		Severity:    severity,
+		Message:     message,
+		Service:     l.service,
+		Metadata:    l.metadata(metadata),
+		HTTPRequest: httpRequest,
+	}
+	if ctx != nil {
+		addTrace(ctx, &entry)
+	}
+	if l.redactor != nil {
+		l.redactor.Redact(&entry)
+	}
+	for _, sink := range l.sinks {
+		sink.Write(&entry)
+	}
+}
+
+// metadata merges the bound fields with those of one entry
+func (l *Logger) metadata(metadata map[string]interface{}) map[string]interface{} {
+	if len(l.fields) == 0 {
+		return metadata
+	}
+	merged := make(map[string]interface{}, len(l.fields)+len(metadata))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(message string, metadata map[string]interface{}) {
+	l.log(nil, time.Now(), SeverityDebug, message, nil, metadata)
+}
+
+// Info logs an info message
+func (l *Logger) Info(message string, metadata map[string]interface{}) {
+	l.log(nil, time.Now(), SeverityInfo, message, nil, metadata)
+}
+
+// Warning logs a warning message
+func (l *Logger) Warning(message string, metadata map[string]interface{}) {
+	l.log(nil, time.Now(), SeverityWarning, message, nil, metadata)
+}
+
+// Error logs an error message
+func (l *Logger) Error(message string, metadata map[string]interface{}) {
+	l.log(nil, time.Now(), SeverityError, message, nil, metadata)
+}
+
+// Fatal logs a fatal message and exits
+func (l *Logger) Fatal(message string, metadata map[string]interface{}) {
+	l.log(nil, time.Now(), SeverityFatal, message, nil, metadata)
+	os.Exit(1)
+}
+
+// DebugContext logs a debug message with the trace carried by ctx
+func (l *Logger) DebugContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	l.log(ctx, time.Now(), SeverityDebug, message, nil, metadata)
+}
+
+// InfoContext logs an info message with the trace carried by ctx
+func (l *Logger) InfoContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	l.log(ctx, time.Now(), SeverityInfo, message, nil, metadata)
+}
+
+// WarningContext logs a warning message with the trace carried by ctx
+func (l *Logger) WarningContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	l.log(ctx, time.Now(), SeverityWarning, message, nil, metadata)
+}
+
+// ErrorContext logs an error message with the trace carried by ctx
+func (l *Logger) ErrorContext(ctx context.Context, message string, metadata map[string]interface{}) {
+	l.log(ctx, time.Now(), SeverityError, message, nil, metadata)
+}
+
+// Request logs an entry about an HTTP request, such as an access log entry,
+// with the trace carried by ctx
+func (l *Logger) Request(ctx context.Context, severity, message string, httpRequest *HTTPRequest, metadata map[string]interface{}) {
+	l.log(ctx, time.Now(), severity, message, httpRequest, metadata)
+}
+
+// defaultLogger is used by the package-level functions
+var defaultLogger atomic.Pointer[Logger]
+
+func init() {
+	defaultLogger.Store(New())
+}
+
+// Default returns the logger used by the package-level functions
+func Default() *Logger {
+	return defaultLogger.Load()
+}
+
+// SetDefault makes l the logger used by the package-level functions
+func SetDefault(l *Logger) {
+	defaultLogger.Store(l)
+}
+
+// SetLevel drops entries of the default logger less severe than level
+func SetLevel(level string) error {
+	return Default().SetLevel(level)
+}
+
+// SetOutput sends entries of the default logger to w as JSON instead
+func SetOutput(w io.Writer) {
+	l := *Default()
+	l.sinks = []Sink{NewJSONSink(w)}
+	SetDefault(&l)
+}
+
 // Debug logs a debug message
 func Debug(message string, metadata map[string]interface{}) {
-	logStructured(SeverityDebug, message, metadata)
+	Default().Debug(message, metadata)
 }
 
 // Info logs an info message
 func Info(message string, metadata map[string]interface{}) {
-	logStructured(SeverityInfo, message, metadata)
+	Default().Info(message, metadata)
 }
 
 // Warning logs a warning message
 func Warning(message string, metadata map[string]interface{}) {
-	logStructured(SeverityWarning, message, metadata)
+	Default().Warning(message, metadata)
 }
 
 // Error logs an error message
 func Error(message string, metadata map[string]interface{}) {
-	logStructured(SeverityError, message, metadata)
+	Default().Error(message, metadata)
+}
+
+// Request logs an entry about an HTTP request with the logger carried by ctx
+func Request(ctx context.Context, severity, message string, httpRequest *HTTPRequest, metadata map[string]interface{}) {
+	FromContext(ctx).Request(ctx, severity, message, httpRequest, metadata)
 }
 
 // Fatal logs a fatal message and exits
 func Fatal(message string, metadata map[string]interface{}) {
-	logStructured(SeverityFatal, message, metadata)
-	os.Exit(1)
+	Default().Fatal(message, metadata)
 }
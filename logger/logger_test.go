@@ -0,0 +1,210 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memorySink keeps entries for inspection
+type memorySink struct {
+	entries []LogEntry
+}
+
+func (s *memorySink) Write(entry *LogEntry) {
+	s.entries = append(s.entries, *entry)
+}
+
+func TestLogger_Level(t *testing.T) {
+	sink := &memorySink{}
+	l := New(WithSinks(sink))
+	child := l.With(map[string]interface{}{"component": "sync"})
+
+	l.Debug("hidden", nil)
+	l.Info("shown", nil)
+	if err := l.SetLevel("warning"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	child.Info("hidden by the parent's level", nil)
+	child.Warning("shown", nil)
+	if err := l.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	l.Debug("shown", nil)
+
+	if len(sink.entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %+v", sink.entries)
+	}
+	for _, entry := range sink.entries {
+		if entry.Message != "shown" {
+			t.Errorf("Unexpected entry %q", entry.Message)
+		}
+	}
+	if err := l.SetLevel("loud"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestLogger_With(t *testing.T) {
+	sink := &memorySink{}
+	l := New(WithSinks(sink), WithService("test"))
+	child := l.With(map[string]interface{}{"component": "sync", "attempt": 1})
+	grandchild := child.With(map[string]interface{}{"attempt": 2})
+
+	grandchild.Info("retrying", map[string]interface{}{"item_id": "abc"})
+	child.Info("override", map[string]interface{}{"component": "batch"})
+	l.Info("plain", nil)
+
+	want := []map[string]interface{}{
+		{"component": "sync", "attempt": 2, "item_id": "abc"},
+		{"component": "batch", "attempt": 1},
+		nil,
+	}
+	for i, entry := range sink.entries {
+		if entry.Service != "test" {
+			t.Errorf("Expected service test, got %q", entry.Service)
+		}
+		if len(entry.Metadata) != len(want[i]) {
+			t.Errorf("%s: expected %v, got %v", entry.Message, want[i], entry.Metadata)
+			continue
+		}
+		for k, v := range want[i] {
+			if entry.Metadata[k] != v {
+				t.Errorf("%s: expected %s=%v, got %v", entry.Message, k, v, entry.Metadata[k])
+			}
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "shroomp")
+	sink := &memorySink{}
+	l := New(WithSinks(sink)).With(map[string]interface{}{"user_id": "u1"})
+
+	ctx := WithTrace(context.Background(), Trace{RequestID: "req-1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true})
+	ctx = NewContext(ctx, l)
+	ErrorContext(ctx, "failed", nil)
+
+	if FromContext(context.Background()) != Default() {
+		t.Error("Expected the default logger without one in the context")
+	}
+	if len(sink.entries) != 1 {
+		t.Fatalf("Expected the entry in the context's logger, got %d", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	if entry.RequestID != "req-1" || entry.Trace != "projects/shroomp/traces/4bf92f3577b34da6a3ce929d0e0e4736" || entry.SpanID != "00f067aa0ba902b7" || !entry.TraceSampled {
+		t.Errorf("Expected trace fields, got %+v", entry)
+	}
+	if entry.Metadata["user_id"] != "u1" {
+		t.Errorf("Expected bound fields, got %v", entry.Metadata)
+	}
+}
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithSinks(NewJSONSink(&buf)))
+	l.Info("ok", map[string]interface{}{"count": 2})
+	l.Info("unmarshalable", map[string]interface{}{"fn": func() {}})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", buf.String())
+	}
+	for _, line := range lines {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected a bare JSON line, got %q", line)
+		}
+		if entry.Timestamp == "" || entry.Severity != SeverityInfo {
+			t.Errorf("Unexpected entry %+v", entry)
+		}
+	}
+	if !strings.Contains(lines[1], `"message":"unmarshalable"`) || !strings.Contains(lines[1], "marshal_error") {
+		t.Errorf("Expected the message kept when metadata cannot be marshalled, got %s", lines[1])
+	}
+}
+
+func TestTextSink(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithSinks(NewTextSink(&buf)))
+	ctx := WithTrace(context.Background(), Trace{RequestID: "req-1"})
+	l.WarningContext(ctx, "Slow save", map[string]interface{}{
+		"path":  "/data/my data.json",
+		"items": 3,
+		"error": errors.New("disk full"),
+	})
+
+	line := buf.String()
+	for _, want := range []string{"WARNING Slow save", `error="disk full"`, "items=3", `path="/data/my data.json"`, "request_id=req-1"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected %q in %q", want, line)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	New(WithSinks(sink)).Info("first", nil)
+	sink.Close()
+
+	// Reopening appends
+	sink, err = NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	New(WithSinks(sink)).Info("second", nil)
+	sink.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("Expected 2 lines, got %q", data)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	sink := &memorySink{}
+	l := New(WithSinks(sink))
+	log := slog.New(l.Handler()).With("component", "jwks").WithGroup("refresh")
+
+	ctx := WithTrace(context.Background(), Trace{RequestID: "req-1"})
+	log.DebugContext(ctx, "hidden")
+	log.WarnContext(ctx, "Refresh failed", "attempt", 2, "backoff", 5*time.Second, slog.Group("http", "status", 503), "error", errors.New("timeout"))
+	log.Log(ctx, slog.LevelError+2, "critical")
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", sink.entries)
+	}
+	entry := sink.entries[0]
+	if entry.Severity != SeverityWarning || entry.Message != "Refresh failed" || entry.RequestID != "req-1" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	want := map[string]interface{}{
+		"component":           "jwks",
+		"refresh.attempt":     int64(2),
+		"refresh.backoff":     "5s",
+		"refresh.http.status": int64(503),
+		"refresh.error":       "timeout",
+	}
+	for k, v := range want {
+		if entry.Metadata[k] != v {
+			t.Errorf("Expected %s=%v, got %v (%T)", k, v, entry.Metadata[k], entry.Metadata[k])
+		}
+	}
+	if sink.entries[1].Severity != SeverityError {
+		t.Errorf("Expected ERROR above slog's error level, got %s", sink.entries[1].Severity)
+	}
+}
@@ -0,0 +1,222 @@
+package logger
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces masked values in log entries
+const Redacted = "[redacted]"
+
+// DefaultLocationDecimals keeps coordinates to about a kilometre
+const DefaultLocationDecimals = 2
+
+// Defaults of the redactor every logger starts with
+var (
+	// DefaultRedactedKeys mask metadata whose key ends in one of them,
+	// ignoring case, dashes and underscores, so that adminApiKey is masked
+	// but a count of apiKeys is not
+	DefaultRedactedKeys = []string{"authorization", "apikey", "token", "password", "secret", "cookie", "email", "location"}
+	// DefaultRedactedPatterns mask matching text in messages and string
+	// values: bearer tokens, JWTs, API keys and email addresses
+	DefaultRedactedPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9._~+/=-]+`),
+		regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		regexp.MustCompile(`\bshr_[A-Za-z0-9_-]+`),
+		regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	// DefaultCoordinateKeys are rounded rather than masked
+	DefaultCoordinateKeys = []string{"latitude", "longitude", "lat", "lon", "lng"}
+)
+
+// Redactor masks secrets and personal data in log entries before they are
+// written
+type Redactor struct {
+	keys           []string
+	patterns       []*regexp.Regexp
+	coordinateKeys map[string]bool
+	decimals       int
+}
+
+// RedactOption configures a Redactor
+type RedactOption func(*Redactor)
+
+// WithRedactedKeys masks metadata whose key ends in one of keys, in
+// addition to the defaults
+func WithRedactedKeys(keys ...string) RedactOption {
+	return func(r *Redactor) {
+		for _, key := range keys {
+			if key = normalizeKey(key); key != "" {
+				r.keys = append(r.keys, key)
+			}
+		}
+	}
+}
+
+// WithRedactedPatterns masks text matching patterns, in addition to the
+// defaults
+func WithRedactedPatterns(patterns ...*regexp.Regexp) RedactOption {
+	return func(r *Redactor) {
+		r.patterns = append(r.patterns, patterns...)
+	}
+}
+
+// WithLocationDecimals rounds coordinates to this many decimal places
+func WithLocationDecimals(decimals int) RedactOption {
+	return func(r *Redactor) {
+		r.decimals = decimals
+	}
+}
+
+func NewRedactor(opts ...RedactOption) *Redactor {
+	r := &Redactor{
+		patterns:       append([]*regexp.Regexp(nil), DefaultRedactedPatterns...),
+		coordinateKeys: make(map[string]bool),
+		decimals:       DefaultLocationDecimals,
+	}
+	WithRedactedKeys(DefaultRedactedKeys...)(r)
+	for _, key := range DefaultCoordinateKeys {
+		r.coordinateKeys[key] = true
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// normalizeKey lowercases key and drops dashes and underscores, so that
+// apiKey, api_key and X-API-Key all match apikey
+func normalizeKey(key string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+}
+
+// Redact masks the message, metadata and request URLs of entry in place
+func (r *Redactor) Redact(entry *LogEntry) {
+	entry.Message = r.redactString(entry.Message)
+	if entry.Metadata != nil {
+		redacted := make(map[string]interface{}, len(entry.Metadata))
+		for k, v := range entry.Metadata {
+			redacted[k] = r.redactField(k, v)
+		}
+		entry.Metadata = redacted
+	}
+	if hr := entry.HTTPRequest; hr != nil {
+		redacted := *hr
+		redacted.RequestURL = r.redactURL(hr.RequestURL)
+		redacted.Referer = r.redactURL(hr.Referer)
+		entry.HTTPRequest = &redacted
+	}
+}
+
+// sensitiveKey reports whether values under key are masked
+func (r *Redactor) sensitiveKey(key string) bool {
+	key = normalizeKey(key)
+	for _, k := range r.keys {
+		if strings.HasSuffix(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactField(key string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if r.coordinateKeys[strings.ToLower(key)] {
+		if f, ok := toFloat(v); ok {
+			return r.round(f)
+		}
+	}
+	if r.sensitiveKey(key) {
+		return Redacted
+	}
+	return r.redactValue(v)
+}
+
+// redactValue masks nested values. Values other than strings, numbers,
+// booleans, maps and slices, such as structs, are converted to their JSON
+// form first so that their fields are masked too.
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, int, int64, float64:
+		return v
+	case string:
+		return r.redactString(v)
+	case error:
+		return r.redactString(v.Error())
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			redacted[k] = r.redactField(k, value)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = r.redactValue(value)
+		}
+		return redacted
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Left for the sink to report
+		return v
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return v
+	}
+	return r.redactValue(generic)
+}
+
+func (r *Redactor) redactString(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// redactURL masks sensitive query parameters and patterns in a URL
+func (r *Redactor) redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	if u, err := url.Parse(raw); err == nil && u.RawQuery != "" {
+		query, masked := u.Query(), false
+		for key := range query {
+			if r.sensitiveKey(key) {
+				query[key] = []string{Redacted}
+				masked = true
+			}
+		}
+		if masked {
+			u.RawQuery = query.Encode()
+			raw = u.String()
+		}
+	}
+	return r.redactString(raw)
+}
+
+func (r *Redactor) round(f float64) float64 {
+	scale := math.Pow(10, float64(r.decimals))
+	return math.Round(f*scale) / scale
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case *float64:
+		if v != nil {
+			return *v, true
+		}
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
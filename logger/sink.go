@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink writes log entries somewhere. Sinks must be safe for concurrent use.
+type Sink interface {
+	Write(entry *LogEntry)
+}
+
+// JSONSink writes one JSON entry per line, the format Cloud Logging parses
+// as structured entries
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+func (s *JSONSink) Write(entry *LogEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Keep the message when metadata cannot be marshalled
+		data, _ = json.Marshal(LogEntry{
+			Timestamp: entry.Timestamp,
+			Severity:  entry.Severity,
+			Message:   entry.Message,
+			Service:   entry.Service,
+			Metadata:  map[string]interface{}{"marshal_error": err.Error()},
+		})
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(data)
+}
+
+// TextSink writes entries as human readable lines for local development,
+// such as
+//
+//	12:04:05.123 INFO    Server starting port=8080
+type TextSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewTextSink(w io.Writer) *TextSink {
+	return &TextSink{w: w}
+}
+
+func (s *TextSink) Write(entry *LogEntry) {
+	var b bytes.Buffer
+	if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+		b.WriteString(t.Local().Format("15:04:05.000"))
+		b.WriteByte(' ')
+	}
+	fmt.Fprintf(&b, "%-7s %s", entry.Severity, entry.Message)
+
+	if r := entry.HTTPRequest; r != nil {
+		writeField(&b, "status", r.Status)
+		writeField(&b, "latency", r.Latency)
+		writeField(&b, "remote_ip", r.RemoteIP)
+	}
+	keys := make([]string, 0, len(entry.Metadata))
+	for k := range entry.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeField(&b, k, entry.Metadata[k])
+	}
+	if entry.RequestID != "" {
+		writeField(&b, "request_id", entry.RequestID)
+	}
+	b.WriteByte('\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(b.Bytes())
+}
+
+// writeField writes " key=value", quoting values with spaces or quotes
+func writeField(b *bytes.Buffer, key string, value interface{}) {
+	var v string
+	switch value := value.(type) {
+	case string:
+		v = value
+	case error:
+		v = value.Error()
+	case fmt.Stringer:
+		v = value.String()
+	default:
+		if data, err := json.Marshal(value); err == nil {
+			v = string(data)
+		} else {
+			v = fmt.Sprint(value)
+		}
+	}
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = strconv.Quote(v)
+	}
+	fmt.Fprintf(b, " %s=%s", key, v)
+}
+
+// FileSink appends JSON entries to a file
+type FileSink struct {
+	*JSONSink
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it if needed
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{JSONSink: NewJSONSink(file), file: file}, nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Handler returns a log/slog handler writing records through l, so that
+// libraries using slog, and the standard log package once slog.SetDefault
+// has been called, produce the same entries. Attributes become metadata,
+// with group names joined by dots.
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+type slogHandler struct {
+	logger *Logger
+	prefix string
+}
+
+// slogSeverity maps slog levels onto severities; levels between the
+// standard ones take the next lower severity
+func slogSeverity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return SeverityError
+	case level >= slog.LevelWarn:
+		return SeverityWarning
+	case level >= slog.LevelInfo:
+		return SeverityInfo
+	}
+	return SeverityDebug
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(slogSeverity(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var metadata map[string]interface{}
+	if r.NumAttrs() > 0 {
+		metadata = make(map[string]interface{}, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(metadata, h.prefix, a)
+			return true
+		})
+	}
+	at := r.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	h.logger.log(ctx, at, slogSeverity(r.Level), r.Message, nil, metadata)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		addAttr(fields, h.prefix, a)
+	}
+	return &slogHandler{logger: h.logger.With(fields), prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, prefix: h.prefix + name + "."}
+}
+
+// addAttr adds a to metadata under prefix, flattening groups
+func addAttr(metadata map[string]interface{}, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(metadata, groupPrefix, ga)
+		}
+	case slog.KindDuration:
+		metadata[prefix+a.Key] = a.Value.Duration().String()
+	default:
+		v := a.Value.Any()
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		metadata[prefix+a.Key] = v
+	}
+}
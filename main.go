@@ -1,38 +1,130 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
+	"flag"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"service/auth"
+	"service/config"
 	"service/handlers"
 	"service/logger"
+	"service/metrics"
+	"service/middleware"
+	"service/privacy"
+	"service/problem"
 	"service/storage"
+	"service/tracing"
 )
 
-// corsMiddleware adds CORS headers to responses
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+func main() {
+	// Load configuration from defaults, the -config file, the environment and
+	// flags, in increasing order of precedence
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.Fatal("Invalid configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	log, closeLog, err := newLogger(cfg.Logging)
+	if err != nil {
+		logger.Fatal("Invalid logging configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer closeLog()
+	logger.SetDefault(log)
+	// Route slog and the standard log package, used by net/http for server
+	// errors, through the same logger
+	slog.SetDefault(slog.New(log.Handler()))
 
-		next.ServeHTTP(w, r)
+	tracer, closeTracer, err := newTracer(cfg.Tracing)
+	if err != nil {
+		logger.Fatal("Invalid tracing configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer closeTracer()
+	tracing.SetDefault(tracer)
+
+	logger.Info("Configuration loaded", map[string]interface{}{
+		"config": cfg.Redacted(),
 	})
-}
 
-func main() {
+	// Stop on SIGTERM, which Cloud Run sends before killing the container, or
+	// on Ctrl-C; a second signal kills the process immediately
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// Initialize the storage
-	store := storage.NewStore()
+	var store *storage.Store
+	if cfg.Storage.Backend == config.BackendMemory {
+		store = storage.NewMemoryStore()
+	} else {
+		store = storage.NewFileStore(cfg.Storage.Path)
+	}
+
+	// Permanently remove trashed sightings after the retention period (0 keeps them forever)
+	if days := cfg.Storage.TrashRetentionDays; days > 0 {
+		storage.StartRetention(ctx, store, time.Duration(days)*24*time.Hour, time.Hour)
+	}
+
+	// Hide exact locations of obscured and private sightings and of sensitive
+	// species on a grid
+	privacyPolicy := privacy.NewPolicy(
+		privacy.WithGrid(cfg.Privacy.LocationGridDegrees),
+		privacy.WithSensitiveSpecies(cfg.Privacy.SensitiveSpecies),
+	)
+
+	// Export request, storage and runtime metrics
+	metrics.Default.RegisterRuntime()
+	store.RegisterMetrics(metrics.Default)
+	policy := auth.DefaultPolicy()
+	httpMetrics := middleware.NewHTTPMetrics(metrics.Default, policy.Route)
 
 	// Initialize handlers
-	itemHandler := handlers.NewItemHandler(store)
+	proxies, _ := middleware.ParseTrustedProxies(strings.Join(cfg.Limits.TrustedProxies, ","))
+	decoder := handlers.Decoder{
+		MaxBodyBytes:       int64(cfg.Limits.MaxBodyKB) << 10,
+		MaxUploadBytes:     int64(cfg.Limits.MaxUploadMB) << 20,
+		AllowUnknownFields: cfg.Server.AllowUnknownFields,
+	}
+	itemHandler := handlers.NewItemHandler(store,
+		handlers.WithIdempotencyStore(storage.NewIdempotencyStore(time.Duration(cfg.Limits.IdempotencyTTL))),
+		handlers.WithPrivacyPolicy(privacyPolicy),
+		handlers.WithDecoder(decoder),
+		handlers.WithTrustedProxies(proxies),
+		handlers.WithEditUnowned(cfg.Auth.EditUnowned),
+	)
+	userHandler := handlers.NewUserHandler(store, decoder)
+	apiKeyHandler := handlers.NewAPIKeyHandler(store, decoder)
+	metricsHandler := handlers.NewMetricsHandler(metrics.Default, cfg.Metrics.Token)
+	healthHandler := handlers.NewHealthHandler(store,
+		handlers.WithVersion(version),
+		handlers.WithMinFreeDisk(uint64(cfg.Storage.MinFreeDiskMB)<<20),
+	)
 
 	// Setup routes
 	mux := http.NewServeMux()
@@ -40,27 +132,288 @@ func main() {
 	// CRUD endpoints
 	mux.HandleFunc("/items", itemHandler.HandleItems)
 	mux.HandleFunc("/items/", itemHandler.HandleItemByID)
+	mux.HandleFunc("/items:batch", itemHandler.HandleBatch)
+
+	// Offline sync
+	mux.HandleFunc("/sync", itemHandler.HandleSync)
+
+	// Trash
+	mux.HandleFunc("/trash", itemHandler.HandleTrash)
+	mux.HandleFunc("/trash/", itemHandler.HandleTrashItem)
+
+	// Users
+	mux.HandleFunc("/users", userHandler.HandleUsers)
+	mux.HandleFunc("/users/", userHandler.HandleUserByID)
+
+	// Admin
+	mux.HandleFunc("/admin/keys", apiKeyHandler.HandleKeys)
+	mux.HandleFunc("/admin/keys/", apiKeyHandler.HandleKeyByID)
+	mux.HandleFunc("/status", healthHandler.HandleStatus)
+
+	// Everything else, such as /metrics when metrics are off
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusNotFound, "")
+	})
+
+	// Authenticate API keys; the admin API key is accepted as an admin
+	// credential for bootstrapping
+	authOpts := []auth.Option{
+		auth.WithBootstrapKey(cfg.Auth.AdminAPIKey),
+		auth.WithRequired(cfg.Auth.Required),
+	}
+
+	// Trust identity provider tokens signed by a key from the configured JWKS
+	if validator := jwtValidator(cfg.Auth); validator != nil {
+		authOpts = append(authOpts, auth.WithJWTValidator(validator))
+	}
+	authenticator := auth.NewAuthenticator(store, authOpts...)
+
+	// Limit requests per client; limits were checked by config.Validate
+	rateLimitOpts := []middleware.RateLimitOption{}
+	for class, v := range map[string]string{
+		middleware.ClassRead:   cfg.Limits.RateLimitRead,
+		middleware.ClassWrite:  cfg.Limits.RateLimitWrite,
+		middleware.ClassUpload: cfg.Limits.RateLimitUpload,
+		middleware.ClassAuth:   cfg.Limits.RateLimitAuth,
+	} {
+		limit, _ := middleware.ParseLimit(v)
+		rateLimitOpts = append(rateLimitOpts, middleware.WithLimit(class, limit))
+	}
+	rateLimitOpts = append(rateLimitOpts, middleware.WithTrustedProxies(proxies))
+	rateLimiter := middleware.NewRateLimiter(rateLimitOpts...)
+
+	cors, err := middleware.NewCORS(cfg.CORSOptions()...)
+	if err != nil {
+		logger.Fatal("Invalid CORS configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Wrap mux with the route policy, rate limiting, authentication, the limit
+	// on failed authentications per IP, then CORS so that preflight requests
+	// never need credentials
+	api := cors.Middleware(rateLimiter.AuthFailures(authenticator.Middleware(rateLimiter.Middleware(policy.Middleware(mux)))))
+
+	// Liveness and readiness probes and metrics bypass authentication and rate
+	// limiting so that load balancers and scrapers can always reach them
+	handler := http.NewServeMux()
+	handler.HandleFunc("/healthz", healthHandler.HandleHealthz)
+	handler.HandleFunc("/readyz", healthHandler.HandleReadyz)
+	if cfg.Metrics.Enabled {
+		handler.HandleFunc("/metrics", metricsHandler.HandleMetrics)
+	}
+	handler.Handle("/", api)
+
+	// Log every request in the Cloud Logging httpRequest format; probes and
+	// scrapes are only logged when they fail or are slow. RequestContext,
+	// outside it, tags every entry with the request ID and trace, and
+	// httpTracing records the request's span when tracing is on.
+	httpTracing := middleware.NewHTTPTracing(tracer, policy.Route)
+	var logged http.Handler = handler
+	if cfg.Logging.AccessLog {
+		accessLog := middleware.NewAccessLog(
+			middleware.WithSampleRate(cfg.Logging.AccessLogSampleRate),
+			middleware.WithSlowThreshold(time.Duration(cfg.Logging.SlowRequestThreshold)),
+			middleware.WithSkipPaths("/healthz", "/readyz", "/metrics"),
+			middleware.WithAccessLogTrustedProxies(proxies),
+		)
+		logged = accessLog.Middleware(handler)
+	}
+
+	// Serve profiling and debug endpoints to admins on a separate port that is
+	// not exposed publicly
+	if cfg.Debug.Port != 0 {
+		go serveDebug(ctx, newDebugServer(cfg.Debug.Port, store, authenticator))
+	}
 
-	// Wrap mux with CORS middleware
-	handler := corsMiddleware(mux)
+	server := &http.Server{
+		Addr:         ":" + strconv.Itoa(cfg.Port),
+		Handler:      httpMetrics.Middleware(middleware.RequestContext(httpTracing.Middleware(logged))),
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+	}
+	serve(ctx, server, store, healthHandler, time.Duration(cfg.Server.DrainDelay), time.Duration(cfg.Server.ShutdownTimeout))
+}
+
+// serve runs server until ctx is cancelled, then fails readiness, keeps
+// serving for drainDelay so that load balancers stop routing to it, stops
+// accepting connections, waits up to timeout for in-flight requests and
+// flushes store
+func serve(ctx context.Context, server *http.Server, store *storage.Store, health *handlers.HealthHandler, drainDelay, timeout time.Duration) {
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("Server starting", map[string]interface{}{
+			"addr": server.Addr,
+		})
+		errCh <- server.ListenAndServe()
+	}()
 
-	// Get port from environment variable (for Cloud Run) or default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	select {
+	case err := <-errCh:
+		logger.Fatal("Server failed to start", map[string]interface{}{
+			"error": err.Error(),
+		})
+	case <-ctx.Done():
 	}
 
-	// Start server
-	logger.Info("Server starting", map[string]interface{}{
-		"port": port,
+	health.ShuttingDown()
+	logger.Info("Shutdown started", map[string]interface{}{
+		"drain_delay": drainDelay.String(),
+		"timeout":     timeout.String(),
 	})
-	logger.Info("CORS configuration", map[string]interface{}{
-		"enabled": true,
-		"origins": "*",
+	// Keep serving while load balancers notice readiness failing, so that
+	// requests they still route here are not refused
+	time.Sleep(drainDelay)
+	logger.Info("Draining connections", nil)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warning("Connections still open after shutdown timeout, closing them", map[string]interface{}{
+			"error": err.Error(),
+		})
+		server.Close()
+	} else {
+		logger.Info("Connections drained", nil)
+	}
+
+	if err := store.Flush(); err != nil {
+		logger.Error("Failed to flush storage", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	logger.Info("Storage flushed, shutdown complete", nil)
+}
+
+// newDebugServer returns the server for pprof, expvar, goroutine dumps and
+// the storage lock report on port, which only admins may use
+func newDebugServer(port int, store *storage.Store, authenticator *auth.Authenticator) *http.Server {
+	// Sample contended mutexes and blocked goroutines for the mutex and block
+	// profiles
+	runtime.SetMutexProfileFraction(100)
+	runtime.SetBlockProfileRate(int(time.Millisecond))
+
+	expvar.NewString("version").Set(version)
+	expvar.Publish("storageLock", expvar.Func(func() any { return store.LockStats() }))
+
+	debugHandler := handlers.NewDebugHandler(store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", debugHandler.HandleGoroutines)
+	mux.HandleFunc("/debug/storage/locks", debugHandler.HandleStorageLocks)
+
+	// Only admins get in, and every request is logged
+	handler := authenticator.Middleware(auth.DebugPolicy().Middleware(mux))
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(port),
+		Handler:           middleware.RequestContext(middleware.NewAccessLog().Middleware(handler)),
+		ReadHeaderTimeout: 10 * time.Second,
+		// No write timeout, as CPU profiles and execution traces take as
+		// long as requested
+	}
+}
+
+// serveDebug runs the debug server until ctx is cancelled. The API keeps
+// running if it fails.
+func serveDebug(ctx context.Context, server *http.Server) {
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger.Info("Debug server starting", map[string]interface{}{
+		"addr": server.Addr,
 	})
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		logger.Fatal("Server failed to start", map[string]interface{}{
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Debug server failed", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 }
+
+// newLogger returns the logger for cfg and a function closing its log file
+func newLogger(cfg config.LoggingConfig) (*logger.Logger, func() error, error) {
+	// Mask secrets and personal data on top of the logger's defaults
+	patterns := make([]*regexp.Regexp, 0, len(cfg.RedactPatterns))
+	for _, pattern := range cfg.RedactPatterns {
+		p, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	redactor := logger.NewRedactor(
+		logger.WithRedactedKeys(cfg.RedactKeys...),
+		logger.WithRedactedPatterns(patterns...),
+		logger.WithLocationDecimals(cfg.LocationDecimals),
+	)
+
+	var sinks []logger.Sink
+	if cfg.Format == config.LogFormatText {
+		sinks = append(sinks, logger.NewTextSink(os.Stdout))
+	} else {
+		sinks = append(sinks, logger.NewJSONSink(os.Stdout))
+	}
+	closeLog := func() error { return nil }
+	if cfg.File != "" {
+		file, err := logger.NewFileSink(cfg.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, file)
+		closeLog = file.Close
+	}
+
+	l := logger.New(logger.WithSinks(sinks...), logger.WithRedactor(redactor))
+	if err := l.SetLevel(cfg.Level); err != nil {
+		return nil, nil, err
+	}
+	return l, closeLog, nil
+}
+
+// newTracer returns the tracer for cfg, which records nothing without an
+// exporter, and a function closing its trace file
+func newTracer(cfg config.TracingConfig) (*tracing.Tracer, func() error, error) {
+	switch cfg.Exporter {
+	case config.TracingStdout:
+		return tracing.NewTracer(tracing.NewStdoutExporter(os.Stderr)), func() error { return nil }, nil
+	case config.TracingOTLPFile:
+		exporter, err := tracing.NewOTLPFileExporter(cfg.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tracing.NewTracer(exporter), exporter.Close, nil
+	}
+	return tracing.NewTracer(nil), func() error { return nil }, nil
+}
+
+// jwtValidator returns the identity provider token validator for cfg, or nil
+// when no key set is configured
+func jwtValidator(cfg config.AuthConfig) *auth.JWTValidator {
+	var jwks *auth.JWKS
+	switch {
+	case cfg.JWKSURL != "":
+		jwks = auth.NewRemoteJWKS(cfg.JWKSURL, &http.Client{Timeout: 10 * time.Second})
+	case cfg.JWKSFile != "":
+		jwks = auth.NewFileJWKS(cfg.JWKSFile)
+	default:
+		return nil
+	}
+
+	// A key set that cannot be loaded yet is retried on the first token
+	if err := jwks.Refresh(context.Background()); err != nil {
+		logger.Error("Failed to load JWKS", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return auth.NewJWTValidator(jwks, cfg.JWTIssuer, cfg.JWTAudience,
+		auth.WithRoleClaim(cfg.JWTRoleClaim),
+		auth.WithScopeClaim(cfg.JWTScopeClaim),
+	)
+}
@@ -0,0 +1,377 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the Prometheus text format, without depending on the Prometheus client
+// library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Bucket boundaries for histograms
+var (
+	// DefaultBuckets suit latencies in seconds
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// SizeBuckets suit body sizes in bytes, up to the megabytes of an inline
+	// image upload
+	SizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Default is the registry the service exposes on /metrics
+var Default = NewRegistry()
+
+// collector writes one or more metric families
+type collector interface {
+	names() []string
+	write(w io.Writer)
+}
+
+// Registry holds metrics in registration order
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds c; registering a name twice is a programming error and
+// panics
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range c.names() {
+		if r.names[name] {
+			panic("metrics: duplicate metric " + name)
+		}
+		r.names[name] = true
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every metric in the text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry in the text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.Write(w)
+	})
+}
+
+// desc describes a metric family
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) names() []string {
+	return []string{d.name}
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, helpEscaper.Replace(d.help), d.name, d.typ)
+}
+
+// labelPairs formats label names and values as {a="x",b="y"}, with extra
+// pairs such as le appended
+func labelPairs(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extra[i], labelEscaper.Replace(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Label values escape backslashes, quotes and newlines; help texts only
+// backslashes and newlines
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// atomicFloat is a float64 that can be updated concurrently
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// series holds the children of a labelled metric family by label values
+type series[T any] struct {
+	mu       sync.Mutex
+	children map[string]*T
+	values   map[string][]string
+	newChild func() *T
+}
+
+func newSeries[T any](newChild func() *T) series[T] {
+	return series[T]{
+		children: make(map[string]*T),
+		values:   make(map[string][]string),
+		newChild: newChild,
+	}
+}
+
+func (s *series[T]) with(labels []string, values []string) *T {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	child, ok := s.children[key]
+	if !ok {
+		child = s.newChild()
+		s.children[key] = child
+		s.values[key] = append([]string(nil), values...)
+	}
+	return child
+}
+
+// each calls fn for every child in label order
+func (s *series[T]) each(fn func(values []string, child *T)) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.children))
+	for key := range s.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]*T, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		children[i] = s.children[key]
+		values[i] = s.values[key]
+	}
+	s.mu.Unlock()
+
+	for i := range keys {
+		fn(values[i], children[i])
+	}
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add increases the counter by v, which must not be negative
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(v)
+}
+
+// CounterVec is a family of counters told apart by label values
+type CounterVec struct {
+	desc
+	series[Counter]
+}
+
+// NewCounterVec registers a counter family. Without labels it holds a single
+// counter, returned by With().
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, typ: "counter", labels: labels},
+		series: newSeries(func() *Counter { return &Counter{} }),
+	}
+	r.register(c)
+	return c
+}
+
+// With returns the counter for the given label values, creating it on first
+// use
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(c.labels, values)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w)
+	c.each(func(values []string, counter *Counter) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, values), formatFloat(counter.v.Load()))
+	})
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	desc
+	v atomicFloat
+}
+
+// NewGauge registers a gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, typ: "gauge"}}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Add(v float64) {
+	g.v.Add(v)
+}
+
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.v.Load()))
+}
+
+// GaugeFunc is a gauge whose value is read when metrics are written
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge that calls fn on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, typ: "gauge"}, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramVec is a family of histograms told apart by label values
+type HistogramVec struct {
+	desc
+	series[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bucket
+// bounds, in increasing order; the +Inf bucket is implied
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+	}
+	h.series = newSeries(func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})
+	r.register(h)
+	return h
+}
+
+// With returns the histogram for the given label values, creating it on first
+// use
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(h.labels, values)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+	h.each(func(values []string, hist *Histogram) {
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, values), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, values), count)
+	})
+}
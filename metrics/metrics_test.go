@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Number of requests.", "route", "status")
+	inFlight := r.NewGauge("in_flight", "Requests in flight.")
+	r.NewGaugeFunc("items", "Number of items.", func() float64 { return 42 })
+	latency := r.NewHistogramVec("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+
+	requests.With("/items", "200").Inc()
+	requests.With("/items", "200").Add(2)
+	requests.With(`/a"b\c`, "500").Inc()
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.With("/items").Observe(0.05)
+	latency.With("/items").Observe(0.1)
+	latency.With("/items").Observe(3)
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	want := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="/a\"b\\c",status="500"} 1
+requests_total{route="/items",status="200"} 3
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP items Number of items.
+# TYPE items gauge
+items 42
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/items",le="0.1"} 2
+latency_seconds_bucket{route="/items",le="1"} 2
+latency_seconds_bucket{route="/items",le="+Inf"} 3
+latency_seconds_sum{route="/items"} 3.15
+latency_seconds_count{route="/items"} 3
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("dup", "First.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for duplicate metric name")
+		}
+	}()
+	r.NewCounterVec("dup", "Second.")
+}
+
+func TestCounterVec_WrongLabelCount(t *testing.T) {
+	c := NewRegistry().NewCounterVec("c_total", "Counter.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for wrong number of label values")
+		}
+	}()
+	c.With("only-one")
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	c := NewRegistry().NewCounterVec("c_total", "Counter.")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.With().Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	if got := c.With().v.Load(); got != 8000 {
+		t.Errorf("Expected 8000, got %v", got)
+	}
+}
+
+func TestRegisterRuntime(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterRuntime()
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for _, name := range []string{"go_goroutines ", "go_memstats_alloc_bytes ", "go_gc_cycles_total ", "process_start_time_seconds ", `go_info{version="go`} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("Expected %s in output:\n%s", name, buf.String())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// runtimeCollector reports Go runtime statistics, reading them once per
+// scrape
+type runtimeCollector struct {
+	started time.Time
+}
+
+// RegisterRuntime registers Go runtime and process metrics: goroutines,
+// threads, heap and GC statistics, the Go version and the start time
+func (r *Registry) RegisterRuntime() {
+	r.register(&runtimeCollector{started: time.Now()})
+}
+
+func (c *runtimeCollector) names() []string {
+	return []string{
+		"go_info",
+		"go_goroutines",
+		"go_threads",
+		"go_memstats_alloc_bytes",
+		"go_memstats_sys_bytes",
+		"go_memstats_heap_objects",
+		"go_memstats_mallocs_total",
+		"go_gc_cycles_total",
+		"go_gc_pause_seconds_total",
+		"process_start_time_seconds",
+	}
+}
+
+func (c *runtimeCollector) write(w io.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(v))
+	}
+	counter := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatFloat(v))
+	}
+
+	fmt.Fprintf(w, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info{version=%q} 1\n", runtime.Version())
+	gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	gauge("go_threads", "Number of OS threads created.", float64(threads))
+	gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(ms.Alloc))
+	gauge("go_memstats_sys_bytes", "Number of bytes obtained from the system.", float64(ms.Sys))
+	gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(ms.HeapObjects))
+	counter("go_memstats_mallocs_total", "Total number of mallocs.", float64(ms.Mallocs))
+	counter("go_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC))
+	counter("go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.", time.Duration(ms.PauseTotalNs).Seconds())
+	gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(c.started.Unix()))
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"service/logger"
+)
+
+// DefaultSlowRequestThreshold is the latency from which a request is flagged
+// as slow; the slow request alert fires on requests over 2 seconds
+const DefaultSlowRequestThreshold = 2 * time.Second
+
+// AccessLog writes one structured log entry per request with a Cloud Logging
+// httpRequest object
+type AccessLog struct {
+	sampleRate     float64
+	slowThreshold  time.Duration
+	skipPaths      map[string]bool
+	trustedProxies []netip.Prefix
+	random         func() float64
+}
+
+// AccessLogOption configures an AccessLog
+type AccessLogOption func(*AccessLog)
+
+// WithSampleRate logs only this fraction, between 0 and 1, of requests that
+// were neither slow nor failed; those are always logged
+func WithSampleRate(rate float64) AccessLogOption {
+	return func(a *AccessLog) {
+		a.sampleRate = rate
+	}
+}
+
+// WithSlowThreshold sets the latency from which requests are flagged as slow
+// and always logged; 0 disables the flag
+func WithSlowThreshold(d time.Duration) AccessLogOption {
+	return func(a *AccessLog) {
+		a.slowThreshold = d
+	}
+}
+
+// WithSkipPaths stops logging requests to paths such as health probes unless
+// they are slow or fail
+func WithSkipPaths(paths ...string) AccessLogOption {
+	return func(a *AccessLog) {
+		for _, path := range paths {
+			a.skipPaths[path] = true
+		}
+	}
+}
+
+// WithAccessLogTrustedProxies sets the proxies whose X-Forwarded-For header
+// is used to find the remote IP
+func WithAccessLogTrustedProxies(prefixes []netip.Prefix) AccessLogOption {
+	return func(a *AccessLog) {
+		a.trustedProxies = prefixes
+	}
+}
+
+func NewAccessLog(opts ...AccessLogOption) *AccessLog {
+	a := &AccessLog{
+		sampleRate:    1,
+		slowThreshold: DefaultSlowRequestThreshold,
+		skipPaths:     make(map[string]bool),
+		random:        rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Middleware logs every request passed to next once it has been served.
+// Server errors are logged as ERROR, client errors and slow requests as
+// WARNING and everything else as INFO.
+func (a *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		next.ServeHTTP(rec, r)
+
+		latency := time.Since(start)
+		status := rec.Status()
+		slow := a.slowThreshold > 0 && latency >= a.slowThreshold
+
+		severity := logger.SeverityInfo
+		switch {
+		case status >= 500:
+			severity = logger.SeverityError
+		case status >= 400 || slow:
+			severity = logger.SeverityWarning
+		}
+		if severity == logger.SeverityInfo && (a.skipPaths[r.URL.Path] || !a.sampled()) {
+			return
+		}
+
+		var metadata map[string]interface{}
+		if slow {
+			metadata = map[string]interface{}{
+				"slow":              true,
+				"slow_threshold_ms": a.slowThreshold.Milliseconds(),
+			}
+		}
+
+		logger.Request(r.Context(), severity, fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status), &logger.HTTPRequest{
+			RequestMethod: r.Method,
+			RequestURL:    r.URL.RequestURI(),
+			RequestSize:   strconv.FormatInt(requestSize(r, body), 10),
+			Status:        status,
+			ResponseSize:  strconv.FormatInt(rec.bytes, 10),
+			UserAgent:     r.UserAgent(),
+			RemoteIP:      ClientIP(r, a.trustedProxies),
+			Referer:       r.Referer(),
+			Latency:       strconv.FormatFloat(latency.Seconds(), 'f', -1, 64) + "s",
+			Protocol:      r.Proto,
+		}, metadata)
+	})
+}
+
+// sampled reports whether a routine request should be logged
+func (a *AccessLog) sampled() bool {
+	return a.sampleRate >= 1 || (a.sampleRate > 0 && a.random() < a.sampleRate)
+}
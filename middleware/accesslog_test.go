@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"service/logger"
+)
+
+// captureLog collects log entries written during a test
+func captureLog(t *testing.T) func() []logger.LogEntry {
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+
+	return func() []logger.LogEntry {
+		var entries []logger.LogEntry
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry logger.LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("Log line is not JSON: %q", line)
+			}
+			entries = append(entries, entry)
+		}
+		buf.Reset()
+		return entries
+	}
+}
+
+func TestAccessLog_Entry(t *testing.T) {
+	entries := captureLog(t)
+	handler := NewAccessLog().Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/items?dryRun=true", strings.NewReader(`{"count":1}`))
+	req.Header.Set("User-Agent", "shroomp-ios/2.1")
+	req.Header.Set("Referer", "https://app.example.com/")
+	req.RemoteAddr = "203.0.113.7:51234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	logged := entries()
+	if len(logged) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(logged))
+	}
+	entry := logged[0]
+	if entry.Severity != logger.SeverityInfo || entry.Message != "POST /items 201" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	hr := entry.HTTPRequest
+	if hr == nil {
+		t.Fatal("Expected httpRequest")
+	}
+	want := logger.HTTPRequest{
+		RequestMethod: http.MethodPost,
+		RequestURL:    "/items?dryRun=true",
+		RequestSize:   "11",
+		Status:        http.StatusCreated,
+		ResponseSize:  "10",
+		UserAgent:     "shroomp-ios/2.1",
+		RemoteIP:      "203.0.113.7",
+		Referer:       "https://app.example.com/",
+		Latency:       hr.Latency,
+		Protocol:      "HTTP/1.1",
+	}
+	if *hr != want {
+		t.Errorf("Expected %+v, got %+v", want, *hr)
+	}
+	if !strings.HasSuffix(hr.Latency, "s") {
+		t.Errorf("Expected latency as a duration in seconds, got %q", hr.Latency)
+	}
+}
+
+func TestAccessLog_Severity(t *testing.T) {
+	entries := captureLog(t)
+
+	tests := []struct {
+		status   int
+		severity string
+	}{
+		{http.StatusOK, logger.SeverityInfo},
+		{http.StatusNotFound, logger.SeverityWarning},
+		{http.StatusTooManyRequests, logger.SeverityWarning},
+		{http.StatusInternalServerError, logger.SeverityError},
+	}
+
+	for _, tt := range tests {
+		handler := NewAccessLog().Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+
+		logged := entries()
+		if len(logged) != 1 || logged[0].Severity != tt.severity {
+			t.Errorf("Status %d: expected one %s entry, got %+v", tt.status, tt.severity, logged)
+		}
+	}
+}
+
+func TestAccessLog_SamplingAndSkipping(t *testing.T) {
+	entries := captureLog(t)
+
+	status := http.StatusOK
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	a := NewAccessLog(WithSampleRate(0.25), WithSkipPaths("/healthz"))
+	a.random = func() float64 { return 0.5 }
+	handler := a.Middleware(next)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	if logged := entries(); len(logged) != 0 {
+		t.Errorf("Expected request outside the sample not to be logged, got %+v", logged)
+	}
+
+	a.random = func() float64 { return 0.1 }
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	if logged := entries(); len(logged) != 1 {
+		t.Errorf("Expected sampled request to be logged, got %+v", logged)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if logged := entries(); len(logged) != 0 {
+		t.Errorf("Expected skipped path not to be logged, got %+v", logged)
+	}
+
+	// Failures are always logged
+	a.random = func() float64 { return 0.5 }
+	status = http.StatusServiceUnavailable
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	if logged := entries(); len(logged) != 2 {
+		t.Errorf("Expected failed requests to be logged, got %+v", logged)
+	}
+}
+
+func TestAccessLog_SlowRequest(t *testing.T) {
+	entries := captureLog(t)
+	handler := NewAccessLog(WithSampleRate(0), WithSlowThreshold(10*time.Millisecond)).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	logged := entries()
+	if len(logged) != 1 {
+		t.Fatalf("Expected slow request to be logged despite sampling, got %d entries", len(logged))
+	}
+	if logged[0].Severity != logger.SeverityWarning || logged[0].Metadata["slow"] != true {
+		t.Errorf("Expected slow WARNING entry, got %+v", logged[0])
+	}
+}
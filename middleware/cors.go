@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"service/problem"
+)
+
+// Defaults used when a CORS policy does not set them
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	DefaultCORSHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "Idempotency-Key", "X-Request-ID", "traceparent"}
+	// DefaultCORSExposedHeaders lets browser clients read the rate limit and
+	// idempotency headers, and the request ID and trace context
+	DefaultCORSExposedHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Idempotent-Replayed", "X-Request-ID", "traceparent"}
+)
+
+var ErrWildcardCredentials = errors.New("CORS origin * cannot be combined with credentials")
+
+// CORS answers preflight requests and adds CORS headers to responses for
+// allowed origins
+type CORS struct {
+	origins          []string
+	allowAny         bool
+	allowCredentials bool
+	methods          []string
+	headers          []string
+	exposedHeaders   []string
+	maxAge           time.Duration
+}
+
+// CORSOption configures a CORS policy
+type CORSOption func(*CORS)
+
+// WithAllowedOrigins sets the origins allowed to make cross-origin requests.
+// An origin is either exact, such as "https://app.example.com", a wildcard
+// subdomain pattern, such as "https://*.example.com", or "*" for any origin.
+func WithAllowedOrigins(origins ...string) CORSOption {
+	return func(c *CORS) {
+		c.origins = nil
+		c.allowAny = false
+		for _, origin := range origins {
+			origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+			switch origin {
+			case "":
+			case "*":
+				c.allowAny = true
+			default:
+				c.origins = append(c.origins, origin)
+			}
+		}
+	}
+}
+
+// WithAllowCredentials lets browsers send cookies and authorization headers
+// with cross-origin requests
+func WithAllowCredentials(allow bool) CORSOption {
+	return func(c *CORS) {
+		c.allowCredentials = allow
+	}
+}
+
+// WithAllowedHeaders sets the request headers clients may send
+func WithAllowedHeaders(headers ...string) CORSOption {
+	return func(c *CORS) {
+		c.headers = headers
+	}
+}
+
+// WithExposedHeaders sets the response headers clients may read
+func WithExposedHeaders(headers ...string) CORSOption {
+	return func(c *CORS) {
+		c.exposedHeaders = headers
+	}
+}
+
+// WithMaxAge sets how long browsers may cache preflight responses
+func WithMaxAge(d time.Duration) CORSOption {
+	return func(c *CORS) {
+		c.maxAge = d
+	}
+}
+
+// NewCORS returns a CORS policy. Without options any origin is allowed
+// without credentials.
+func NewCORS(opts ...CORSOption) (*CORS, error) {
+	c := &CORS{
+		allowAny:       true,
+		methods:        DefaultCORSMethods,
+		headers:        DefaultCORSHeaders,
+		exposedHeaders: DefaultCORSExposedHeaders,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.allowAny && c.allowCredentials {
+		return nil, ErrWildcardCredentials
+	}
+	for _, origin := range c.origins {
+		if !strings.Contains(origin, "://") || strings.Count(origin, "*") > 1 ||
+			(strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		}
+	}
+	return c, nil
+}
+
+// Origins returns the configured origins, for logging
+func (c *CORS) Origins() []string {
+	if c.allowAny {
+		return []string{"*"}
+	}
+	return c.origins
+}
+
+// Middleware answers preflight requests from allowed origins with 204 No
+// Content and rejects all other preflights with 403 Forbidden. Other requests
+// always reach next; CORS headers are only added for allowed origins, so that
+// browsers block the response for everyone else.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Responses differ per origin, so caches must keep them apart
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := c.allowOrigin(origin)
+		if !preflight {
+			if allowed {
+				c.setOriginHeaders(w, origin)
+				if len(c.exposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.exposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !allowed || !containsFold(c.methods, method) || !c.allowHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			problem.Error(w, r, http.StatusForbidden, "CORS request not allowed")
+			return
+		}
+
+		c.setOriginHeaders(w, origin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.headers, ", "))
+		if c.maxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.maxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// setOriginHeaders allows origin to read the response
+func (c *CORS) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if c.allowAny {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowOrigin reports whether origin matches the allowlist. A wildcard
+// pattern matches subdomains at any depth but not the domain itself.
+func (c *CORS) allowOrigin(origin string) bool {
+	if c.allowAny {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if !wildcard {
+			if origin == allowed {
+				return true
+			}
+			continue
+		}
+		// suffix starts with "." so the apex domain never matches
+		if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			sub := origin[len(prefix) : len(origin)-len(suffix)]
+			if !strings.ContainsAny(sub, "/:@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether every header in a comma separated
+// Access-Control-Request-Headers value is allowed
+func (c *CORS) allowHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !containsFold(c.headers, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS_AllowOrigin(t *testing.T) {
+	c, err := NewCORS(WithAllowedOrigins("https://app.example.com", "https://*.shroomp.dev/"))
+	if err != nil {
+		t.Fatalf("NewCORS failed: %v", err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://evil.com", false},
+		{"https://preview.shroomp.dev", true},
+		{"https://a.b.shroomp.dev", true},
+		{"https://shroomp.dev", false},
+		{"https://evilshroomp.dev", false},
+		{"https://x.shroomp.dev.evil.com", false},
+		{"https://user@x.shroomp.dev", false},
+		{"http://preview.shroomp.dev", false},
+	}
+
+	for _, tt := range tests {
+		if got := c.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q): expected %v, got %v", tt.origin, tt.want, got)
+		}
+	}
+}
+
+func TestNewCORS_Validation(t *testing.T) {
+	if _, err := NewCORS(WithAllowCredentials(true)); err != ErrWildcardCredentials {
+		t.Errorf("Expected ErrWildcardCredentials, got %v", err)
+	}
+	for _, origin := range []string{"app.example.com", "https://foo*.example.com", "https://*.*.example.com"} {
+		if _, err := NewCORS(WithAllowedOrigins(origin)); err == nil {
+			t.Errorf("Expected error for origin %q", origin)
+		}
+	}
+}
+
+func TestCORS_Middleware(t *testing.T) {
+	c, err := NewCORS(
+		WithAllowedOrigins("https://app.example.com"),
+		WithAllowCredentials(true),
+		WithMaxAge(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewCORS failed: %v", err)
+	}
+	reached := false
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		reqMethod   string
+		reqHeaders  string
+		wantStatus  int
+		wantReached bool
+		wantOrigin  string
+	}{
+		{"same origin", http.MethodGet, "", "", "", http.StatusOK, true, ""},
+		{"allowed request", http.MethodGet, "https://app.example.com", "", "", http.StatusOK, true, "https://app.example.com"},
+		{"disallowed request", http.MethodGet, "https://evil.com", "", "", http.StatusOK, true, ""},
+		{"allowed preflight", http.MethodOptions, "https://app.example.com", http.MethodPut, "content-type, x-api-key", http.StatusNoContent, false, "https://app.example.com"},
+		{"disallowed origin preflight", http.MethodOptions, "https://evil.com", http.MethodPut, "", http.StatusForbidden, false, ""},
+		{"disallowed method preflight", http.MethodOptions, "https://app.example.com", "TRACE", "", http.StatusForbidden, false, ""},
+		{"disallowed header preflight", http.MethodOptions, "https://app.example.com", http.MethodPost, "X-Custom", http.StatusForbidden, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(tt.method, "/items", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.reqMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			if tt.reqHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if reached != tt.wantReached {
+				t.Errorf("Expected next handler reached=%v", tt.wantReached)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.wantOrigin, got)
+			}
+			if tt.wantOrigin != "" && w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("Expected Access-Control-Allow-Credentials true")
+			}
+			if w.Header().Get("Vary") != "Origin" {
+				t.Errorf("Expected Vary: Origin, got %v", w.Header().Values("Vary"))
+			}
+		})
+	}
+
+	// Preflight details
+	req := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected Access-Control-Max-Age 600, got %q", w.Header().Get("Access-Control-Max-Age"))
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Allow-Headers") == "" {
+		t.Errorf("Expected allowed methods and headers, got %v", w.Header())
+	}
+
+	// Exposed headers on actual requests
+	req = httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Error("Expected Access-Control-Expose-Headers")
+	}
+}
+
+func TestCORS_DefaultAllowsAnyOrigin(t *testing.T) {
+	c, err := NewCORS()
+	if err != nil {
+		t.Fatalf("NewCORS failed: %v", err)
+	}
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected wildcard origin without credentials, got %v", w.Header())
+	}
+}
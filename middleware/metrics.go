@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"service/metrics"
+)
+
+// HTTPMetrics records request counts, latencies and body sizes per route
+type HTTPMetrics struct {
+	route    func(path string) string
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	reqSize  *metrics.HistogramVec
+	respSize *metrics.HistogramVec
+	inFlight *metrics.Gauge
+}
+
+// NewHTTPMetrics registers the HTTP metrics in registry. route maps a path to
+// the route label, such as "/items/{id}", so that IDs in paths do not create
+// a series each; paths it does not know are labelled "other".
+func NewHTTPMetrics(registry *metrics.Registry, route func(path string) string) *HTTPMetrics {
+	return &HTTPMetrics{
+		route: route,
+		requests: registry.NewCounterVec("shroomp_http_requests_total",
+			"Number of HTTP requests by method, route and status.", "method", "route", "status"),
+		duration: registry.NewHistogramVec("shroomp_http_request_duration_seconds",
+			"Latency of HTTP requests in seconds by method, route and status.", metrics.DefaultBuckets, "method", "route", "status"),
+		reqSize: registry.NewHistogramVec("shroomp_http_request_size_bytes",
+			"Size of HTTP request bodies in bytes by method and route.", metrics.SizeBuckets, "method", "route"),
+		respSize: registry.NewHistogramVec("shroomp_http_response_size_bytes",
+			"Size of HTTP response bodies in bytes by method and route.", metrics.SizeBuckets, "method", "route"),
+		inFlight: registry.NewGauge("shroomp_http_requests_in_flight",
+			"Number of HTTP requests being served."),
+	}
+}
+
+// Middleware records every request passed to next. It should wrap all other
+// middleware so that rejected requests are counted too.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		rec := newResponseRecorder(w)
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		next.ServeHTTP(rec, r)
+
+		route := m.route(r.URL.Path)
+		if route == "" {
+			route = "other"
+		}
+		method := methodLabel(r.Method)
+		status := strconv.Itoa(rec.Status())
+		m.requests.With(method, route, status).Inc()
+		m.duration.With(method, route, status).Observe(time.Since(start).Seconds())
+		m.reqSize.With(method, route).Observe(float64(requestSize(r, body)))
+		m.respSize.With(method, route).Observe(float64(rec.bytes))
+	})
+}
+
+// methodLabel keeps arbitrary methods sent by clients from creating series
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"service/auth"
+	"service/metrics"
+)
+
+func TestHTTPMetrics_Middleware(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewHTTPMetrics(registry, auth.DefaultPolicy().Route)
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/items/abc", nil),
+		httptest.NewRequest(http.MethodGet, "/items/def", nil),
+		httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"count":1}`)),
+		httptest.NewRequest(http.MethodGet, "/wp-admin/login.php", nil),
+		httptest.NewRequest("BREW", "/items", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		`shroomp_http_requests_total{method="GET",route="/items/{id}",status="200"} 2`,
+		`shroomp_http_requests_total{method="POST",route="/items",status="201"} 1`,
+		`shroomp_http_requests_total{method="GET",route="other",status="200"} 1`,
+		`shroomp_http_requests_total{method="OTHER",route="/items",status="200"} 1`,
+		`shroomp_http_request_duration_seconds_count{method="GET",route="/items/{id}",status="200"} 2`,
+		`shroomp_http_request_size_bytes_sum{method="POST",route="/items"} 11`,
+		`shroomp_http_response_size_bytes_sum{method="GET",route="/items/{id}"} 10`,
+		`shroomp_http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %s in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "/items/abc") {
+		t.Error("Expected IDs not to appear in labels")
+	}
+}
@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"service/auth"
+	"service/problem"
+)
+
+// Request classes with separate rate limits
+const (
+	ClassRead   = "read"
+	ClassWrite  = "write"
+	ClassUpload = "upload"
+	// ClassAuth limits failed authentications per client IP
+	ClassAuth = "auth"
+)
+
+// DefaultUploadThreshold is the request body size, in bytes, from which a
+// write counts as an upload. Sightings carry images inline as base64, so large
+// bodies are image uploads.
+const DefaultUploadThreshold = 64 << 10
+
+// Default limits per client
+var (
+	DefaultReadLimit   = Limit{Requests: 600, Per: time.Minute}
+	DefaultWriteLimit  = Limit{Requests: 120, Per: time.Minute}
+	DefaultUploadLimit = Limit{Requests: 30, Per: time.Minute}
+	DefaultAuthLimit   = Limit{Requests: 20, Per: time.Minute}
+)
+
+// Limit allows Requests per Per on average, in bursts of up to Burst requests.
+// A zero Burst means Requests. A zero Limit disables limiting.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Disabled reports whether the limit lets every request through
+func (l Limit) Disabled() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate returns the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// ParseLimit parses a limit written as "requests/duration" with an optional
+// ",burst" suffix, for example "60/1m" or "60/1m,10". "off" disables the
+// limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+
+	spec, burst, hasBurst := strings.Cut(s, ",")
+	requests, per, found := strings.Cut(spec, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+
+	var l Limit
+	var err error
+	if l.Requests, err = strconv.Atoi(strings.TrimSpace(requests)); err != nil || l.Requests < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	if l.Per, err = time.ParseDuration(strings.TrimSpace(per)); err != nil || l.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || l.Burst < 1 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+		}
+	}
+	return l, nil
+}
+
+// bucket is a token bucket for one client and request class
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely, after which it
+	// can be dropped and recreated on demand
+	full time.Time
+}
+
+// RateLimiter limits requests per client with token buckets. Clients are
+// identified by API key, then user, then IP address.
+type RateLimiter struct {
+	limits          map[string]Limit
+	uploadThreshold int64
+	trustedProxies  []netip.Prefix
+	now             func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// RateLimitOption configures a RateLimiter
+type RateLimitOption func(*RateLimiter)
+
+// WithLimit sets the limit for a request class
+func WithLimit(class string, l Limit) RateLimitOption {
+	return func(rl *RateLimiter) {
+		rl.limits[class] = l
+	}
+}
+
+// WithUploadThreshold sets the body size from which a write counts as an
+// upload
+func WithUploadThreshold(bytes int64) RateLimitOption {
+	return func(rl *RateLimiter) {
+		if bytes > 0 {
+			rl.uploadThreshold = bytes
+		}
+	}
+}
+
+// WithTrustedProxies sets the proxies whose X-Forwarded-For header is used to
+// find the client IP
+func WithTrustedProxies(prefixes []netip.Prefix) RateLimitOption {
+	return func(rl *RateLimiter) {
+		rl.trustedProxies = prefixes
+	}
+}
+
+func NewRateLimiter(opts ...RateLimitOption) *RateLimiter {
+	rl := &RateLimiter{
+		limits: map[string]Limit{
+			ClassRead:   DefaultReadLimit,
+			ClassWrite:  DefaultWriteLimit,
+			ClassUpload: DefaultUploadLimit,
+			ClassAuth:   DefaultAuthLimit,
+		},
+		uploadThreshold: DefaultUploadThreshold,
+		buckets:         make(map[string]*bucket),
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+	return rl
+}
+
+// Middleware rejects requests over their client's limit with 429 Too Many
+// Requests and a Retry-After header. Every limited response carries
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. It must run
+// after the Authenticator middleware so that clients can be told apart by
+// credential.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := rl.classify(r)
+		limit := rl.limits[class]
+		if limit.Disabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, remaining, reset, retryAfter := rl.take(class+"|"+rl.clientKey(r), limit)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.burst()))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			problem.Error(w, r, http.StatusTooManyRequests, "Retry after "+strconv.Itoa(ceilSeconds(retryAfter))+" seconds")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthFailures limits how many requests with credentials that fail
+// authentication a client IP may send. It must run before the Authenticator
+// middleware: a request reserves a token before its credentials are checked
+// and gets it back unless it is answered with 401, so an IP that has used up
+// its failures gets 429 Too Many Requests without its credentials being
+// looked up or verified. This bounds API key guessing and the signature
+// checks an attacker can cause.
+func (rl *RateLimiter) AuthFailures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := rl.limits[ClassAuth]
+		if limit.Disabled() || !hasCredentials(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := ClassAuth + "|ip:" + ClientIP(r, rl.trustedProxies)
+		allowed, _, _, retryAfter := rl.take(key, limit)
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			problem.Error(w, r, http.StatusTooManyRequests, "Too many failed authentication attempts, retry after "+strconv.Itoa(ceilSeconds(retryAfter))+" seconds")
+			return
+		}
+
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		if rec.Status() != http.StatusUnauthorized {
+			rl.refund(key, limit)
+		}
+	})
+}
+
+// hasCredentials reports whether r carries an API key or bearer token
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("X-API-Key") != "" || r.Header.Get("Authorization") != ""
+}
+
+// classify returns the request class of r
+func (rl *RateLimiter) classify(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ClassRead
+	}
+	// Bodies of unknown length are treated as uploads
+	if r.ContentLength < 0 || r.ContentLength >= rl.uploadThreshold {
+		return ClassUpload
+	}
+	return ClassWrite
+}
+
+// clientKey identifies the client sending r
+func (rl *RateLimiter) clientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		if p.KeyID != "" {
+			return "key:" + p.KeyID
+		}
+		return "user:" + p.UserID
+	}
+	return "ip:" + ClientIP(r, rl.trustedProxies)
+}
+
+// take removes a token from the bucket stored under key. It returns whether a
+// token was available, how many are left, how long until the bucket is full
+// again and, if no token was available, how long until one is.
+func (rl *RateLimiter) take(key string, limit Limit) (allowed bool, remaining int, reset, retryAfter time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	burst := float64(limit.burst())
+	rate := limit.rate()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = true
+	} else {
+		retryAfter = seconds((1 - b.tokens) / rate)
+	}
+	reset = seconds((burst - b.tokens) / rate)
+	b.full = now.Add(reset)
+	return allowed, int(b.tokens), reset, retryAfter
+}
+
+// refund returns a token taken from the bucket stored under key
+func (rl *RateLimiter) refund(key string, limit Limit) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if b, ok := rl.buckets[key]; ok {
+		b.tokens = math.Min(float64(limit.burst()), b.tokens+1)
+	}
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute;
+// callers hold rl.mu
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+	for key, b := range rl.buckets {
+		if !now.Before(b.full) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"service/auth"
+	"service/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	now := time.Now()
+	rl := NewRateLimiter(
+		WithLimit(ClassRead, Limit{Requests: 2, Per: time.Minute}),
+		WithLimit(ClassWrite, Limit{Requests: 60, Per: time.Minute, Burst: 1}),
+		WithLimit(ClassUpload, Limit{}),
+		WithUploadThreshold(10),
+	)
+	rl.now = func() time.Time { return now }
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(method, body, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/items", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Reads: burst of two, then limited
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := send(http.MethodGet, "", "192.0.2.1:1234")
+		if w.Code != http.StatusOK {
+			t.Fatalf("read %d: expected status %d, got %d", i, http.StatusOK, w.Code)
+		}
+		if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != wantRemaining {
+			t.Errorf("read %d: unexpected headers %v", i, w.Header())
+		}
+	}
+	w := send(http.MethodGet, "", "192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("Expected RateLimit-Reset 60, got %q", w.Header().Get("RateLimit-Reset"))
+	}
+
+	// Other clients and other classes have their own buckets
+	if w := send(http.MethodGet, "", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "{}", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected write to be allowed, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "{}", "192.0.2.1:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected second write to be limited, got %d", w.Code)
+	}
+	// Uploads are unlimited in this configuration and carry no headers
+	if w := send(http.MethodPost, `{"image":"data:image/png;base64,AAAA"}`, "192.0.2.1:1234"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("Expected unlimited upload, got %d %v", w.Code, w.Header())
+	}
+
+	// Tokens refill over time
+	now = now.Add(30 * time.Second)
+	if w := send(http.MethodGet, "", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected a refilled token, got %d", w.Code)
+	}
+}
+
+// noCredentials is a credential store without keys or users
+type noCredentials struct{}
+
+func (noCredentials) GetAPIKeyByHash(string) (models.APIKey, error) {
+	return models.APIKey{}, errors.New("not found")
+}
+
+func (noCredentials) GetUser(string) (models.User, error) {
+	return models.User{}, errors.New("not found")
+}
+
+func TestRateLimiter_AuthFailures(t *testing.T) {
+	now := time.Now()
+	rl := NewRateLimiter(WithLimit(ClassAuth, Limit{Requests: 3, Per: time.Minute}))
+	rl.now = func() time.Time { return now }
+	authenticator := auth.NewAuthenticator(noCredentials{}, auth.WithBootstrapKey("good-key"))
+	handler := rl.AuthFailures(authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	send := func(key, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Successful authentications do not use up the limit
+	for i := 0; i < 5; i++ {
+		if code := send("good-key", "192.0.2.1:1234"); code != http.StatusOK {
+			t.Fatalf("good key %d: expected status %d, got %d", i, http.StatusOK, code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if code := send("guess", "192.0.2.1:1234"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected status %d, got %d", i, http.StatusUnauthorized, code)
+		}
+	}
+	if code := send("guess", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected repeated failures to be limited, got %d", code)
+	}
+	if code := send("good-key", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected credentials from the limited IP not to be checked, got %d", code)
+	}
+
+	// Anonymous requests and other clients are not affected
+	if code := send("", "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("Expected anonymous request to pass, got %d", code)
+	}
+	if code := send("guess", "192.0.2.2:1234"); code != http.StatusUnauthorized {
+		t.Errorf("Expected another client to be authenticated, got %d", code)
+	}
+
+	now = now.Add(20 * time.Second)
+	if code := send("good-key", "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("Expected a refilled token, got %d", code)
+	}
+}
+
+func TestRateLimiter_ClientKey(t *testing.T) {
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+	rl := NewRateLimiter(WithTrustedProxies(trusted))
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"api key", &auth.Principal{UserID: "user-1", KeyID: "key-1"}, "192.0.2.1:1", "", "key:key-1"},
+		{"user", &auth.Principal{UserID: "user-1"}, "192.0.2.1:1", "", "user:user-1"},
+		{"ip", nil, "192.0.2.1:1", "", "ip:192.0.2.1"},
+		{"untrusted proxy", nil, "192.0.2.1:1", "198.51.100.7", "ip:192.0.2.1"},
+		{"trusted proxy", nil, "10.1.2.3:1", "198.51.100.7", "ip:198.51.100.7"},
+		{"forged hop", nil, "10.1.2.3:1", "203.0.113.9, 198.51.100.7, 10.4.4.4", "ip:198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+			if got := rl.clientKey(req); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"60/1m", Limit{Requests: 60, Per: time.Minute}, false},
+		{"10/1s,20", Limit{Requests: 10, Per: time.Second, Burst: 20}, false},
+		{"off", Limit{}, false},
+		{"60", Limit{}, true},
+		{"x/1m", Limit{}, true},
+		{"60/forever", Limit{}, true},
+		{"60/1m,0", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q): unexpected error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q): expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies("10.0.0.0/8, 169.254.1.1,::1")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "169.254.1.1/32", "::1/128"}
+	for i, p := range prefixes {
+		if p != netip.MustParsePrefix(want[i]) {
+			t.Errorf("Expected %s, got %s", want[i], p)
+		}
+	}
+	if _, err := ParseTrustedProxies("not-an-ip"); err == nil {
+		t.Error("Expected error for invalid proxy")
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"service/logger"
+)
+
+// Request correlation headers
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+	// CloudTraceHeader is set by Google's load balancers in front of Cloud Run
+	CloudTraceHeader = "X-Cloud-Trace-Context"
+)
+
+// maxRequestIDLength bounds client supplied request IDs, which end up in
+// every log entry of the request
+const maxRequestIDLength = 128
+
+// RequestContext gives every request an ID and W3C trace context. It keeps a
+// valid X-Request-ID and continues the trace of a valid traceparent or
+// X-Cloud-Trace-Context header, generating whatever is missing, with a new
+// span for this server. Both are echoed in the response and carried in the
+// request context for logger's Context functions.
+func RequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := logger.Trace{RequestID: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(t.RequestID) {
+			t.RequestID = uuid.NewString()
+		}
+
+		var ok bool
+		if t.TraceID, t.ParentSpanID, t.Sampled, ok = parseTraceparent(r.Header.Get(TraceparentHeader)); !ok {
+			if t.TraceID, t.ParentSpanID, t.Sampled, ok = parseCloudTrace(r.Header.Get(CloudTraceHeader)); !ok {
+				t.TraceID, t.Sampled = randomHex(16), false
+			}
+		}
+		t.SpanID = randomHex(8)
+
+		w.Header().Set(RequestIDHeader, t.RequestID)
+		w.Header().Set(TraceparentHeader, formatTraceparent(t))
+		next.ServeHTTP(w, r.WithContext(logger.WithTrace(r.Context(), t)))
+	})
+}
+
+// validRequestID accepts IDs of letters, digits and common separators, so
+// that clients cannot inject arbitrary text into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !isAlphanumeric(c) && !strings.ContainsRune("-_.:/+=", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// parseTraceparent returns the trace ID, parent span ID and sampled flag of
+// a W3C traceparent header such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceparent(header string) (traceID, parentID string, sampled bool, ok bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 {
+		return "", "", false, false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", false, false
+	}
+	if !isHex(traceID, 32) || isZero(traceID) || !isHex(parentID, 16) || isZero(parentID) || !isHex(flags, 2) {
+		return "", "", false, false
+	}
+	b, _ := hex.DecodeString(flags)
+	return traceID, parentID, b[0]&1 == 1, true
+}
+
+// parseCloudTrace returns the trace ID, parent span ID and sampled flag of an
+// X-Cloud-Trace-Context header such as 105445aa7843bc8bf206b12000100000/1;o=1,
+// whose span ID is decimal
+func parseCloudTrace(header string) (traceID, parentID string, sampled bool, ok bool) {
+	traceID, rest, _ := strings.Cut(header, "/")
+	traceID = strings.ToLower(traceID)
+	if !isHex(traceID, 32) || isZero(traceID) {
+		return "", "", false, false
+	}
+	span, options, _ := strings.Cut(rest, ";")
+	if id, err := strconv.ParseUint(span, 10, 64); err == nil && id != 0 {
+		parentID = fmt.Sprintf("%016x", id)
+	}
+	return traceID, parentID, options == "o=1", true
+}
+
+func formatTraceparent(t logger.Trace) string {
+	flags := "00"
+	if t.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", t.TraceID, t.SpanID, flags)
+}
+
+// isHex reports whether s is n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
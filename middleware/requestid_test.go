@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"service/logger"
+)
+
+func TestRequestContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantID      string
+		wantTraceID string
+		wantSampled bool
+	}{
+		{
+			name:        "continues traceparent",
+			headers:     map[string]string{"X-Request-ID": "req-42", "traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			wantID:      "req-42",
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSampled: true,
+		},
+		{
+			name:        "future traceparent version",
+			headers:     map[string]string{"traceparent": "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"},
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:        "falls back to Cloud trace header",
+			headers:     map[string]string{"X-Cloud-Trace-Context": "105445AA7843BC8BF206B12000100000/1;o=1"},
+			wantTraceID: "105445aa7843bc8bf206b12000100000",
+			wantSampled: true,
+		},
+		{
+			name:    "invalid headers are replaced",
+			headers: map[string]string{"X-Request-ID": "bad id\nINFO forged", "traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got logger.Trace
+			handler := RequestContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = logger.TraceFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if tt.wantID != "" && got.RequestID != tt.wantID {
+				t.Errorf("Expected request ID %q, got %q", tt.wantID, got.RequestID)
+			}
+			if !validRequestID(got.RequestID) {
+				t.Errorf("Expected a valid request ID, got %q", got.RequestID)
+			}
+			if tt.wantTraceID != "" && got.TraceID != tt.wantTraceID {
+				t.Errorf("Expected trace ID %q, got %q", tt.wantTraceID, got.TraceID)
+			}
+			if !isHex(got.TraceID, 32) || isZero(got.TraceID) || !isHex(got.SpanID, 16) {
+				t.Errorf("Expected valid trace and span IDs, got %+v", got)
+			}
+			if got.SpanID == "00f067aa0ba902b7" {
+				t.Error("Expected a new span ID for this server")
+			}
+			if got.Sampled != tt.wantSampled {
+				t.Errorf("Expected sampled %v, got %v", tt.wantSampled, got.Sampled)
+			}
+
+			if id := w.Header().Get("X-Request-ID"); id != got.RequestID {
+				t.Errorf("Expected X-Request-ID %q echoed, got %q", got.RequestID, id)
+			}
+			if tp := w.Header().Get("traceparent"); tp != formatTraceparent(got) {
+				t.Errorf("Expected traceparent %q echoed, got %q", formatTraceparent(got), tp)
+			}
+		})
+	}
+}
+
+func TestRequestContext_LogEntries(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	entries := captureLog(t)
+	handler := RequestContext(NewAccessLog().Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.ErrorContext(r.Context(), "Error creating item", nil)
+		logger.Error("Unrelated", nil)
+		w.WriteHeader(http.StatusInternalServerError)
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("{}"))
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	logged := entries()
+	if len(logged) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(logged))
+	}
+	for _, i := range []int{0, 2} {
+		entry := logged[i]
+		if entry.RequestID != "req-42" || entry.Trace != "4bf92f3577b34da6a3ce929d0e0e4736" || entry.SpanID == "" || !entry.TraceSampled {
+			t.Errorf("Expected %q to carry the request ID and trace, got %+v", entry.Message, entry)
+		}
+	}
+	if logged[1].RequestID != "" || logged[1].Trace != "" {
+		t.Errorf("Expected entry without context to carry no trace, got %+v", logged[1])
+	}
+}
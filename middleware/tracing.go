@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"service/tracing"
+)
+
+// HTTPTracing records a server span for every request
+type HTTPTracing struct {
+	tracer *tracing.Tracer
+	route  func(path string) string
+}
+
+// NewHTTPTracing returns middleware starting spans with tracer. route maps a
+// path to the route the span is named after, such as "/items/{id}".
+func NewHTTPTracing(tracer *tracing.Tracer, route func(path string) string) *HTTPTracing {
+	return &HTTPTracing{tracer: tracer, route: route}
+}
+
+// Middleware traces every request passed to next. It must be wrapped by
+// RequestContext, whose trace and span IDs the span takes.
+func (t *HTTPTracing) Middleware(next http.Handler) http.Handler {
+	if !t.tracer.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := t.route(r.URL.Path)
+		name := r.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := t.tracer.StartRequest(r.Context(), name)
+		defer span.End()
+
+		rec := newResponseRecorder(w)
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.Status()
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		if route != "" {
+			span.SetAttribute("http.route", route)
+		}
+		span.SetAttribute("http.response.status_code", status)
+		span.SetAttribute("http.request.body.size", requestSize(r, body))
+		span.SetAttribute("http.response.body.size", rec.bytes)
+		span.SetAttribute("user_agent.original", r.UserAgent())
+		if status >= 500 {
+			span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"service/logger"
+	"service/tracing"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*tracing.Span
+}
+
+func (e *memoryExporter) ExportSpan(service string, span *tracing.Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func TestHTTPTracing(t *testing.T) {
+	exporter := &memoryExporter{}
+	route := func(path string) string {
+		if strings.HasPrefix(path, "/items/") {
+			return "/items/{id}"
+		}
+		return ""
+	}
+	tr := NewHTTPTracing(tracing.NewTracer(exporter), route)
+
+	var inner *tracing.Span
+	var logged logger.Trace
+	handler := RequestContext(tr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ctx context.Context
+		ctx, inner = tracing.NewTracer(exporter).Start(r.Context(), "storage.get")
+		inner.End()
+		logged, _ = logger.TraceFromContext(ctx)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("boom"))
+	})))
+
+	req := httptest.NewRequest(http.MethodPut, "/items/abc", strings.NewReader(`{"count":1}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(exporter.spans))
+	}
+	server := exporter.spans[1]
+	if server.Name != "PUT /items/{id}" || server.Kind != tracing.SpanKindServer {
+		t.Errorf("Unexpected server span %+v", server)
+	}
+	if server.ParentSpanID != "00f067aa0ba902b7" || !strings.Contains(w.Header().Get("traceparent"), server.SpanID) {
+		t.Errorf("Expected the server span to continue the caller's trace under the echoed span ID, got %+v", server)
+	}
+	if inner.ParentSpanID != server.SpanID || logged.SpanID != inner.SpanID {
+		t.Error("Expected work in the handler to be traced under the server span")
+	}
+	want := map[string]interface{}{
+		"http.request.method":       http.MethodPut,
+		"http.route":                "/items/{id}",
+		"http.response.status_code": http.StatusInternalServerError,
+		"http.request.body.size":    int64(11),
+		"http.response.body.size":   int64(4),
+	}
+	for k, v := range want {
+		if server.Attributes[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, server.Attributes[k])
+		}
+	}
+	if server.Status != tracing.StatusError {
+		t.Error("Expected server errors to mark the span as failed")
+	}
+}
+
+func TestHTTPTracing_Disabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tr := NewHTTPTracing(tracing.NewTracer(nil), func(string) string { return "" })
+	w := httptest.NewRecorder()
+	tr.Middleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the request to pass through, got %d", w.Code)
+	}
+}
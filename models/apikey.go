@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// API key scopes
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// APIKey is a credential issued to a user. Only a hash of the key is stored;
+// the key itself is shown once, when it is created.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	UserID    string     `json:"userId"`
+	Scopes    []string   `json:"scopes"`
+	Prefix    string     `json:"prefix"`         // First characters of the key, to help users tell keys apart
+	Hash      string     `json:"hash,omitempty"` // SHA-256 of the key, never returned by the API
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
@@ -4,15 +4,30 @@ import "time"
 
 // MushroomSighting represents a mushroom sighting record
 type MushroomSighting struct {
-	ID           string    `json:"id"`
-	Image        *string   `json:"image,omitempty"`        // Optional base64 encoded image
-	MushroomName string    `json:"mushroomName,omitempty"` // Optional user identification
-	DateTime     time.Time `json:"dateTime"`               // When the mushroom was found
-	Location     string    `json:"location"`               // Where the mushroom was found
-	Count        int       `json:"count"`                  // Number of mushrooms found
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string     `json:"id"`
+	Image        *string    `json:"image,omitempty"`        // Optional base64 encoded image
+	MushroomName string     `json:"mushroomName,omitempty"` // Optional user identification
+	DateTime     time.Time  `json:"dateTime"`               // When the mushroom was found
+	Location     string     `json:"location"`               // Where the mushroom was found
+	Latitude     *float64   `json:"latitude,omitempty"`     // Optional WGS 84 coordinates of the find
+	Longitude    *float64   `json:"longitude,omitempty"`    // Required together with latitude
+	Visibility   string     `json:"visibility,omitempty"`   // Who may see the exact location, public if empty
+	Count        int        `json:"count"`                  // Number of mushrooms found
+	Owner        string     `json:"owner,omitempty"`        // ID of the user who created the sighting
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UpdatedBy    string     `json:"updatedBy,omitempty"` // Who made the last change
+	Revision     int64      `json:"revision"`            // Store revision of the last change, assigned by the server
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"` // When the sighting was moved to the trash
 }
 
+// Sighting visibilities. Obscured sightings are shown to everyone but the
+// owner with coarse coordinates; private sightings without any location.
+const (
+	VisibilityPublic   = "public"
+	VisibilityObscured = "obscured"
+	VisibilityPrivate  = "private"
+)
+
 // Item is kept for backwards compatibility, aliased to MushroomSighting
 type Item = MushroomSighting
@@ -0,0 +1,153 @@
+package privacy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"service/models"
+)
+
+// DefaultGrid is the size, in degrees, of the grid obscured coordinates are
+// snapped to; 0.1 degrees of latitude are about 11 km
+const DefaultGrid = 0.1
+
+// RedactedLocation replaces the free-text location of sightings whose
+// location is obscured or private
+const RedactedLocation = "[redacted]"
+
+// Policy decides how precisely the location of a sighting may be shown to
+// someone other than its owner
+type Policy struct {
+	grid float64
+	// species maps lower-cased species names to their minimum visibility
+	species map[string]string
+}
+
+// Option configures a Policy
+type Option func(*Policy)
+
+// WithGrid sets the grid size, in degrees, obscured coordinates are snapped
+// to
+func WithGrid(degrees float64) Option {
+	return func(p *Policy) {
+		if degrees > 0 {
+			p.grid = degrees
+		}
+	}
+}
+
+// WithSensitiveSpecies sets the minimum visibility of sightings of the given
+// species, keyed by species name
+func WithSensitiveSpecies(species map[string]string) Option {
+	return func(p *Policy) {
+		for name, visibility := range species {
+			p.species[strings.ToLower(strings.TrimSpace(name))] = visibility
+		}
+	}
+}
+
+func NewPolicy(opts ...Option) *Policy {
+	p := &Policy{
+		grid:    DefaultGrid,
+		species: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// ValidVisibility reports whether v is a known visibility. The empty string is
+// valid and means public.
+func ValidVisibility(v string) bool {
+	switch v {
+	case "", models.VisibilityPublic, models.VisibilityObscured, models.VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// Stricter returns the more restrictive of two visibilities
+func Stricter(a, b string) string {
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+func rank(v string) int {
+	switch v {
+	case models.VisibilityObscured:
+		return 1
+	case models.VisibilityPrivate:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Visibility returns the visibility that applies to item: the one chosen by
+// its owner or, if stricter, the one configured for its species
+func (p *Policy) Visibility(item models.Item) string {
+	v := Stricter(item.Visibility, p.species[strings.ToLower(strings.TrimSpace(item.MushroomName))])
+	if v == "" {
+		return models.VisibilityPublic
+	}
+	return v
+}
+
+// Redact returns item as it may be shown to someone other than its owner
+func (p *Policy) Redact(item models.Item) models.Item {
+	return p.Apply(item, p.Visibility(item))
+}
+
+// Apply hides the location of item as required by visibility. Obscured
+// coordinates are snapped to the centre of their grid cell rather than
+// randomly jittered, so that repeated requests cannot be averaged out.
+func (p *Policy) Apply(item models.Item, visibility string) models.Item {
+	switch visibility {
+	case models.VisibilityObscured:
+		item.Location = RedactedLocation
+		if item.Latitude != nil && item.Longitude != nil {
+			lat := math.Max(-90, math.Min(90, p.snap(*item.Latitude)))
+			lon := p.snap(*item.Longitude)
+			item.Latitude = &lat
+			item.Longitude = &lon
+		}
+	case models.VisibilityPrivate:
+		item.Location = RedactedLocation
+		item.Latitude = nil
+		item.Longitude = nil
+	}
+	return item
+}
+
+// snap returns the centre of the grid cell containing v
+func (p *Policy) snap(v float64) float64 {
+	return (math.Floor(v/p.grid) + 0.5) * p.grid
+}
+
+// ParseSensitiveSpecies parses a comma separated list of species with an
+// optional minimum visibility each, such as "Morel,Matsutake:private".
+// Species without a visibility are obscured.
+func ParseSensitiveSpecies(s string) (map[string]string, error) {
+	species := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, visibility, found := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		visibility = strings.TrimSpace(visibility)
+		if !found {
+			visibility = models.VisibilityObscured
+		}
+		if name == "" || visibility == "" || !ValidVisibility(visibility) {
+			return nil, fmt.Errorf("invalid sensitive species entry %q", entry)
+		}
+		species[name] = visibility
+	}
+	return species, nil
+}
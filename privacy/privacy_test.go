@@ -0,0 +1,92 @@
+package privacy
+
+import (
+	"service/models"
+	"testing"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestPolicy_Visibility(t *testing.T) {
+	policy := NewPolicy(WithSensitiveSpecies(map[string]string{
+		"Morel":     models.VisibilityObscured,
+		"Matsutake": models.VisibilityPrivate,
+	}))
+
+	tests := []struct {
+		name       string
+		item       models.Item
+		visibility string
+	}{
+		{"default", models.Item{MushroomName: "Chanterelle"}, models.VisibilityPublic},
+		{"owner choice", models.Item{MushroomName: "Chanterelle", Visibility: models.VisibilityPrivate}, models.VisibilityPrivate},
+		{"sensitive species", models.Item{MushroomName: "morel "}, models.VisibilityObscured},
+		{"stricter owner choice wins", models.Item{MushroomName: "Morel", Visibility: models.VisibilityPrivate}, models.VisibilityPrivate},
+		{"stricter species wins", models.Item{MushroomName: "Matsutake", Visibility: models.VisibilityPublic}, models.VisibilityPrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Visibility(tt.item); got != tt.visibility {
+				t.Errorf("Expected visibility %s, got %s", tt.visibility, got)
+			}
+		})
+	}
+}
+
+func TestPolicy_Apply(t *testing.T) {
+	policy := NewPolicy(WithGrid(0.1))
+	item := models.Item{Location: "Behind the old oak", Latitude: float(52.5234), Longitude: float(-13.4171)}
+
+	public := policy.Apply(item, models.VisibilityPublic)
+	if public.Location != item.Location || *public.Latitude != 52.5234 {
+		t.Errorf("Expected public sighting unchanged, got %+v", public)
+	}
+
+	obscured := policy.Apply(item, models.VisibilityObscured)
+	if obscured.Location != RedactedLocation {
+		t.Errorf("Expected redacted location, got %q", obscured.Location)
+	}
+	if diff := *obscured.Latitude - 52.55; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("Expected latitude snapped to 52.55, got %v", *obscured.Latitude)
+	}
+	if diff := *obscured.Longitude - -13.45; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("Expected longitude snapped to -13.45, got %v", *obscured.Longitude)
+	}
+	if *item.Latitude != 52.5234 {
+		t.Error("Expected the original item to be left untouched")
+	}
+
+	private := policy.Apply(item, models.VisibilityPrivate)
+	if private.Location != RedactedLocation || private.Latitude != nil || private.Longitude != nil {
+		t.Errorf("Expected no location for private sighting, got %+v", private)
+	}
+}
+
+func TestParseSensitiveSpecies(t *testing.T) {
+	species, err := ParseSensitiveSpecies("Morel, Matsutake:private ,Porcini:public")
+	if err != nil {
+		t.Fatalf("ParseSensitiveSpecies failed: %v", err)
+	}
+	want := map[string]string{
+		"Morel":     models.VisibilityObscured,
+		"Matsutake": models.VisibilityPrivate,
+		"Porcini":   models.VisibilityPublic,
+	}
+	if len(species) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, species)
+	}
+	for name, v := range want {
+		if species[name] != v {
+			t.Errorf("Expected %s to be %s, got %s", name, v, species[name])
+		}
+	}
+
+	for _, invalid := range []string{"Morel:secret", ":private", "Morel:"} {
+		if _, err := ParseSensitiveSpecies(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package problem writes error responses as RFC 7807 problem details, so that
+// clients can tell errors apart by type and field instead of by message.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"service/logger"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// Problem types. Errors that the status code alone describes use TypeBlank and
+// the status text as title.
+const (
+	TypeBlank = "about:blank"
+	// TypeValidation is a request body or parameter that breaks a rule,
+	// listed in Errors
+	TypeValidation = "/problems/validation-error"
+	// TypeInvalidBody is a request body that cannot be parsed
+	TypeInvalidBody = "/problems/invalid-body"
+	// TypeAlreadyExists is a create with an ID that is taken
+	TypeAlreadyExists = "/problems/already-exists"
+	// TypeIdempotencyMismatch is an Idempotency-Key reused with another body
+	TypeIdempotencyMismatch = "/problems/idempotency-key-reused"
+	// TypeIdempotencyInProgress is a retry while the first request with its
+	// Idempotency-Key is still running
+	TypeIdempotencyInProgress = "/problems/idempotency-key-in-progress"
+	// TypeChangeTokenExpired is a sync change token that needs a full sync
+	TypeChangeTokenExpired = "/problems/change-token-expired"
+)
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors lists the fields that made the request invalid
+	Errors []FieldError `json:"errors,omitempty"`
+	// RequestID identifies the request in logs and traces
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// New returns a problem of type TypeBlank for status
+func New(status int, detail string) *Problem {
+	return &Problem{Type: TypeBlank, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Typed returns a problem of type typ for status
+func Typed(typ string, status int, title, detail string) *Problem {
+	return &Problem{Type: typ, Title: title, Status: status, Detail: detail}
+}
+
+// FieldError is a rule broken by one field of a request. Field is a JSON
+// pointer such as /location for body fields, or the name of a query
+// parameter. Code is one of the Code constants.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// Field error codes
+const (
+	CodeRequired = "required"
+	CodeMin      = "min"
+	CodeMax      = "max"
+	CodeFormat   = "format"
+)
+
+func (e *FieldError) Error() string {
+	return e.Detail
+}
+
+// Invalid returns a FieldError for field
+func Invalid(field, code, detail string) *FieldError {
+	return &FieldError{Field: field, Code: code, Detail: detail}
+}
+
+// Validation returns a 400 problem listing every FieldError in err, which may
+// join several. Other errors become the detail.
+func Validation(err error) *Problem {
+	p := Typed(TypeValidation, http.StatusBadRequest, "Validation failed", "")
+	var details []string
+	for _, e := range flatten(err) {
+		details = append(details, e.Error())
+	}
+	p.Detail = strings.Join(details, "; ")
+	p.Errors = FieldErrors(err)
+	return p
+}
+
+// FieldErrors returns every FieldError in err, which may join several
+func FieldErrors(err error) []FieldError {
+	var fields []FieldError
+	for _, e := range flatten(err) {
+		var fe *FieldError
+		if errors.As(e, &fe) {
+			fields = append(fields, *fe)
+		}
+	}
+	return fields
+}
+
+// flatten returns the errors joined in err
+func flatten(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flatten(e)...)
+	}
+	return errs
+}
+
+// Write writes p as the response to r. The instance defaults to the request
+// path.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if trace, ok := logger.TraceFromContext(r.Context()); ok {
+		p.RequestID = trace.RequestID
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error replies to r with a problem of type TypeBlank. It replaces http.Error.
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// MethodNotAllowed replies with 405 and the Allow header listing allowed
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	Error(w, r, http.StatusMethodNotAllowed, r.Method+" is not supported; use "+strings.Join(allowed, " or "))
+}
@@ -0,0 +1,88 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"service/logger"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/items/abc", nil)
+	req = req.WithContext(logger.WithTrace(req.Context(), logger.Trace{RequestID: "req-1"}))
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Length", "12")
+	Error(w, req, http.StatusNotFound, "Item not found")
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Expected Content-Type %s, got %s", ContentType, got)
+	}
+	if w.Header().Get("Content-Length") != "" {
+		t.Error("Expected a stale Content-Length to be removed")
+	}
+	var got Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	want := Problem{Type: TypeBlank, Title: "Not Found", Status: http.StatusNotFound, Detail: "Item not found", Instance: "/items/abc", RequestID: "req-1"}
+	if got.Type != want.Type || got.Title != want.Title || got.Status != want.Status || got.Detail != want.Detail ||
+		got.Instance != want.Instance || got.RequestID != want.RequestID {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantFields []string
+		wantDetail string
+	}{
+		{"one field", Invalid("/count", CodeMin, "count must be at least 1"), []string{"/count"}, "count must be at least 1"},
+		{
+			"joined fields",
+			errors.Join(Invalid("/location", CodeRequired, "location is required"), errors.Join(Invalid("/count", CodeMin, "count must be at least 1"))),
+			[]string{"/location", "/count"},
+			"location is required; count must be at least 1",
+		},
+		{"plain error", errors.New("item is required"), nil, "item is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Validation(tt.err)
+			if p.Type != TypeValidation || p.Status != http.StatusBadRequest {
+				t.Errorf("Unexpected problem %+v", p)
+			}
+			if p.Detail != tt.wantDetail {
+				t.Errorf("Expected detail %q, got %q", tt.wantDetail, p.Detail)
+			}
+			if len(p.Errors) != len(tt.wantFields) {
+				t.Fatalf("Expected %d field errors, got %+v", len(tt.wantFields), p.Errors)
+			}
+			for i, field := range tt.wantFields {
+				if p.Errors[i].Field != field {
+					t.Errorf("Expected error %d on %s, got %+v", i, field, p.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	MethodNotAllowed(w, httptest.NewRequest(http.MethodPatch, "/items", nil), http.MethodGet, http.MethodPost)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, POST" {
+		t.Errorf("Expected Allow: GET, POST, got %q", got)
+	}
+}
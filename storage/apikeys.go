@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"service/models"
+)
+
+// CreateAPIKey stores a new API key. The ID and the hash must both be unique.
+func (s *Store) CreateAPIKey(key models.APIKey) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.apiKeys[key.ID]; exists {
+		return models.APIKey{}, ErrAlreadyExists
+	}
+	if _, exists := s.keyHashes[key.Hash]; exists {
+		return models.APIKey{}, ErrAlreadyExists
+	}
+
+	s.apiKeys[key.ID] = key
+	s.keyHashes[key.Hash] = key.ID
+	return key, s.save(context.Background())
+}
+
+// GetAPIKeys retrieves all API keys, including revoked ones, ordered by
+// creation time
+func (s *Store) GetAPIKeys() []models.APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys
+}
+
+// GetAPIKeyByHash finds the API key with the given hash. Revoked keys are
+// returned too; callers must check RevokedAt.
+func (s *Store) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	defer observe("get_api_key", time.Now())
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.keyHashes[hash]
+	if !exists {
+		return models.APIKey{}, ErrNotFound
+	}
+	return s.apiKeys[id], nil
+}
+
+// RevokeAPIKey marks an API key as revoked. Revoking a key twice keeps the
+// original revocation time. The key stays in the hash index so that requests
+// using it are told it was revoked.
+func (s *Store) RevokeAPIKey(id string) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists {
+		return models.APIKey{}, ErrNotFound
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	s.apiKeys[id] = key
+	return key, s.save(context.Background())
+}
+
+// indexAPIKeys rebuilds the hash index from the loaded keys; callers hold s.mu
+func (s *Store) indexAPIKeys() {
+	s.keyHashes = make(map[string]string, len(s.apiKeys))
+	for id, key := range s.apiKeys {
+		s.keyHashes[key.Hash] = id
+	}
+}
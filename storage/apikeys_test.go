@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"service/models"
+	"testing"
+	"time"
+)
+
+func TestStore_APIKeys(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	key := models.APIKey{ID: "key-1", Name: "phone", UserID: "user-1", Scopes: []string{models.ScopeRead}, Hash: "abc", CreatedAt: time.Now()}
+	if _, err := store.CreateAPIKey(key); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if _, err := store.CreateAPIKey(key); err != ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists, got %v", err)
+	}
+	duplicate := key
+	duplicate.ID = "key-2"
+	if _, err := store.CreateAPIKey(duplicate); err != ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists for a duplicate hash, got %v", err)
+	}
+
+	found, err := store.GetAPIKeyByHash("abc")
+	if err != nil || found.ID != "key-1" {
+		t.Fatalf("GetAPIKeyByHash returned %+v, %v", found, err)
+	}
+	if _, err := store.GetAPIKeyByHash("other"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	revoked, err := store.RevokeAPIKey("key-1")
+	if err != nil || revoked.RevokedAt == nil {
+		t.Fatalf("RevokeAPIKey returned %+v, %v", revoked, err)
+	}
+	again, _ := store.RevokeAPIKey("key-1")
+	if !again.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Error("Expected revoking twice to keep the original time")
+	}
+	if _, err := store.RevokeAPIKey("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if found, err := store.GetAPIKeyByHash("abc"); err != nil || found.RevokedAt == nil {
+		t.Errorf("Expected the revoked key by hash, got %+v, %v", found, err)
+	}
+
+	// Keys survive a reload
+	reloaded := newStore(store.filepath)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if keys := reloaded.GetAPIKeys(); len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("Expected revoked key after reload, got %+v", keys)
+	}
+	if found, err := reloaded.GetAPIKeyByHash("abc"); err != nil || found.ID != "key-1" {
+		t.Errorf("Expected the key by hash after reload, got %+v, %v", found, err)
+	}
+}
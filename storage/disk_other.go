@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+import "errors"
+
+// freeSpace is not implemented on this platform
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
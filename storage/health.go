@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotPersisted is returned for checks that only apply to file stores
+var ErrNotPersisted = errors.New("store is not persisted")
+
+// Stats describes the contents of the store and the state of its file
+type Stats struct {
+	Backend    string     `json:"backend"`
+	Path       string     `json:"path,omitempty"`
+	Items      int        `json:"items"`
+	Trash      int        `json:"trash"`
+	Tombstones int        `json:"tombstones"`
+	History    int        `json:"historyEntries"`
+	Users      int        `json:"users"`
+	APIKeys    int        `json:"apiKeys"`
+	Revision   int64      `json:"revision"`
+	FileSize   int64      `json:"fileSizeBytes,omitempty"`
+	LastSave   *time.Time `json:"lastSave,omitempty"`
+	SaveError  string     `json:"saveError,omitempty"`
+}
+
+// Stats returns counts of everything held by the store
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{
+		Backend:    "memory",
+		Path:       s.filepath,
+		Tombstones: len(s.tombstones),
+		Users:      len(s.users),
+		APIKeys:    len(s.apiKeys),
+		Revision:   s.revision,
+	}
+	for _, item := range s.items {
+		if item.DeletedAt != nil {
+			stats.Trash++
+		} else {
+			stats.Items++
+		}
+	}
+	for _, entries := range s.history {
+		stats.History += len(entries)
+	}
+	if !s.lastSave.IsZero() {
+		lastSave := s.lastSave
+		stats.LastSave = &lastSave
+	}
+	if s.saveErr != nil {
+		stats.SaveError = s.saveErr.Error()
+	}
+	if s.filepath != "" {
+		stats.Backend = "file"
+		if info, err := os.Stat(s.filepath); err == nil {
+			stats.FileSize = info.Size()
+		}
+	}
+	return stats
+}
+
+// Check reports whether the store can serve requests: its file was loaded and
+// its directory is writable. Memory stores are always ready.
+func (s *Store) Check() error {
+	s.mu.RLock()
+	path, loadErr := s.filepath, s.loadErr
+	s.mu.RUnlock()
+
+	if path == "" {
+		return nil
+	}
+	if loadErr != nil {
+		return fmt.Errorf("data file not loaded: %w", loadErr)
+	}
+
+	// Saves write a temporary file next to the data file and rename it
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".check-*")
+	if err != nil {
+		return fmt.Errorf("data directory not writable: %w", err)
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	return nil
+}
+
+// FreeSpace returns the number of bytes available to the service on the
+// file system holding the data file
+func (s *Store) FreeSpace() (uint64, error) {
+	if s.filepath == "" {
+		return 0, ErrNotPersisted
+	}
+	return freeSpace(filepath.Dir(s.filepath))
+}
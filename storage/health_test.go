@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"service/models"
+	"testing"
+	"time"
+)
+
+func TestStore_Stats(t *testing.T) {
+	store := newStore(filepath.Join(t.TempDir(), "data.json"))
+	now := time.Now()
+	for _, id := range []string{"test-1", "test-2"} {
+		if _, err := store.Create(t.Context(), models.Item{ID: id, Location: "Forest", Count: 1, DateTime: now}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if err := store.Delete(t.Context(), "test-2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	stats := store.Stats()
+	if stats.Backend != "file" || stats.Items != 1 || stats.Trash != 1 || stats.History != 3 || stats.Revision != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.FileSize == 0 || stats.LastSave == nil || stats.SaveError != "" {
+		t.Errorf("Expected file stats after a successful save, got %+v", stats)
+	}
+
+	if stats := NewMemoryStore().Stats(); stats.Backend != "memory" || stats.Path != "" || stats.LastSave != nil {
+		t.Errorf("Unexpected memory store stats: %+v", stats)
+	}
+}
+
+func TestStore_Check(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := NewMemoryStore().Check(); err != nil {
+		t.Errorf("Expected memory store to be ready, got %v", err)
+	}
+	if err := NewFileStore(filepath.Join(dir, "data.json")).Check(); err != nil {
+		t.Errorf("Expected new file store to be ready, got %v", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := NewFileStore(corrupt).Check(); err == nil {
+		t.Error("Expected error for a data file that failed to load")
+	}
+
+	if err := NewFileStore(filepath.Join(dir, "missing", "data.json")).Check(); err == nil {
+		t.Error("Expected error for a missing data directory")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected checks to leave no files behind, got %v", entries)
+	}
+
+	if _, err := NewMemoryStore().FreeSpace(); err != ErrNotPersisted {
+		t.Errorf("Expected ErrNotPersisted, got %v", err)
+	}
+}
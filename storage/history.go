@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+
+	"service/models"
+)
+
+// History actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+	// ActionImport marks the first known version of an item that predates
+	// revision history
+	ActionImport = "import"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// MaxHistoryEntries is the number of versions kept per item. Older versions
+// are dropped and can no longer be reverted to.
+const MaxHistoryEntries = 50
+
+// HistoryEntry is one version of an item together with who produced it,
+// when, and what changed compared to the previous version
+type HistoryEntry struct {
+	Revision  int64         `json:"revision"`
+	Action    string        `json:"action"`
+	Actor     string        `json:"actor,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+	Item      *models.Item  `json:"item,omitempty"`
+	// ImageDigest identifies the image of Item. Images are stored once per
+	// store rather than in every version, and Item.Image is only set on
+	// entries returned by HistoryAt.
+	ImageDigest string `json:"imageDigest,omitempty"`
+}
+
+// FieldChange describes a changed field. Images are reported as changed
+// without their content.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from,omitempty"`
+	To    interface{} `json:"to,omitempty"`
+}
+
+// record appends the version item to its history; prev is the version it
+// replaces, if any. Callers hold s.mu.
+func (s *Store) record(action string, prev *models.Item, item models.Item) {
+	if s.history == nil {
+		s.history = make(map[string][]HistoryEntry)
+	}
+
+	entry := HistoryEntry{
+		Revision:  item.Revision,
+		Action:    action,
+		Actor:     item.UpdatedBy,
+		Timestamp: time.Now(),
+		Item:      &item,
+	}
+	if prev != nil {
+		entry.Changes = diffItems(*prev, item)
+	}
+	s.detachImage(&entry)
+
+	entries := append(s.history[item.ID], entry)
+	if drop := len(entries) - MaxHistoryEntries; drop > 0 {
+		for _, old := range entries[:drop] {
+			s.releaseImage(old.ImageDigest)
+		}
+		// Copy rather than reslice, so that a rolled back batch can restore
+		// the entries it replaced
+		entries = slices.Clone(entries[drop:])
+	}
+	s.history[item.ID] = entries
+}
+
+// imageDigest identifies an image by its content
+func imageDigest(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// detachImage moves the image of entry's item into the store's image table
+// and references it by digest; callers hold s.mu
+func (s *Store) detachImage(entry *HistoryEntry) {
+	if entry.Item == nil || entry.Item.Image == nil {
+		return
+	}
+	item := *entry.Item
+	digest := imageDigest(*item.Image)
+	if s.images == nil {
+		s.images = make(map[string]string)
+	}
+	s.images[digest] = *item.Image
+	item.Image = nil
+	entry.Item = &item
+	entry.ImageDigest = digest
+	s.retainImage(digest)
+}
+
+// retainImage and releaseImage count the history entries referencing an
+// image. Unreferenced images are pruned when the store is saved, so that a
+// rolled back batch never leaves an entry without its image. Callers hold
+// s.mu.
+func (s *Store) retainImage(digest string) {
+	if digest == "" {
+		return
+	}
+	if s.imageRefs == nil {
+		s.imageRefs = make(map[string]int)
+	}
+	s.imageRefs[digest]++
+}
+
+func (s *Store) releaseImage(digest string) {
+	if digest == "" {
+		return
+	}
+	s.imageRefs[digest]--
+}
+
+// pruneImages drops images no history entry references; callers hold s.mu
+func (s *Store) pruneImages() {
+	for digest := range s.images {
+		if s.imageRefs[digest] <= 0 {
+			delete(s.images, digest)
+			delete(s.imageRefs, digest)
+		}
+	}
+}
+
+// indexImages moves images still stored inline in history entries, as files
+// written before images were stored once do, into the image table and counts
+// references; callers hold s.mu
+func (s *Store) indexImages() {
+	s.imageRefs = make(map[string]int)
+	for id, entries := range s.history {
+		for i := range entries {
+			if entries[i].Item != nil && entries[i].Item.Image != nil {
+				s.detachImage(&entries[i])
+			} else {
+				s.retainImage(entries[i].ImageDigest)
+			}
+		}
+		if drop := len(entries) - MaxHistoryEntries; drop > 0 {
+			for _, old := range entries[:drop] {
+				s.releaseImage(old.ImageDigest)
+			}
+			s.history[id] = slices.Clone(entries[drop:])
+		}
+	}
+	s.pruneImages()
+}
+
+// attachImage returns entry with the image of its item restored; callers hold
+// s.mu
+func (s *Store) attachImage(entry HistoryEntry) HistoryEntry {
+	if entry.Item == nil || entry.ImageDigest == "" {
+		return entry
+	}
+	item := *entry.Item
+	if image, ok := s.images[entry.ImageDigest]; ok {
+		item.Image = &image
+	}
+	entry.Item = &item
+	return entry
+}
+
+// seedHistory gives every item without history an import entry for its
+// current version, so that data written before history was kept can still be
+// reverted to; callers hold s.mu
+func (s *Store) seedHistory() {
+	for id, item := range s.items {
+		if len(s.history[id]) > 0 {
+			continue
+		}
+		if s.history == nil {
+			s.history = make(map[string][]HistoryEntry)
+		}
+		item := item
+		entry := HistoryEntry{
+			Revision:  item.Revision,
+			Action:    ActionImport,
+			Actor:     item.UpdatedBy,
+			Timestamp: item.UpdatedAt,
+			Item:      &item,
+		}
+		s.detachImage(&entry)
+		s.history[id] = []HistoryEntry{entry}
+	}
+}
+
+// History returns the recorded versions of an item, oldest first, without
+// their images. History is kept for items in the trash and dropped when they
+// are purged.
+func (s *Store) History(ctx context.Context, id string) ([]HistoryEntry, error) {
+	defer observe("history", time.Now())
+	_, span := startSpan(ctx, "history")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.items[id]; !exists {
+		return nil, ErrNotFound
+	}
+
+	entries := make([]HistoryEntry, len(s.history[id]))
+	copy(entries, s.history[id])
+	return entries, nil
+}
+
+// HistoryAt returns the version of an item recorded at revision, with its
+// image
+func (s *Store) HistoryAt(id string, revision int64) (HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.items[id]; !exists {
+		return HistoryEntry{}, ErrNotFound
+	}
+
+	return s.historyAt(id, revision)
+}
+
+// historyAt looks up a history entry; callers hold s.mu
+func (s *Store) historyAt(id string, revision int64) (HistoryEntry, error) {
+	for _, entry := range s.history[id] {
+		if entry.Revision == revision {
+			return s.attachImage(entry), nil
+		}
+	}
+	return HistoryEntry{}, ErrRevisionNotFound
+}
+
+// Revert replaces the content of an active item with the version recorded at
+// revision, if guard allows it. The result is a new version; history is never
+// rewritten.
+func (s *Store) Revert(ctx context.Context, id string, revision int64, actor string, guard Guard) (models.Item, error) {
+	defer observe("revert", time.Now())
+	ctx, span := startSpan(ctx, "revert")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.active(id)
+	if !exists {
+		return models.Item{}, ErrNotFound
+	}
+	if !guard.allows(current) {
+		return models.Item{}, ErrForbidden
+	}
+	entry, err := s.historyAt(id, revision)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	item := *entry.Item
+	item.CreatedAt = current.CreatedAt
+	item.UpdatedAt = time.Now()
+	item.UpdatedBy = actor
+	item.DeletedAt = nil
+
+	item = s.put(ActionRevert, item)
+	return item, s.save(ctx)
+}
+
+// diffItems lists the user-editable fields that differ between two versions
+func diffItems(prev, next models.Item) []FieldChange {
+	var changes []FieldChange
+	if prev.MushroomName != next.MushroomName {
+		changes = append(changes, FieldChange{Field: "mushroomName", From: prev.MushroomName, To: next.MushroomName})
+	}
+	if !prev.DateTime.Equal(next.DateTime) {
+		changes = append(changes, FieldChange{Field: "dateTime", From: prev.DateTime, To: next.DateTime})
+	}
+	if prev.Location != next.Location {
+		changes = append(changes, FieldChange{Field: "location", From: prev.Location, To: next.Location})
+	}
+	if !equalFloat(prev.Latitude, next.Latitude) {
+		changes = append(changes, FieldChange{Field: "latitude", From: floatValue(prev.Latitude), To: floatValue(next.Latitude)})
+	}
+	if !equalFloat(prev.Longitude, next.Longitude) {
+		changes = append(changes, FieldChange{Field: "longitude", From: floatValue(prev.Longitude), To: floatValue(next.Longitude)})
+	}
+	if prev.Visibility != next.Visibility {
+		changes = append(changes, FieldChange{Field: "visibility", From: prev.Visibility, To: next.Visibility})
+	}
+	if prev.Count != next.Count {
+		changes = append(changes, FieldChange{Field: "count", From: prev.Count, To: next.Count})
+	}
+	if (prev.Image == nil) != (next.Image == nil) || (prev.Image != nil && *prev.Image != *next.Image) {
+		changes = append(changes, FieldChange{Field: "image"})
+	}
+	if (prev.DeletedAt == nil) != (next.DeletedAt == nil) {
+		change := FieldChange{Field: "deletedAt"}
+		if prev.DeletedAt != nil {
+			change.From = *prev.DeletedAt
+		}
+		if next.DeletedAt != nil {
+			change.To = *next.DeletedAt
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// equalFloat reports whether two optional numbers are equal
+func equalFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// floatValue unwraps an optional number so that unset values are left out of
+// a FieldChange
+func floatValue(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
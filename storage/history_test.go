@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"service/models"
+	"testing"
+	"time"
+)
+
+func TestStore_HistoryRecordsEveryVersion(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	item := models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 1, DateTime: now, UpdatedBy: "alice"}
+	store.Create(t.Context(), item)
+
+	item.MushroomName = "False chanterelle"
+	item.Count = 3
+	item.UpdatedBy = "bob"
+	store.Update(t.Context(), "test-1", item, nil)
+	store.DeleteBy(t.Context(), "test-1", "carol", nil)
+
+	entries, err := store.History(t.Context(), "test-1")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 history entries, got %d", len(entries))
+	}
+
+	expected := []struct {
+		action string
+		actor  string
+	}{
+		{ActionCreate, "alice"},
+		{ActionUpdate, "bob"},
+		{ActionDelete, "carol"},
+	}
+	for i, e := range expected {
+		if entries[i].Action != e.action || entries[i].Actor != e.actor {
+			t.Errorf("Entry %d: expected %s by %s, got %s by %s", i, e.action, e.actor, entries[i].Action, entries[i].Actor)
+		}
+	}
+
+	changes := entries[1].Changes
+	if len(changes) != 2 || changes[0].Field != "mushroomName" || changes[1].Field != "count" {
+		t.Errorf("Expected mushroomName and count changes, got %+v", changes)
+	}
+	if changes[0].From != "Chanterelle" || changes[0].To != "False chanterelle" {
+		t.Errorf("Unexpected mushroomName diff: %+v", changes[0])
+	}
+}
+
+func TestStore_Revert(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	original, _ := store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 1, DateTime: now})
+
+	edit := original
+	edit.MushroomName = "Wrong"
+	store.Update(t.Context(), "test-1", edit, nil)
+
+	reverted, err := store.Revert(t.Context(), "test-1", original.Revision, "moderator", nil)
+	if err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	if reverted.MushroomName != "Chanterelle" {
+		t.Errorf("Expected MushroomName Chanterelle, got %s", reverted.MushroomName)
+	}
+	if reverted.Revision <= original.Revision {
+		t.Error("Expected revert to create a new revision")
+	}
+
+	entries, _ := store.History(t.Context(), "test-1")
+	last := entries[len(entries)-1]
+	if last.Action != ActionRevert || last.Actor != "moderator" {
+		t.Errorf("Expected revert entry by moderator, got %s by %s", last.Action, last.Actor)
+	}
+
+	if _, err := store.Revert(t.Context(), "test-1", 999, "moderator", nil); err != ErrRevisionNotFound {
+		t.Errorf("Expected ErrRevisionNotFound, got %v", err)
+	}
+	store.Delete(t.Context(), "test-1")
+	if _, err := store.Revert(t.Context(), "test-1", original.Revision, "moderator", nil); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound reverting a deleted item, got %v", err)
+	}
+}
+
+func TestStore_HistoryRolledBackWithBatch(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	item, _ := store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 1, DateTime: now})
+
+	item.Count = 2
+	store.Batch(t.Context(), []Op{
+		{Type: OpUpdate, ID: "test-1", Item: item},
+		{Type: OpDelete, ID: "missing"},
+	}, true)
+
+	entries, _ := store.History(t.Context(), "test-1")
+	if len(entries) != 1 {
+		t.Errorf("Expected rolled back batch to leave 1 history entry, got %d", len(entries))
+	}
+}
+
+func TestStore_HistoryPurged(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	store.Create(t.Context(), models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: time.Now()})
+	store.Delete(t.Context(), "test-1")
+
+	if entries, err := store.History(t.Context(), "test-1"); err != nil || len(entries) != 2 {
+		t.Errorf("Expected history of trashed item, got %d entries (%v)", len(entries), err)
+	}
+
+	store.Purge(t.Context(), "test-1")
+	if _, err := store.History(t.Context(), "test-1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after purge, got %v", err)
+	}
+}
+
+func TestStore_HistoryStoresImagesOnce(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	first, second := "data:image/jpeg;base64,AAAA", "data:image/jpeg;base64,BBBB"
+	item := models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: time.Now(), Image: &first}
+	original, _ := store.Create(t.Context(), item)
+	for i := 2; i <= 20; i++ {
+		item.Count = i
+		store.Update(t.Context(), "test-1", item, nil)
+	}
+	item.Image = &second
+	store.Update(t.Context(), "test-1", item, nil)
+
+	if len(store.images) != 2 {
+		t.Errorf("Expected each image to be stored once, got %d", len(store.images))
+	}
+	entries, _ := store.History(t.Context(), "test-1")
+	for _, entry := range entries {
+		if entry.Item.Image != nil || entry.ImageDigest == "" {
+			t.Fatalf("Expected entries to reference images by digest, got %+v", entry)
+		}
+	}
+
+	at, err := store.HistoryAt("test-1", original.Revision)
+	if err != nil || at.Item.Image == nil || *at.Item.Image != first {
+		t.Errorf("Expected HistoryAt to restore the image, got %+v, %v", at.Item, err)
+	}
+	reverted, err := store.Revert(t.Context(), "test-1", original.Revision, "alice", nil)
+	if err != nil || reverted.Image == nil || *reverted.Image != first {
+		t.Errorf("Expected revert to restore the image, got %+v, %v", reverted, err)
+	}
+
+	reloaded := newStore(store.filepath)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if at, _ := reloaded.HistoryAt("test-1", original.Revision); at.Item.Image == nil || *at.Item.Image != first {
+		t.Errorf("Expected the image to survive a reload, got %+v", at.Item)
+	}
+
+	store.Delete(t.Context(), "test-1")
+	store.Purge(t.Context(), "test-1")
+	if len(store.images) != 0 {
+		t.Errorf("Expected images to be dropped with the item, got %d", len(store.images))
+	}
+}
+
+func TestStore_HistoryCapped(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	image := "data:image/jpeg;base64,AAAA"
+	item := models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: time.Now(), Image: &image}
+	original, _ := store.Create(t.Context(), item)
+	item.Image = nil
+	for i := 0; i < MaxHistoryEntries; i++ {
+		item.Count = i + 2
+		store.Update(t.Context(), "test-1", item, nil)
+	}
+
+	entries, _ := store.History(t.Context(), "test-1")
+	if len(entries) != MaxHistoryEntries {
+		t.Errorf("Expected %d entries, got %d", MaxHistoryEntries, len(entries))
+	}
+	if _, err := store.HistoryAt("test-1", original.Revision); err != ErrRevisionNotFound {
+		t.Errorf("Expected the oldest version to be dropped, got %v", err)
+	}
+	if len(store.images) != 0 {
+		t.Errorf("Expected the image of the dropped version to be pruned, got %d", len(store.images))
+	}
+}
+
+func TestStore_HistoryImagesRolledBackWithBatch(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	first, second := "data:image/jpeg;base64,AAAA", "data:image/jpeg;base64,BBBB"
+	item := models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: time.Now(), Image: &first}
+	original, _ := store.Create(t.Context(), item)
+	item.Image = &second
+	for i := 0; i < MaxHistoryEntries-2; i++ {
+		item.Count = i + 2
+		store.Update(t.Context(), "test-1", item, nil)
+	}
+
+	// The update pushes the first version out of the history before the
+	// batch is rolled back
+	item.Count = 100
+	store.Batch(t.Context(), []Op{
+		{Type: OpUpdate, ID: "test-1", Item: item},
+		{Type: OpUpdate, ID: "test-1", Item: item},
+		{Type: OpDelete, ID: "missing"},
+	}, true)
+	store.Flush()
+	store.Create(t.Context(), models.Item{ID: "test-2", Location: "Forest", Count: 1, DateTime: time.Now()})
+
+	at, err := store.HistoryAt("test-1", original.Revision)
+	if err != nil || at.Item.Image == nil || *at.Item.Image != first {
+		t.Errorf("Expected the first version and its image after rollback, got %+v, %v", at.Item, err)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyTTL is how long idempotency records are kept when no TTL
+// is configured
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyMismatch   = errors.New("idempotency key reused with a different request")
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key header
+type IdempotencyRecord struct {
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	completed   bool
+}
+
+// IdempotencyStore keeps idempotency records in memory for a fixed TTL
+type IdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]*IdempotencyRecord
+	ttl       time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewIdempotencyStore creates an idempotency store whose records expire after
+// ttl; a non-positive ttl selects DefaultIdempotencyTTL
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyStore{
+		records: make(map[string]*IdempotencyRecord),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// TTL returns how long records are kept
+func (s *IdempotencyStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Begin reserves key for a request with the given fingerprint. If a completed
+// record exists for the same fingerprint it is returned for replay. A record
+// with a different fingerprint yields ErrIdempotencyMismatch, and a
+// reservation that has not completed yet yields ErrIdempotencyInProgress.
+// When Begin returns (nil, nil) the caller owns the key and must call either
+// Complete or Release.
+func (s *IdempotencyStore) Begin(key, fingerprint string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if rec, exists := s.records[key]; exists && now.Before(rec.ExpiresAt) {
+		if rec.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyMismatch
+		}
+		if !rec.completed {
+			return nil, ErrIdempotencyInProgress
+		}
+		replay := *rec
+		return &replay, nil
+	}
+
+	s.records[key] = &IdempotencyRecord{
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	return nil, nil
+}
+
+// Complete stores the response for a key reserved with Begin
+func (s *IdempotencyStore) Complete(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, exists := s.records[key]
+	if !exists {
+		return
+	}
+	rec.Status = status
+	rec.Header = header
+	rec.Body = body
+	rec.completed = true
+}
+
+// Release drops a reservation made with Begin without storing a response, so
+// that the request can be retried
+func (s *IdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, exists := s.records[key]; exists && !rec.completed {
+		delete(s.records, key)
+	}
+}
+
+// sweep removes expired records at most once a minute; callers hold s.mu
+func (s *IdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
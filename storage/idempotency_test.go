@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore_BeginComplete(t *testing.T) {
+	s := NewIdempotencyStore(time.Hour)
+
+	rec, err := s.Begin("key-1", "fp-1")
+	if rec != nil || err != nil {
+		t.Fatalf("Expected fresh reservation, got %v, %v", rec, err)
+	}
+
+	// A concurrent retry sees the reservation
+	if _, err := s.Begin("key-1", "fp-1"); err != ErrIdempotencyInProgress {
+		t.Errorf("Expected ErrIdempotencyInProgress, got %v", err)
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	s.Complete("key-1", http.StatusCreated, header, []byte(`{"id":"abc"}`))
+
+	rec, err = s.Begin("key-1", "fp-1")
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if rec == nil {
+		t.Fatal("Expected stored record for replay")
+	}
+	if rec.Status != http.StatusCreated || string(rec.Body) != `{"id":"abc"}` {
+		t.Errorf("Unexpected replay record: %d %s", rec.Status, rec.Body)
+	}
+
+	if _, err := s.Begin("key-1", "fp-2"); err != ErrIdempotencyMismatch {
+		t.Errorf("Expected ErrIdempotencyMismatch, got %v", err)
+	}
+}
+
+func TestIdempotencyStore_Release(t *testing.T) {
+	s := NewIdempotencyStore(time.Hour)
+
+	if _, err := s.Begin("key-1", "fp-1"); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	s.Release("key-1")
+
+	rec, err := s.Begin("key-1", "fp-2")
+	if rec != nil || err != nil {
+		t.Errorf("Expected key to be reusable after Release, got %v, %v", rec, err)
+	}
+}
+
+func TestIdempotencyStore_Expiry(t *testing.T) {
+	s := NewIdempotencyStore(time.Hour)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	s.Begin("key-1", "fp-1")
+	s.Complete("key-1", http.StatusCreated, nil, nil)
+
+	now = now.Add(2 * time.Hour)
+	rec, err := s.Begin("key-1", "fp-2")
+	if rec != nil || err != nil {
+		t.Errorf("Expected expired key to be reusable, got %v, %v", rec, err)
+	}
+}
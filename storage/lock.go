@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LockStats reports contention on the store lock since the store was created.
+// Every operation takes the lock, read-only ones in shared mode, so time spent
+// waiting here is added to request latency.
+type LockStats struct {
+	Read  LockModeStats `json:"read"`
+	Write LockModeStats `json:"write"`
+}
+
+// LockModeStats reports how often one mode of the lock was taken, how often
+// and how long callers had to wait for it, and how many are waiting now.
+// Hold times are only recorded for the write lock, which excludes everyone
+// else while held.
+type LockModeStats struct {
+	Acquisitions   int64   `json:"acquisitions"`
+	Contended      int64   `json:"contended"`
+	Waiting        int64   `json:"waiting"`
+	WaitSeconds    float64 `json:"waitSeconds"`
+	MaxWaitSeconds float64 `json:"maxWaitSeconds"`
+	HeldSeconds    float64 `json:"heldSeconds,omitempty"`
+	MaxHeldSeconds float64 `json:"maxHeldSeconds,omitempty"`
+}
+
+// statsRWMutex is a sync.RWMutex that records contention. An uncontended
+// acquisition costs one extra atomic add.
+type statsRWMutex struct {
+	mu          sync.RWMutex
+	read, write lockCounters
+	// lockedAt is when the write lock was last taken; it is only touched
+	// while holding it
+	lockedAt time.Time
+}
+
+type lockCounters struct {
+	acquisitions atomic.Int64
+	contended    atomic.Int64
+	waiting      atomic.Int64
+	wait         atomic.Int64
+	maxWait      atomic.Int64
+	held         atomic.Int64
+	maxHeld      atomic.Int64
+}
+
+func (m *statsRWMutex) Lock() {
+	if !m.mu.TryLock() {
+		m.write.waitFor(m.mu.Lock)
+	}
+	m.write.acquisitions.Add(1)
+	m.lockedAt = time.Now()
+}
+
+func (m *statsRWMutex) Unlock() {
+	held := int64(time.Since(m.lockedAt))
+	m.write.held.Add(held)
+	storeMax(&m.write.maxHeld, held)
+	m.mu.Unlock()
+}
+
+func (m *statsRWMutex) RLock() {
+	if !m.mu.TryRLock() {
+		m.read.waitFor(m.mu.RLock)
+	}
+	m.read.acquisitions.Add(1)
+}
+
+func (m *statsRWMutex) RUnlock() {
+	m.mu.RUnlock()
+}
+
+// Stats returns the contention recorded so far
+func (m *statsRWMutex) Stats() LockStats {
+	return LockStats{Read: m.read.stats(), Write: m.write.stats()}
+}
+
+// waitFor calls lock, which blocks, and records how long it took
+func (c *lockCounters) waitFor(lock func()) {
+	c.waiting.Add(1)
+	start := time.Now()
+	lock()
+	waited := int64(time.Since(start))
+	c.waiting.Add(-1)
+	c.contended.Add(1)
+	c.wait.Add(waited)
+	storeMax(&c.maxWait, waited)
+}
+
+func (c *lockCounters) stats() LockModeStats {
+	return LockModeStats{
+		Acquisitions:   c.acquisitions.Load(),
+		Contended:      c.contended.Load(),
+		Waiting:        c.waiting.Load(),
+		WaitSeconds:    time.Duration(c.wait.Load()).Seconds(),
+		MaxWaitSeconds: time.Duration(c.maxWait.Load()).Seconds(),
+		HeldSeconds:    time.Duration(c.held.Load()).Seconds(),
+		MaxHeldSeconds: time.Duration(c.maxHeld.Load()).Seconds(),
+	}
+}
+
+// storeMax raises v to n if n is larger
+func storeMax(v *atomic.Int64, n int64) {
+	for {
+		old := v.Load()
+		if n <= old || v.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+// LockStats reports contention on the store lock
+func (s *Store) LockStats() LockStats {
+	return s.mu.Stats()
+}
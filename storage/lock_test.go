@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"service/models"
+)
+
+func TestStatsRWMutex(t *testing.T) {
+	var m statsRWMutex
+
+	m.RLock()
+	m.RUnlock()
+	if stats := m.Stats(); stats.Read.Acquisitions != 1 || stats.Read.Contended != 0 {
+		t.Errorf("Expected one uncontended read, got %+v", stats.Read)
+	}
+
+	// A writer waits for the lock held by another writer
+	m.Lock()
+	done := make(chan struct{})
+	go func() {
+		m.Lock()
+		m.Unlock()
+		close(done)
+	}()
+	for m.Stats().Write.Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	m.Unlock()
+	<-done
+
+	stats := m.Stats().Write
+	if stats.Acquisitions != 2 || stats.Contended != 1 || stats.Waiting != 0 {
+		t.Errorf("Expected one of two writes to wait, got %+v", stats)
+	}
+	if stats.MaxWaitSeconds < 0.01 || stats.WaitSeconds < stats.MaxWaitSeconds {
+		t.Errorf("Expected a wait of at least 10ms, got %+v", stats)
+	}
+	if stats.MaxHeldSeconds < 0.01 {
+		t.Errorf("Expected the write lock to be held for at least 10ms, got %+v", stats)
+	}
+}
+
+func TestStore_LockStats(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	store.GetAll(t.Context())
+
+	stats := store.LockStats()
+	if stats.Write.Acquisitions == 0 || stats.Read.Acquisitions == 0 {
+		t.Errorf("Expected store operations to take the lock, got %+v", stats)
+	}
+}
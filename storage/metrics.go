@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"service/metrics"
+	"service/tracing"
+)
+
+var (
+	operationDuration = metrics.Default.NewHistogramVec("shroomp_storage_operation_duration_seconds",
+		"Latency of storage operations in seconds, including saving to disk.", metrics.DefaultBuckets, "operation")
+	persistErrors = metrics.Default.NewCounterVec("shroomp_storage_persist_errors_total",
+		"Number of failed attempts to write the data file.")
+)
+
+// observe records the latency of an operation started at start; call it as
+// defer observe("name", time.Now())
+func observe(operation string, start time.Time) {
+	operationDuration.With(operation).Observe(time.Since(start).Seconds())
+}
+
+// startSpan starts a span for a storage operation, named such as
+// storage.create
+func startSpan(ctx context.Context, operation string) (context.Context, *tracing.Span) {
+	return tracing.Start(ctx, "storage."+operation)
+}
+
+// RegisterMetrics registers gauges for the contents of s in registry
+func (s *Store) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("shroomp_items", "Number of sightings, excluding the trash.", func() float64 {
+		return float64(s.Stats().Items)
+	})
+	registry.NewGaugeFunc("shroomp_trash_items", "Number of sightings in the trash.", func() float64 {
+		return float64(s.Stats().Trash)
+	})
+	registry.NewGaugeFunc("shroomp_users", "Number of user accounts.", func() float64 {
+		return float64(s.Stats().Users)
+	})
+	registry.NewGaugeFunc("shroomp_storage_revision", "Current store revision.", func() float64 {
+		return float64(s.Revision())
+	})
+}
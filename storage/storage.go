@@ -1,33 +1,98 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"service/logger"
 	"service/models"
-	"sync"
+	"sort"
+	"time"
 )
 
 var (
 	ErrNotFound      = errors.New("item not found")
 	ErrAlreadyExists = errors.New("item already exists")
+	ErrInvalidOp     = errors.New("invalid batch operation")
+	ErrBatchAborted  = errors.New("batch aborted")
+	ErrConflict      = errors.New("revision conflict")
+	ErrForbidden     = errors.New("forbidden")
+	// ErrNotLoaded is returned by saves while the data file could not be
+	// loaded, so that an empty store never overwrites the data in it
+	ErrNotLoaded = errors.New("data file not loaded")
 )
 
-// Store provides thread-safe storage for items with JSON file persistence
+// Store provides thread-safe storage for items with JSON file persistence.
+// Every change is stamped with a store-wide, monotonically increasing
+// revision. Deleted items stay in the store with DeletedAt set until they are
+// purged, which leaves a tombstone so that sync clients can learn about them.
+// The latest MaxHistoryEntries versions of an item are kept in its history
+// until the item is purged; images in them are stored once, by digest.
+// The store also holds the user accounts that own items and their API keys.
 type Store struct {
-	mu       sync.RWMutex
-	items    map[string]models.Item
-	filepath string
+	mu         statsRWMutex
+	items      map[string]models.Item
+	tombstones map[string]Tombstone
+	history    map[string][]HistoryEntry
+	users      map[string]models.User
+	apiKeys    map[string]models.APIKey
+	revision   int64
+	filepath   string
+	// loadErr is the error that kept the file from being loaded, if any
+	loadErr error
+	// lastSave and saveErr record the outcome of the most recent save
+	lastSave time.Time
+	saveErr  error
+	// images holds the images of history entries by digest, and imageRefs
+	// counts the entries referencing each
+	images    map[string]string
+	imageRefs map[string]int
+	// keyHashes maps API key hashes to key IDs, so that authenticating a
+	// request does not scan every key
+	keyHashes map[string]string
 }
 
-// NewStore creates a new storage instance and loads existing data from file
+// Tombstone records the deletion of an item
+type Tombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+	Revision  int64     `json:"revision"`
+}
+
+// snapshotVersion identifies the current on-disk format
+const snapshotVersion = 2
+
+// snapshot is the on-disk representation of the store. Version 1 files were a
+// plain map of items and are still accepted by load.
+type snapshot struct {
+	Version    int                       `json:"version"`
+	Revision   int64                     `json:"revision"`
+	Items      map[string]models.Item    `json:"items"`
+	Tombstones map[string]Tombstone      `json:"tombstones,omitempty"`
+	History    map[string][]HistoryEntry `json:"history,omitempty"`
+	Images     map[string]string         `json:"images,omitempty"`
+	Users      map[string]models.User    `json:"users,omitempty"`
+	APIKeys    map[string]models.APIKey  `json:"apiKeys,omitempty"`
+}
+
+// DefaultDataFile is the file NewStore persists to
+const DefaultDataFile = "data.json"
+
+// NewStore creates a new storage instance and loads existing data from
+// DefaultDataFile
 func NewStore() *Store {
-	s := &Store{
-		items:    make(map[string]models.Item),
-		filepath: "data.json",
-	}
+	return NewFileStore(DefaultDataFile)
+}
+
+// NewFileStore creates a storage instance persisted to the JSON file at path
+// and loads existing data from it
+func NewFileStore(path string) *Store {
+	s := newStore(path)
 	if err := s.load(); err != nil {
+		s.loadErr = err
 		logger.Error("Failed to load data from file", map[string]interface{}{
 			"error":    err.Error(),
 			"filepath": s.filepath,
@@ -36,13 +101,36 @@ func NewStore() *Store {
 		logger.Info("Storage initialized", map[string]interface{}{
 			"filepath":   s.filepath,
 			"item_count": len(s.items),
+			"revision":   s.revision,
 		})
 	}
 	return s
 }
 
+// NewMemoryStore creates a storage instance that keeps everything in memory
+// only; all data is lost when the process exits
+func NewMemoryStore() *Store {
+	return newStore("")
+}
+
+func newStore(filepath string) *Store {
+	return &Store{
+		items:      make(map[string]models.Item),
+		tombstones: make(map[string]Tombstone),
+		history:    make(map[string][]HistoryEntry),
+		users:      make(map[string]models.User),
+		apiKeys:    make(map[string]models.APIKey),
+		keyHashes:  make(map[string]string),
+		filepath:   filepath,
+	}
+}
+
 // load reads items from the JSON file
 func (s *Store) load() error {
+	if s.filepath == "" {
+		return nil
+	}
+
 	data, err := os.ReadFile(s.filepath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -56,46 +144,256 @@ func (s *Store) load() error {
 		return nil
 	}
 
-	return json.Unmarshal(data, &s.items)
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Version == 0 {
+		if err := s.loadLegacy(data); err != nil {
+			return err
+		}
+		s.seedHistory()
+		return nil
+	}
+
+	if snap.Items != nil {
+		s.items = snap.Items
+	}
+	if snap.Tombstones != nil {
+		s.tombstones = snap.Tombstones
+	}
+	if snap.History != nil {
+		s.history = snap.History
+	}
+	if snap.Images != nil {
+		s.images = snap.Images
+	}
+	if snap.Users != nil {
+		s.users = snap.Users
+	}
+	if snap.APIKeys != nil {
+		s.apiKeys = snap.APIKeys
+	}
+	s.revision = snap.Revision
+	s.indexAPIKeys()
+	s.indexImages()
+	s.seedHistory()
+	return nil
+}
+
+// loadLegacy reads a version 1 file, a plain map of items, and assigns
+// revisions in order of last update
+func (s *Store) loadLegacy(data []byte) error {
+	if err := json.Unmarshal(data, &s.items); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.items[ids[i]], s.items[ids[j]]
+		if !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.Before(b.UpdatedAt)
+		}
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		item := s.items[id]
+		s.revision++
+		item.Revision = s.revision
+		s.items[id] = item
+	}
+	return nil
 }
 
-// save writes items to the JSON file
-func (s *Store) save() error {
-	data, err := json.MarshalIndent(s.items, "", "  ")
+// save writes items to the JSON file; memory stores are never written, and
+// neither is a file that could not be loaded
+func (s *Store) save(ctx context.Context) (err error) {
+	s.pruneImages()
+	if s.filepath == "" {
+		return nil
+	}
+	if s.loadErr != nil {
+		s.saveErr = fmt.Errorf("%w: %v", ErrNotLoaded, s.loadErr)
+		return s.saveErr
+	}
+	defer observe("save", time.Now())
+	_, span := startSpan(ctx, "save")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	data, err := json.MarshalIndent(snapshot{
+		Version:    snapshotVersion,
+		Revision:   s.revision,
+		Items:      s.items,
+		Tombstones: s.tombstones,
+		History:    s.history,
+		Images:     s.images,
+		Users:      s.users,
+		APIKeys:    s.apiKeys,
+	}, "", "  ")
 	if err != nil {
-		logger.Error("Failed to marshal items", map[string]interface{}{
+		s.saveErr = err
+		persistErrors.With().Inc()
+		logger.ErrorContext(ctx, "Failed to marshal items", map[string]interface{}{
 			"error":      err.Error(),
 			"item_count": len(s.items),
 		})
 		return err
 	}
 
-	if err := os.WriteFile(s.filepath, data, 0644); err != nil {
-		logger.Error("Failed to write data to file", map[string]interface{}{
+	span.SetAttribute("shroomp.storage.bytes", len(data))
+	if err := writeFileAtomic(s.filepath, data); err != nil {
+		s.saveErr = err
+		persistErrors.With().Inc()
+		logger.ErrorContext(ctx, "Failed to write data to file", map[string]interface{}{
 			"error":    err.Error(),
 			"filepath": s.filepath,
 		})
 		return err
 	}
 
+	s.lastSave = time.Now()
+	s.saveErr = nil
 	return nil
 }
 
-// Create adds a new item to the store
-func (s *Store) Create(item models.Item) error {
+// writeFileAtomic replaces the file at path with data. The data is written to
+// a temporary file in the same directory, synced and renamed over path, so a
+// crash leaves either the old or the new file but never a partial one.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing the temporary file fails harmlessly once it has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Flush writes the store to its file if the last save failed. Every change is
+// already saved when it is made, so Flush only matters at shutdown: it waits
+// for a save in progress and retries one that failed.
+func (s *Store) Flush() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.saveErr == nil {
+		return nil
+	}
+	return s.save(context.Background())
+}
 
-	if _, exists := s.items[item.ID]; exists {
-		return ErrAlreadyExists
+// put stores item under the next revision, records it in the item's history
+// and clears any tombstone left by an earlier purge of the same ID; callers
+// hold s.mu
+func (s *Store) put(action string, item models.Item) models.Item {
+	s.revision++
+	item.Revision = s.revision
+
+	var prev *models.Item
+	if p, exists := s.items[item.ID]; exists {
+		prev = &p
 	}
+	s.record(action, prev, item)
 
 	s.items[item.ID] = item
-	return s.save()
+	delete(s.tombstones, item.ID)
+	return item
+}
+
+// trash marks item as deleted by actor under the next revision; callers hold
+// s.mu
+func (s *Store) trash(item models.Item, actor string) models.Item {
+	now := time.Now()
+	item.DeletedAt = &now
+	item.UpdatedBy = actor
+	return s.put(ActionDelete, item)
+}
+
+// remove permanently deletes an item and records a tombstone under the next
+// revision; callers hold s.mu
+func (s *Store) remove(id string) Tombstone {
+	s.revision++
+	delete(s.items, id)
+	for _, entry := range s.history[id] {
+		s.releaseImage(entry.ImageDigest)
+	}
+	delete(s.history, id)
+	tomb := Tombstone{
+		ID:        id,
+		DeletedAt: time.Now(),
+		Revision:  s.revision,
+	}
+	if s.tombstones == nil {
+		s.tombstones = make(map[string]Tombstone)
+	}
+	s.tombstones[id] = tomb
+	return tomb
+}
+
+// Create adds a new item to the store and returns it as stored. New items are
+// never in the trash.
+func (s *Store) Create(ctx context.Context, item models.Item) (models.Item, error) {
+	defer observe("create", time.Now())
+	ctx, span := startSpan(ctx, "create")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", item.ID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.items[item.ID]; exists {
+		return models.Item{}, ErrAlreadyExists
+	}
+
+	item.DeletedAt = nil
+	item = s.put(ActionCreate, item)
+	return item, s.save(ctx)
 }
 
-// Get retrieves an item by ID
-func (s *Store) Get(id string) (models.Item, error) {
+// active returns the item stored under id unless it is missing or in the
+// trash; callers hold s.mu
+func (s *Store) active(id string) (models.Item, bool) {
+	item, exists := s.items[id]
+	if !exists || item.DeletedAt != nil {
+		return models.Item{}, false
+	}
+	return item, true
+}
+
+// Guard reports whether an item may be changed. Store methods call it with
+// the item as stored, while holding the lock, so that the decision and the
+// change cannot be interleaved with other writes; it must not call the store.
+// A nil Guard allows every change.
+type Guard func(item models.Item) bool
+
+// allows reports whether g lets item be changed
+func (g Guard) allows(item models.Item) bool {
+	return g == nil || g(item)
+}
+
+// GetIncludingDeleted retrieves an item by ID whether or not it is in the
+// trash
+func (s *Store) GetIncludingDeleted(id string) (models.Item, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -107,41 +405,320 @@ func (s *Store) Get(id string) (models.Item, error) {
 	return item, nil
 }
 
-// GetAll retrieves all items
-func (s *Store) GetAll() []models.Item {
+// Get retrieves an item by ID. Deleted items are not returned.
+func (s *Store) Get(ctx context.Context, id string) (models.Item, error) {
+	defer observe("get", time.Now())
+	_, span := startSpan(ctx, "get")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := s.active(id)
+	if !exists {
+		return models.Item{}, ErrNotFound
+	}
+
+	return item, nil
+}
+
+// GetAll retrieves all items that are not deleted
+func (s *Store) GetAll(ctx context.Context) []models.Item {
+	defer observe("list", time.Now())
+	_, span := startSpan(ctx, "list")
+	defer span.End()
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	items := make([]models.Item, 0, len(s.items))
 	for _, item := range s.items {
-		items = append(items, item)
+		if item.DeletedAt == nil {
+			items = append(items, item)
+		}
 	}
 
 	return items
 }
 
-// Update modifies an existing item
-func (s *Store) Update(id string, item models.Item) error {
+// Update modifies an existing item if guard allows it and returns it as
+// stored. The owner of an item never changes.
+func (s *Store) Update(ctx context.Context, id string, item models.Item, guard Guard) (models.Item, error) {
+	defer observe("update", time.Now())
+	ctx, span := startSpan(ctx, "update")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.items[id]; !exists {
-		return ErrNotFound
+	prev, exists := s.active(id)
+	if !exists {
+		return models.Item{}, ErrNotFound
+	}
+	if !guard.allows(prev) {
+		return models.Item{}, ErrForbidden
+	}
+
+	item.ID = id
+	item.Owner = prev.Owner
+	item.DeletedAt = nil
+	item = s.put(ActionUpdate, item)
+	return item, s.save(ctx)
+}
+
+// UpdateSpecies changes only the species identification of an active item on
+// behalf of actor, if guard allows it
+func (s *Store) UpdateSpecies(ctx context.Context, id, mushroomName, actor string, guard Guard) (models.Item, error) {
+	defer observe("update_species", time.Now())
+	ctx, span := startSpan(ctx, "update_species")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.active(id)
+	if !exists {
+		return models.Item{}, ErrNotFound
 	}
+	if !guard.allows(item) {
+		return models.Item{}, ErrForbidden
+	}
+
+	item.MushroomName = mushroomName
+	item.UpdatedAt = time.Now()
+	item.UpdatedBy = actor
+	item = s.put(ActionUpdate, item)
+	return item, s.save(ctx)
+}
 
-	s.items[id] = item
-	return s.save()
+// Delete moves an item to the trash. It can be brought back with Restore
+// until it is purged.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	return s.DeleteBy(ctx, id, "", nil)
 }
 
-// Delete removes an item by ID
-func (s *Store) Delete(id string) error {
+// DeleteBy moves an item to the trash if guard allows it, recording actor in
+// its history
+func (s *Store) DeleteBy(ctx context.Context, id, actor string, guard Guard) error {
+	defer observe("delete", time.Now())
+	ctx, span := startSpan(ctx, "delete")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.items[id]; !exists {
+	item, exists := s.active(id)
+	if !exists {
 		return ErrNotFound
 	}
+	if !guard.allows(item) {
+		return ErrForbidden
+	}
 
-	delete(s.items, id)
-	return s.save()
+	s.trash(item, actor)
+	return s.save(ctx)
+}
+
+// OpType identifies the kind of change carried by a batch operation
+type OpType string
+
+const (
+	OpCreate OpType = "create"
+	OpUpdate OpType = "update"
+	OpDelete OpType = "delete"
+)
+
+// Op is a single create, update or delete applied as part of a batch. Actor
+// is recorded in the item's history. Updates and deletes of an existing item,
+// including one in the trash, fail with ErrForbidden unless Guard allows them.
+type Op struct {
+	Type  OpType
+	ID    string
+	Item  models.Item
+	Actor string
+	Guard Guard
+	// IfRevision makes the operation conditional: it fails with ErrConflict
+	// unless the item's current revision (its tombstone's when deleted, 0 when
+	// it never existed) equals *IfRevision
+	IfRevision *int64
+}
+
+// OpResult reports the outcome of a single batch operation. A successful
+// delete reports the deletion as a tombstone; on ErrConflict, Item or
+// Tombstone hold the current server state. A delete of an item that is
+// already deleted fails with ErrNotFound or ErrConflict and reports the
+// existing deletion in Tombstone.
+type OpResult struct {
+	Item      models.Item
+	Tombstone *Tombstone
+	Err       error
+}
+
+// Batch applies ops in order while holding the lock and persists the result
+// with a single write. In atomic mode the first failing operation rolls back
+// every change already applied, leaving the store untouched; ErrBatchAborted
+// is returned and later operations are not attempted (their Err is
+// ErrBatchAborted). In non-atomic mode failing operations are skipped and
+// reported in their OpResult.
+func (s *Store) Batch(ctx context.Context, ops []Op, atomic bool) ([]OpResult, error) {
+	defer observe("batch", time.Now())
+	ctx, span := startSpan(ctx, "batch")
+	defer span.End()
+	span.SetAttribute("shroomp.batch.operations", len(ops))
+	span.SetAttribute("shroomp.batch.atomic", atomic)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// undo records the previous state of every touched ID so an atomic batch
+	// can be rolled back in reverse order
+	type undo struct {
+		id          string
+		prev        models.Item
+		existed     bool
+		prevTomb    Tombstone
+		tombExisted bool
+		history     []HistoryEntry
+	}
+	var log []undo
+	startRevision := s.revision
+
+	results := make([]OpResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		if failed {
+			results[i].Err = ErrBatchAborted
+			continue
+		}
+
+		prev, existed := s.items[op.ID]
+		prevTomb, tombExisted := s.tombstones[op.ID]
+		history := s.history[op.ID]
+		active := existed && prev.DeletedAt == nil
+		op.Item.UpdatedBy = op.Actor
+		var err error
+		switch {
+		case existed && op.Type != OpCreate && !op.Guard.allows(prev):
+			err = ErrForbidden
+		case op.IfRevision != nil && *op.IfRevision != s.currentRevision(op.ID):
+			err = ErrConflict
+			if tomb, deleted := s.deletion(op.ID); deleted {
+				results[i].Tombstone = &tomb
+			} else if existed {
+				results[i].Item = prev
+			}
+		case op.Type == OpCreate:
+			if existed {
+				err = ErrAlreadyExists
+			} else {
+				op.Item.DeletedAt = nil
+				results[i].Item = s.put(ActionCreate, op.Item)
+			}
+		case op.Type == OpUpdate:
+			if !active {
+				err = ErrNotFound
+			} else {
+				op.Item.ID = op.ID
+				op.Item.Owner = prev.Owner
+				op.Item.DeletedAt = nil
+				results[i].Item = s.put(ActionUpdate, op.Item)
+			}
+		case op.Type == OpDelete:
+			if !active {
+				err = ErrNotFound
+				if tomb, deleted := s.deletion(op.ID); deleted {
+					results[i].Tombstone = &tomb
+				}
+			} else {
+				tomb := tombstoneOf(s.trash(prev, op.Actor))
+				results[i].Tombstone = &tomb
+			}
+		default:
+			err = ErrInvalidOp
+		}
+
+		if err != nil {
+			results[i].Err = err
+			if atomic {
+				failed = true
+			}
+			continue
+		}
+		log = append(log, undo{
+			id:          op.ID,
+			prev:        prev,
+			existed:     existed,
+			prevTomb:    prevTomb,
+			tombExisted: tombExisted,
+			history:     history,
+		})
+	}
+
+	if failed {
+		for i := len(log) - 1; i >= 0; i-- {
+			u := log[i]
+			if u.existed {
+				s.items[u.id] = u.prev
+			} else {
+				delete(s.items, u.id)
+			}
+			if u.tombExisted {
+				s.tombstones[u.id] = u.prevTomb
+			} else {
+				delete(s.tombstones, u.id)
+			}
+			for _, entry := range s.history[u.id] {
+				s.releaseImage(entry.ImageDigest)
+			}
+			for _, entry := range u.history {
+				s.retainImage(entry.ImageDigest)
+			}
+			if len(u.history) > 0 {
+				s.history[u.id] = u.history
+			} else {
+				delete(s.history, u.id)
+			}
+		}
+		s.revision = startRevision
+		return results, ErrBatchAborted
+	}
+
+	if len(log) == 0 {
+		return results, nil
+	}
+	return results, s.save(ctx)
+}
+
+// tombstoneOf describes a trashed item as a tombstone
+func tombstoneOf(item models.Item) Tombstone {
+	return Tombstone{ID: item.ID, DeletedAt: *item.DeletedAt, Revision: item.Revision}
+}
+
+// deletion returns the tombstone of an item in the trash or purged; callers
+// hold s.mu
+func (s *Store) deletion(id string) (Tombstone, bool) {
+	if item, exists := s.items[id]; exists {
+		if item.DeletedAt == nil {
+			return Tombstone{}, false
+		}
+		return tombstoneOf(item), true
+	}
+	tomb, exists := s.tombstones[id]
+	return tomb, exists
+}
+
+// currentRevision returns the revision of the item's latest change, or 0 if
+// it never existed; callers hold s.mu
+func (s *Store) currentRevision(id string) int64 {
+	if item, exists := s.items[id]; exists {
+		return item.Revision
+	}
+	if tomb, exists := s.tombstones[id]; exists {
+		return tomb.Revision
+	}
+	return 0
 }
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
 	"os"
+	"path/filepath"
+	"service/logger"
 	"service/models"
+	"strings"
 	"testing"
 	"time"
 )
@@ -22,13 +27,13 @@ func TestStore_Create(t *testing.T) {
 		UpdatedAt:    now,
 	}
 
-	err := store.Create(item)
+	_, err := store.Create(t.Context(), item)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
 	// Verify item exists
-	retrieved, err := store.Get(item.ID)
+	retrieved, err := store.Get(t.Context(), item.ID)
 	if err != nil {
 		t.Fatalf("Get after Create failed: %v", err)
 	}
@@ -54,13 +59,13 @@ func TestStore_CreateDuplicate(t *testing.T) {
 	}
 
 	// First create should succeed
-	err := store.Create(item)
+	_, err := store.Create(t.Context(), item)
 	if err != nil {
 		t.Fatalf("First Create failed: %v", err)
 	}
 
 	// Second create should fail
-	err = store.Create(item)
+	_, err = store.Create(t.Context(), item)
 	if err != ErrAlreadyExists {
 		t.Errorf("Expected ErrAlreadyExists, got %v", err)
 	}
@@ -78,11 +83,11 @@ func TestStore_Get(t *testing.T) {
 		DateTime: now,
 	}
 
-	if err := store.Create(item); err != nil {
+	if _, err := store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
-	retrieved, err := store.Get(item.ID)
+	retrieved, err := store.Get(t.Context(), item.ID)
 	if err != nil {
 		t.Fatalf("Get failed: %v", err)
 	}
@@ -96,7 +101,7 @@ func TestStore_GetNotFound(t *testing.T) {
 	store := createTestStore(t)
 	defer cleanupTestStore(store)
 
-	_, err := store.Get("non-existent")
+	_, err := store.Get(t.Context(), "non-existent")
 	if err != ErrNotFound {
 		t.Errorf("Expected ErrNotFound, got %v", err)
 	}
@@ -114,12 +119,12 @@ func TestStore_GetAll(t *testing.T) {
 	}
 
 	for _, item := range items {
-		if err := store.Create(item); err != nil {
+		if _, err := store.Create(t.Context(), item); err != nil {
 			t.Fatalf("Create failed: %v", err)
 		}
 	}
 
-	allItems := store.GetAll()
+	allItems := store.GetAll(t.Context())
 	if len(allItems) != len(items) {
 		t.Errorf("Expected %d items, got %d", len(items), len(allItems))
 	}
@@ -141,7 +146,7 @@ func TestStore_GetAllEmpty(t *testing.T) {
 	store := createTestStore(t)
 	defer cleanupTestStore(store)
 
-	allItems := store.GetAll()
+	allItems := store.GetAll(t.Context())
 	if len(allItems) != 0 {
 		t.Errorf("Expected empty slice, got %d items", len(allItems))
 	}
@@ -160,7 +165,7 @@ func TestStore_Update(t *testing.T) {
 		DateTime:     now,
 	}
 
-	if err := store.Create(item); err != nil {
+	if _, err := store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
@@ -172,12 +177,12 @@ func TestStore_Update(t *testing.T) {
 		DateTime:     now,
 	}
 
-	err := store.Update(item.ID, updatedItem)
+	_, err := store.Update(t.Context(), item.ID, updatedItem, nil)
 	if err != nil {
 		t.Fatalf("Update failed: %v", err)
 	}
 
-	retrieved, _ := store.Get(item.ID)
+	retrieved, _ := store.Get(t.Context(), item.ID)
 	if retrieved.MushroomName != updatedItem.MushroomName {
 		t.Errorf("Expected MushroomName %s, got %s", updatedItem.MushroomName, retrieved.MushroomName)
 	}
@@ -201,12 +206,36 @@ func TestStore_UpdateNotFound(t *testing.T) {
 		DateTime: now,
 	}
 
-	err := store.Update(item.ID, item)
+	_, err := store.Update(t.Context(), item.ID, item, nil)
 	if err != ErrNotFound {
 		t.Errorf("Expected ErrNotFound, got %v", err)
 	}
 }
 
+func TestStore_UpdateSpecies(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	item := models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 5, DateTime: now, Owner: "user-1"}
+	created, _ := store.Create(t.Context(), item)
+
+	updated, err := store.UpdateSpecies(t.Context(), "test-1", "Hedgehog", "mod-1", nil)
+	if err != nil {
+		t.Fatalf("UpdateSpecies failed: %v", err)
+	}
+	if updated.MushroomName != "Hedgehog" || updated.Location != "Forest" || updated.Owner != "user-1" {
+		t.Errorf("Expected only the species to change, got %+v", updated)
+	}
+	if updated.Revision <= created.Revision || updated.UpdatedBy != "mod-1" {
+		t.Errorf("Expected a new revision by mod-1, got %+v", updated)
+	}
+
+	if _, err := store.UpdateSpecies(t.Context(), "missing", "Hedgehog", "mod-1", nil); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestStore_Delete(t *testing.T) {
 	store := createTestStore(t)
 	defer cleanupTestStore(store)
@@ -219,17 +248,17 @@ func TestStore_Delete(t *testing.T) {
 		DateTime: now,
 	}
 
-	if err := store.Create(item); err != nil {
+	if _, err := store.Create(t.Context(), item); err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
-	err := store.Delete(item.ID)
+	err := store.Delete(t.Context(), item.ID)
 	if err != nil {
 		t.Fatalf("Delete failed: %v", err)
 	}
 
 	// Verify item is gone
-	_, err = store.Get(item.ID)
+	_, err = store.Get(t.Context(), item.ID)
 	if err != ErrNotFound {
 		t.Errorf("Expected ErrNotFound after delete, got %v", err)
 	}
@@ -239,7 +268,7 @@ func TestStore_DeleteNotFound(t *testing.T) {
 	store := createTestStore(t)
 	defer cleanupTestStore(store)
 
-	err := store.Delete("non-existent")
+	err := store.Delete(t.Context(), "non-existent")
 	if err != ErrNotFound {
 		t.Errorf("Expected ErrNotFound, got %v", err)
 	}
@@ -262,7 +291,7 @@ func TestStore_Persistence(t *testing.T) {
 	}
 
 	for _, item := range items {
-		err := store1.Create(item)
+		_, err := store1.Create(t.Context(), item)
 		if err != nil {
 			t.Fatalf("Create failed: %v", err)
 		}
@@ -284,7 +313,7 @@ func TestStore_Persistence(t *testing.T) {
 	}
 
 	for _, item := range items {
-		retrieved, err := store2.Get(item.ID)
+		retrieved, err := store2.Get(t.Context(), item.ID)
 		if err != nil {
 			t.Errorf("Failed to get item %s after load: %v", item.ID, err)
 		}
@@ -337,14 +366,310 @@ func TestStore_PersistenceNonExistentFile(t *testing.T) {
 	}
 }
 
+func TestStore_CreateIgnoresDeletedAt(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now, DeletedAt: &now}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	ops := []Op{{Type: OpCreate, ID: "test-2", Item: models.Item{ID: "test-2", Location: "Location 2", Count: 1, DateTime: now, DeletedAt: &now}}}
+	if _, err := store.Batch(t.Context(), ops, true); err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	for _, id := range []string{"test-1", "test-2"} {
+		item, err := store.Get(t.Context(), id)
+		if err != nil || item.DeletedAt != nil {
+			t.Errorf("Expected %s to be created outside the trash, got %+v, %v", id, item, err)
+		}
+	}
+}
+
+func TestStore_BatchNonAtomic(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	existing := models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now}
+	if _, err := store.Create(t.Context(), existing); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	ops := []Op{
+		{Type: OpCreate, ID: "test-2", Item: models.Item{ID: "test-2", Location: "Location 2", Count: 2, DateTime: now}},
+		{Type: OpUpdate, ID: "missing", Item: models.Item{ID: "missing", Location: "Nowhere", Count: 1, DateTime: now}},
+		{Type: OpDelete, ID: "test-1"},
+	}
+
+	results, err := store.Batch(t.Context(), ops, false)
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	if results[0].Err != nil {
+		t.Errorf("Expected create to succeed, got %v", results[0].Err)
+	}
+	if results[1].Err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for update, got %v", results[1].Err)
+	}
+	if results[2].Err != nil {
+		t.Errorf("Expected delete to succeed, got %v", results[2].Err)
+	}
+
+	if _, err := store.Get(t.Context(), "test-2"); err != nil {
+		t.Errorf("Expected test-2 to exist, got %v", err)
+	}
+	if _, err := store.Get(t.Context(), "test-1"); err != ErrNotFound {
+		t.Errorf("Expected test-1 to be deleted, got %v", err)
+	}
+}
+
+func TestStore_BatchAtomicRollback(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	existing := models.Item{ID: "test-1", MushroomName: "Original", Location: "Location 1", Count: 1, DateTime: now}
+	if _, err := store.Create(t.Context(), existing); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	updated := existing
+	updated.MushroomName = "Updated"
+	ops := []Op{
+		{Type: OpCreate, ID: "test-2", Item: models.Item{ID: "test-2", Location: "Location 2", Count: 2, DateTime: now}},
+		{Type: OpUpdate, ID: "test-1", Item: updated},
+		{Type: OpDelete, ID: "missing"},
+		{Type: OpDelete, ID: "test-1"},
+	}
+
+	results, err := store.Batch(t.Context(), ops, true)
+	if err != ErrBatchAborted {
+		t.Fatalf("Expected ErrBatchAborted, got %v", err)
+	}
+	if results[2].Err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for failing op, got %v", results[2].Err)
+	}
+	if results[3].Err != ErrBatchAborted {
+		t.Errorf("Expected ErrBatchAborted for skipped op, got %v", results[3].Err)
+	}
+
+	if _, err := store.Get(t.Context(), "test-2"); err != ErrNotFound {
+		t.Errorf("Expected created item to be rolled back, got %v", err)
+	}
+	retrieved, err := store.Get(t.Context(), "test-1")
+	if err != nil {
+		t.Fatalf("Expected test-1 to survive rollback, got %v", err)
+	}
+	if retrieved.MushroomName != "Original" {
+		t.Errorf("Expected MushroomName Original after rollback, got %s", retrieved.MushroomName)
+	}
+}
+
+func TestStore_Guard(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Chanterelle", Location: "Forest", Count: 1, DateTime: now, Owner: "user-1"})
+	store.Create(t.Context(), models.Item{ID: "test-2", MushroomName: "Morel", Location: "Woods", Count: 1, DateTime: now, Owner: "user-1"})
+	store.Delete(t.Context(), "test-2")
+	revision := store.Revision()
+
+	var seen []string
+	deny := func(item models.Item) bool {
+		seen = append(seen, item.Owner)
+		return false
+	}
+	edit := models.Item{MushroomName: "Updated", Location: "Forest", Count: 2, DateTime: now}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"update", func() error { _, err := store.Update(t.Context(), "test-1", edit, deny); return err }},
+		{"update species", func() error {
+			_, err := store.UpdateSpecies(t.Context(), "test-1", "Hedgehog", "user-2", deny)
+			return err
+		}},
+		{"delete", func() error { return store.DeleteBy(t.Context(), "test-1", "user-2", deny) }},
+		{"revert", func() error { _, err := store.Revert(t.Context(), "test-1", 1, "user-2", deny); return err }},
+		{"restore", func() error { _, err := store.Restore(t.Context(), "test-2", "user-2", deny); return err }},
+		{"batch update", func() error {
+			results, _ := store.Batch(t.Context(), []Op{{Type: OpUpdate, ID: "test-1", Item: edit, Guard: deny}}, false)
+			return results[0].Err
+		}},
+		{"batch delete from trash", func() error {
+			results, _ := store.Batch(t.Context(), []Op{{Type: OpDelete, ID: "test-2", Guard: deny}}, false)
+			return results[0].Err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			if err := tt.call(); err != ErrForbidden {
+				t.Errorf("Expected ErrForbidden, got %v", err)
+			}
+			if len(seen) != 1 || seen[0] != "user-1" {
+				t.Errorf("Expected the guard to see the stored item once, got %v", seen)
+			}
+		})
+	}
+
+	if store.Revision() != revision {
+		t.Errorf("Expected refused changes to leave the store untouched, revision %d became %d", revision, store.Revision())
+	}
+	if _, err := store.Update(t.Context(), "test-1", edit, func(models.Item) bool { return true }); err != nil {
+		t.Errorf("Expected an allowing guard to let the update through, got %v", err)
+	}
+}
+
+func TestStore_BatchSingleWrite(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	ops := []Op{
+		{Type: OpCreate, ID: "test-1", Item: models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now}},
+		{Type: OpCreate, ID: "test-2", Item: models.Item{ID: "test-2", Location: "Location 2", Count: 2, DateTime: now}},
+	}
+
+	if _, err := store.Batch(t.Context(), ops, true); err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	reloaded := &Store{
+		items:    make(map[string]models.Item),
+		filepath: store.filepath,
+	}
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(reloaded.items) != 2 {
+		t.Errorf("Expected 2 persisted items, got %d", len(reloaded.items))
+	}
+}
+
+func TestStore_SaveAtomic(t *testing.T) {
+	dir := t.TempDir()
+	store := newStore(filepath.Join(dir, "data.json"))
+
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: time.Now()}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "data.json" {
+		t.Errorf("Expected only data.json to be left, got %v", entries)
+	}
+	info, err := os.Stat(store.filepath)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode().Perm())
+	}
+}
+
+func TestStore_Flush(t *testing.T) {
+	dir := t.TempDir()
+	store := newStore(filepath.Join(dir, "data.json"))
+	store.items["test-1"] = models.Item{ID: "test-1", Location: "Location 1", Count: 1}
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, err := os.Stat(store.filepath); !os.IsNotExist(err) {
+		t.Fatalf("Expected a store without failed saves not to be written, got %v", err)
+	}
+
+	store.saveErr = errors.New("disk full")
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	reloaded := newStore(store.filepath)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, ok := reloaded.items["test-1"]; !ok {
+		t.Error("Expected flushed item to be persisted")
+	}
+
+	if err := NewMemoryStore().Flush(); err != nil {
+		t.Errorf("Expected memory store flush to succeed, got %v", err)
+	}
+}
+
+func TestStore_FlushAfterLoadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	corrupt := []byte(`{"version": 2, "items": {"test-1": `)
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	store := NewFileStore(path)
+	if store.loadErr == nil {
+		t.Fatal("Expected the corrupt file not to load")
+	}
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-2", Location: "Location 2", Count: 1}); !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("Expected ErrNotLoaded from Create, got %v", err)
+	}
+	if err := store.Flush(); !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("Expected ErrNotLoaded from Flush, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != string(corrupt) {
+		t.Errorf("Expected the data file to be untouched, got %s", data)
+	}
+}
+
+func TestStore_SaveErrorLoggedWithRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	defer logger.SetOutput(os.Stdout)
+
+	store := newStore(filepath.Join(t.TempDir(), "missing", "data.json"))
+	ctx := logger.WithTrace(t.Context(), logger.Trace{RequestID: "req-1"})
+	if _, err := store.Create(ctx, models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: time.Now()}); err == nil {
+		t.Fatal("Expected the save to fail")
+	}
+
+	if !strings.Contains(buf.String(), `"message":"Failed to write data to file"`) || !strings.Contains(buf.String(), `"requestId":"req-1"`) {
+		t.Errorf("Expected the failure to be logged with the request ID, got %s", buf.String())
+	}
+}
+
+func TestNewMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	now := time.Now()
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := store.Get(t.Context(), "test-1"); err != nil {
+		t.Errorf("Get after Create failed: %v", err)
+	}
+	if _, err := os.Stat(DefaultDataFile); err == nil {
+		t.Errorf("Expected memory store not to write %s", DefaultDataFile)
+	}
+}
+
 // Helper functions
 
 func createTestStore(t *testing.T) *Store {
 	testFile := "test_" + t.Name() + ".json"
-	return &Store{
-		items:    make(map[string]models.Item),
-		filepath: testFile,
-	}
+	return newStore(testFile)
 }
 
 func cleanupTestStore(store *Store) {
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"service/models"
+)
+
+// changeTokenPrefix versions the change token format
+const changeTokenPrefix = "rev:"
+
+var ErrInvalidToken = errors.New("invalid change token")
+
+// ChangeSet lists everything that changed after a given revision, in
+// revision order
+type ChangeSet struct {
+	Items      []models.Item
+	Tombstones []Tombstone
+	// Revision is the revision the client has caught up to once it applied
+	// this change set
+	Revision int64
+	// HasMore reports that the limit truncated the change set
+	HasMore bool
+}
+
+// Revision returns the revision of the most recent change
+func (s *Store) Revision() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.revision
+}
+
+// Changes returns items created or updated and tombstones recorded after
+// revision since. At most limit entries are returned when limit is positive.
+func (s *Store) Changes(ctx context.Context, since int64, limit int) ChangeSet {
+	defer observe("changes", time.Now())
+	_, span := startSpan(ctx, "changes")
+	defer span.End()
+	span.SetAttribute("shroomp.sync.since", since)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type change struct {
+		revision int64
+		item     *models.Item
+		tomb     *Tombstone
+	}
+	var changes []change
+	for _, item := range s.items {
+		if item.Revision <= since {
+			continue
+		}
+		// Trashed items are reported to clients as deletions
+		if item.DeletedAt != nil {
+			tomb := tombstoneOf(item)
+			changes = append(changes, change{revision: item.Revision, tomb: &tomb})
+			continue
+		}
+		item := item
+		changes = append(changes, change{revision: item.Revision, item: &item})
+	}
+	for _, tomb := range s.tombstones {
+		if tomb.Revision > since {
+			tomb := tomb
+			changes = append(changes, change{revision: tomb.Revision, tomb: &tomb})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].revision < changes[j].revision
+	})
+
+	set := ChangeSet{
+		Items:      []models.Item{},
+		Tombstones: []Tombstone{},
+		Revision:   s.revision,
+	}
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+		set.Revision = changes[limit-1].revision
+		set.HasMore = true
+	}
+	for _, c := range changes {
+		if c.item != nil {
+			set.Items = append(set.Items, *c.item)
+		} else {
+			set.Tombstones = append(set.Tombstones, *c.tomb)
+		}
+	}
+	return set
+}
+
+// EncodeChangeToken turns a revision into the opaque token handed to clients
+func EncodeChangeToken(revision int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(changeTokenPrefix + strconv.FormatInt(revision, 10)))
+}
+
+// ParseChangeToken returns the revision encoded in a token issued by
+// EncodeChangeToken. The empty token stands for revision 0, a full sync.
+func ParseChangeToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	rest, ok := strings.CutPrefix(string(raw), changeTokenPrefix)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	revision, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || revision < 0 {
+		return 0, ErrInvalidToken
+	}
+	return revision, nil
+}
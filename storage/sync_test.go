@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"os"
+	"service/models"
+	"testing"
+	"time"
+)
+
+func TestStore_RevisionsIncrease(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	first, err := store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	second, err := store.Create(t.Context(), models.Item{ID: "test-2", Location: "Location 2", Count: 1, DateTime: now})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	updated, err := store.Update(t.Context(), "test-1", first, nil)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if !(first.Revision < second.Revision && second.Revision < updated.Revision) {
+		t.Errorf("Expected increasing revisions, got %d, %d, %d", first.Revision, second.Revision, updated.Revision)
+	}
+	if store.Revision() != updated.Revision {
+		t.Errorf("Expected store revision %d, got %d", updated.Revision, store.Revision())
+	}
+}
+
+func TestStore_Changes(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now})
+	checkpoint := store.Revision()
+	store.Create(t.Context(), models.Item{ID: "test-2", Location: "Location 2", Count: 1, DateTime: now})
+	store.Create(t.Context(), models.Item{ID: "test-3", Location: "Location 3", Count: 1, DateTime: now})
+	if err := store.Delete(t.Context(), "test-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	set := store.Changes(t.Context(), checkpoint, 0)
+	if len(set.Items) != 2 {
+		t.Errorf("Expected 2 changed items, got %d", len(set.Items))
+	}
+	if len(set.Tombstones) != 1 || set.Tombstones[0].ID != "test-1" {
+		t.Errorf("Expected tombstone for test-1, got %v", set.Tombstones)
+	}
+	if set.Revision != store.Revision() || set.HasMore {
+		t.Errorf("Expected complete change set at revision %d, got %d (hasMore %v)", store.Revision(), set.Revision, set.HasMore)
+	}
+
+	page := store.Changes(t.Context(), checkpoint, 2)
+	if !page.HasMore || len(page.Items) != 2 || len(page.Tombstones) != 0 {
+		t.Fatalf("Expected first page with 2 items, got %+v", page)
+	}
+	rest := store.Changes(t.Context(), page.Revision, 2)
+	if rest.HasMore || len(rest.Tombstones) != 1 {
+		t.Errorf("Expected last page with the tombstone, got %+v", rest)
+	}
+}
+
+func TestStore_BatchConditional(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	item, _ := store.Create(t.Context(), models.Item{ID: "test-1", MushroomName: "Original", Location: "Location 1", Count: 1, DateTime: now})
+	stale := item.Revision
+	item.MushroomName = "Server edit"
+	store.Update(t.Context(), "test-1", item, nil)
+
+	edit := item
+	edit.MushroomName = "Client edit"
+	results, err := store.Batch(t.Context(), []Op{{Type: OpUpdate, ID: "test-1", Item: edit, IfRevision: &stale}}, false)
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if results[0].Err != ErrConflict {
+		t.Fatalf("Expected ErrConflict, got %v", results[0].Err)
+	}
+	if results[0].Item.MushroomName != "Server edit" {
+		t.Errorf("Expected server copy in conflict result, got %s", results[0].Item.MushroomName)
+	}
+
+	store.Delete(t.Context(), "test-1")
+	zero := int64(0)
+	results, _ = store.Batch(t.Context(), []Op{{Type: OpCreate, ID: "test-1", Item: edit, IfRevision: &zero}}, false)
+	if results[0].Err != ErrConflict || results[0].Tombstone == nil {
+		t.Errorf("Expected conflict with tombstone, got %v", results[0])
+	}
+}
+
+func TestStore_LoadLegacyFormat(t *testing.T) {
+	testFile := "test_legacy.json"
+	defer os.Remove(testFile)
+
+	legacy := `{
+  "a": {"id": "a", "location": "Forest", "count": 1, "dateTime": "2025-11-09T14:30:00Z", "updated_at": "2025-11-09T15:00:00Z"},
+  "b": {"id": "b", "location": "Woods", "count": 2, "dateTime": "2025-11-09T14:30:00Z", "updated_at": "2025-11-09T14:00:00Z"}
+}`
+	if err := os.WriteFile(testFile, []byte(legacy), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	store := newStore(testFile)
+	if err := store.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(store.items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(store.items))
+	}
+	if store.items["b"].Revision != 1 || store.items["a"].Revision != 2 {
+		t.Errorf("Expected revisions in update order, got a=%d b=%d", store.items["a"].Revision, store.items["b"].Revision)
+	}
+	if store.Revision() != 2 {
+		t.Errorf("Expected store revision 2, got %d", store.Revision())
+	}
+}
+
+func TestChangeToken(t *testing.T) {
+	token := EncodeChangeToken(42)
+	revision, err := ParseChangeToken(token)
+	if err != nil || revision != 42 {
+		t.Errorf("Expected revision 42, got %d (%v)", revision, err)
+	}
+
+	if revision, err := ParseChangeToken(""); err != nil || revision != 0 {
+		t.Errorf("Expected empty token to mean revision 0, got %d (%v)", revision, err)
+	}
+
+	for _, bad := range []string{"42", "!!", EncodeChangeToken(-1)} {
+		if _, err := ParseChangeToken(bad); err != ErrInvalidToken {
+			t.Errorf("Expected ErrInvalidToken for %q, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"service/logger"
+	"service/models"
+)
+
+// GetTrash retrieves all deleted items that have not been purged yet, most
+// recently deleted first
+func (s *Store) GetTrash() []models.Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]models.Item, 0)
+	for _, item := range s.items {
+		if item.DeletedAt != nil {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(*items[j].DeletedAt)
+	})
+
+	return items
+}
+
+// Restore takes an item out of the trash on behalf of actor, if guard allows
+// it, and returns it as stored
+func (s *Store) Restore(ctx context.Context, id, actor string, guard Guard) (models.Item, error) {
+	defer observe("restore", time.Now())
+	ctx, span := startSpan(ctx, "restore")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.items[id]
+	if !exists || item.DeletedAt == nil {
+		return models.Item{}, ErrNotFound
+	}
+	if !guard.allows(item) {
+		return models.Item{}, ErrForbidden
+	}
+
+	item.DeletedAt = nil
+	item.UpdatedAt = time.Now()
+	item.UpdatedBy = actor
+	item = s.put(ActionRestore, item)
+	return item, s.save(ctx)
+}
+
+// Purge permanently removes an item from the trash
+func (s *Store) Purge(ctx context.Context, id string) error {
+	defer observe("purge", time.Now())
+	ctx, span := startSpan(ctx, "purge")
+	defer span.End()
+	span.SetAttribute("shroomp.item.id", id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.items[id]
+	if !exists || item.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	s.remove(id)
+	return s.save(ctx)
+}
+
+// PurgeDeletedBefore permanently removes every item that was moved to the
+// trash before cutoff and returns how many were removed
+func (s *Store) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	defer observe("purge_expired", time.Now())
+	ctx, span := startSpan(ctx, "purge_expired")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, item := range s.items {
+		if item.DeletedAt != nil && item.DeletedAt.Before(cutoff) {
+			s.remove(id)
+			purged++
+		}
+	}
+
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, s.save(ctx)
+}
+
+// StartRetention purges items that have been in the trash for longer than
+// retention, checking every interval until ctx is cancelled
+func StartRetention(ctx context.Context, s *Store, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			purged, err := s.PurgeDeletedBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				logger.Error("Failed to purge expired trash", map[string]interface{}{
+					"error":  err.Error(),
+					"purged": purged,
+				})
+				continue
+			}
+			if purged > 0 {
+				logger.Info("Purged expired trash", map[string]interface{}{
+					"purged":         purged,
+					"retention_days": retention.Hours() / 24,
+				})
+			}
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"service/models"
+	"testing"
+	"time"
+)
+
+func TestStore_DeleteMovesToTrash(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now})
+	store.Create(t.Context(), models.Item{ID: "test-2", Location: "Location 2", Count: 1, DateTime: now})
+
+	if err := store.Delete(t.Context(), "test-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if len(store.GetAll(t.Context())) != 1 {
+		t.Errorf("Expected deleted item to be hidden from GetAll")
+	}
+	if _, err := store.Update(t.Context(), "test-1", models.Item{Location: "Elsewhere", Count: 1, DateTime: now}, nil); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound updating a deleted item, got %v", err)
+	}
+	if err := store.Delete(t.Context(), "test-1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err := store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now}); err != ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists reusing a trashed ID, got %v", err)
+	}
+
+	trash := store.GetTrash()
+	if len(trash) != 1 || trash[0].ID != "test-1" || trash[0].DeletedAt == nil {
+		t.Fatalf("Expected test-1 in trash, got %v", trash)
+	}
+}
+
+func TestStore_Restore(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now})
+	store.Delete(t.Context(), "test-1")
+
+	restored, err := store.Restore(t.Context(), "test-1", "tester", nil)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Error("Expected DeletedAt to be cleared")
+	}
+	if _, err := store.Get(t.Context(), "test-1"); err != nil {
+		t.Errorf("Expected restored item to be readable, got %v", err)
+	}
+
+	if _, err := store.Restore(t.Context(), "test-1", "tester", nil); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound restoring an active item, got %v", err)
+	}
+}
+
+func TestStore_Purge(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.Create(t.Context(), models.Item{ID: "test-1", Location: "Location 1", Count: 1, DateTime: now})
+
+	if err := store.Purge(t.Context(), "test-1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound purging an active item, got %v", err)
+	}
+
+	store.Delete(t.Context(), "test-1")
+	if err := store.Purge(t.Context(), "test-1"); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if len(store.GetTrash()) != 0 {
+		t.Error("Expected trash to be empty after purge")
+	}
+	if _, err := store.Restore(t.Context(), "test-1", "tester", nil); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound restoring a purged item, got %v", err)
+	}
+	if _, ok := store.tombstones["test-1"]; !ok {
+		t.Error("Expected purge to leave a tombstone")
+	}
+}
+
+func TestStore_PurgeDeletedBefore(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	old := now.Add(-40 * 24 * time.Hour)
+	store.Create(t.Context(), models.Item{ID: "old", Location: "Location 1", Count: 1, DateTime: now})
+	store.Create(t.Context(), models.Item{ID: "recent", Location: "Location 2", Count: 1, DateTime: now})
+	store.Delete(t.Context(), "old")
+	store.Delete(t.Context(), "recent")
+
+	// Backdate the first deletion past the retention period
+	item := store.items["old"]
+	item.DeletedAt = &old
+	store.items["old"] = item
+
+	purged, err := store.PurgeDeletedBefore(t.Context(), now.Add(-30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeDeletedBefore failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 item purged, got %d", purged)
+	}
+
+	trash := store.GetTrash()
+	if len(trash) != 1 || trash[0].ID != "recent" {
+		t.Errorf("Expected only the recent deletion to remain, got %v", trash)
+	}
+}
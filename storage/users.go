@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"service/models"
+)
+
+// CreateUser adds a new user. Email addresses are unique, ignoring case.
+func (s *Store) CreateUser(user models.User) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[user.ID]; exists {
+		return models.User{}, ErrAlreadyExists
+	}
+	if s.emailTaken(user.Email, "") {
+		return models.User{}, ErrAlreadyExists
+	}
+
+	if s.users == nil {
+		s.users = make(map[string]models.User)
+	}
+	s.users[user.ID] = user
+	return user, s.save(context.Background())
+}
+
+// GetUser retrieves a user by ID
+func (s *Store) GetUser(id string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// GetUsers retrieves all users ordered by creation time
+func (s *Store) GetUsers() []models.User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	return users
+}
+
+// UpdateUser modifies an existing user
+func (s *Store) UpdateUser(id string, user models.User) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, exists := s.users[id]
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+	if s.emailTaken(user.Email, id) {
+		return models.User{}, ErrAlreadyExists
+	}
+
+	user.ID = id
+	user.CreatedAt = prev.CreatedAt
+	s.users[id] = user
+	return user, s.save(context.Background())
+}
+
+// emailTaken reports whether a user other than exceptID uses email; callers
+// hold s.mu
+func (s *Store) emailTaken(email, exceptID string) bool {
+	for id, user := range s.users {
+		if id != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"service/models"
+	"testing"
+	"time"
+)
+
+func TestStore_CreateUser(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	user := models.User{ID: "user-1", Name: "Alice", Email: "alice@example.com", Role: models.RoleUser, CreatedAt: now}
+	if _, err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	retrieved, err := store.GetUser("user-1")
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if retrieved.Email != user.Email {
+		t.Errorf("Expected Email %s, got %s", user.Email, retrieved.Email)
+	}
+
+	dup := models.User{ID: "user-2", Name: "Alice again", Email: "ALICE@example.com", Role: models.RoleUser}
+	if _, err := store.CreateUser(dup); err != ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists for duplicate email, got %v", err)
+	}
+
+	if _, err := store.GetUser("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_UpdateUser(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.CreateUser(models.User{ID: "user-1", Name: "Alice", Email: "alice@example.com", Role: models.RoleUser, CreatedAt: now})
+	store.CreateUser(models.User{ID: "user-2", Name: "Bob", Email: "bob@example.com", Role: models.RoleUser, CreatedAt: now})
+
+	updated, err := store.UpdateUser("user-1", models.User{Name: "Alice B", Email: "alice@example.com", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if updated.Role != models.RoleAdmin || !updated.CreatedAt.Equal(now) {
+		t.Errorf("Unexpected updated user: %+v", updated)
+	}
+
+	if _, err := store.UpdateUser("user-1", models.User{Name: "Alice", Email: "bob@example.com", Role: models.RoleUser}); err != ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists taking another user's email, got %v", err)
+	}
+	if _, err := store.UpdateUser("missing", models.User{Email: "x@example.com"}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_UsersPersistence(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	store.CreateUser(models.User{ID: "user-1", Name: "Alice", Email: "alice@example.com", Role: models.RoleUser})
+
+	reloaded := newStore(store.filepath)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(reloaded.GetUsers()) != 1 {
+		t.Errorf("Expected 1 user after reload, got %d", len(reloaded.GetUsers()))
+	}
+}
+
+func TestStore_UpdateKeepsOwner(t *testing.T) {
+	store := createTestStore(t)
+	defer cleanupTestStore(store)
+
+	now := time.Now()
+	store.Create(t.Context(), models.Item{ID: "test-1", Location: "Forest", Count: 1, DateTime: now, Owner: "user-1"})
+
+	updated, err := store.Update(t.Context(), "test-1", models.Item{Location: "Woods", Count: 2, DateTime: now, Owner: "user-2"}, nil)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.Owner != "user-1" {
+		t.Errorf("Expected owner user-1, got %s", updated.Owner)
+	}
+}
@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Exporter receives spans as they end. Exporters must be safe for concurrent
+// use.
+type Exporter interface {
+	ExportSpan(service string, span *Span)
+}
+
+// OTLPExporter writes each span as one line of OTLP JSON, the format of the
+// OpenTelemetry Collector's file exporter, which its otlpjsonfile receiver
+// reads back to forward traces to any backend
+type OTLPExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewOTLPExporter(w io.Writer) *OTLPExporter {
+	return &OTLPExporter{w: w}
+}
+
+func (e *OTLPExporter) ExportSpan(service string, span *Span) {
+	data, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValueOf(service)}}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "service/tracing"},
+			Spans: []otlpSpan{{
+				TraceID:           span.TraceID,
+				SpanID:            span.SpanID,
+				ParentSpanID:      span.ParentSpanID,
+				Name:              span.Name,
+				Kind:              int(span.Kind),
+				StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+				EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+				Attributes:        otlpAttributes(span.Attributes),
+				Status:            otlpStatus{Code: int(span.Status), Message: span.StatusMessage},
+			}},
+		}},
+	}}})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(data)
+}
+
+// OTLPFileExporter appends OTLP JSON spans to a file
+type OTLPFileExporter struct {
+	*OTLPExporter
+	file *os.File
+}
+
+// NewOTLPFileExporter opens path for appending, creating it if needed
+func NewOTLPFileExporter(path string) (*OTLPFileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &OTLPFileExporter{OTLPExporter: NewOTLPExporter(file), file: file}, nil
+}
+
+// Close closes the file
+func (e *OTLPFileExporter) Close() error {
+	return e.file.Close()
+}
+
+// StdoutExporter writes each span as a short JSON line for reading during
+// local development
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutExporter writes spans to w, usually os.Stdout
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{w: w}
+}
+
+func (e *StdoutExporter) ExportSpan(service string, span *Span) {
+	line := struct {
+		Span         string                 `json:"span"`
+		TraceID      string                 `json:"traceId"`
+		SpanID       string                 `json:"spanId"`
+		ParentSpanID string                 `json:"parentSpanId,omitempty"`
+		Start        string                 `json:"start"`
+		DurationMs   float64                `json:"durationMs"`
+		Attributes   map[string]interface{} `json:"attributes,omitempty"`
+		Error        string                 `json:"error,omitempty"`
+	}{
+		Span:         span.Name,
+		TraceID:      span.TraceID,
+		SpanID:       span.SpanID,
+		ParentSpanID: span.ParentSpanID,
+		Start:        span.StartTime.UTC().Format("15:04:05.000000"),
+		DurationMs:   float64(span.Duration().Microseconds()) / 1000,
+		Attributes:   span.Attributes,
+	}
+	if span.Status == StatusError {
+		line.Error = span.StatusMessage
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(data)
+}
+
+// The OTLP JSON encoding of traces; IDs are hex and 64-bit integers are
+// strings
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// otlpAttributes converts attributes in key order
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	converted := make([]otlpAttribute, len(keys))
+	for i, k := range keys {
+		converted[i] = otlpAttribute{Key: k, Value: otlpValueOf(attributes[k])}
+	}
+	return converted
+}
+
+func otlpValueOf(v interface{}) otlpValue {
+	switch v := v.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	}
+	s := fmt.Sprint(v)
+	return otlpValue{StringValue: &s}
+}
@@ -0,0 +1,222 @@
+// Package tracing records OpenTelemetry spans for requests and the work done
+// to serve them, and exports them in the OTLP JSON format, without depending
+// on the OpenTelemetry SDK.
+//
+// Spans share their trace and request IDs with logger.Trace, so log entries
+// written during a span carry its span ID.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"service/logger"
+)
+
+// SpanKind is the OpenTelemetry span kind
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+)
+
+// StatusCode is the OpenTelemetry span status
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Span is one timed operation within a trace. A nil Span, returned while
+// tracing is off, ignores every call.
+type Span struct {
+	tracer *Tracer
+
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         SpanKind
+	StartTime    time.Time
+	EndTime      time.Time
+
+	mu            sync.Mutex
+	Attributes    map[string]interface{}
+	Status        StatusCode
+	StatusMessage string
+	ended         bool
+}
+
+// SetAttribute records key, such as "shroomp.item.id", with a string,
+// boolean, integer or floating point value
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.Attributes[key] = value
+	}
+}
+
+// SetError marks the span as failed with err; a nil err is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.Status = StatusError
+	s.StatusMessage = err.Error()
+}
+
+// End ends the span and exports it; later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+	s.tracer.exporter.ExportSpan(s.tracer.service, s)
+}
+
+// Duration is how long the span took
+func (s *Span) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// Tracer starts spans and hands finished ones to its exporter
+type Tracer struct {
+	exporter Exporter
+	service  string
+}
+
+// Option configures a Tracer
+type Option func(*Tracer)
+
+// WithService sets the service.name resource attribute of exported spans
+func WithService(name string) Option {
+	return func(t *Tracer) {
+		t.service = name
+	}
+}
+
+// NewTracer returns a tracer exporting to exporter; a nil exporter turns
+// tracing off
+func NewTracer(exporter Exporter, opts ...Option) *Tracer {
+	t := &Tracer{exporter: exporter, service: "shroomp-service"}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Enabled reports whether spans are recorded
+func (t *Tracer) Enabled() bool {
+	return t.exporter != nil
+}
+
+type contextKey struct{}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// StartRequest starts the server span of a request, using the span ID and
+// parent that middleware.RequestContext put in the request's trace so that
+// they match the traceparent response header and log entries
+func (t *Tracer) StartRequest(ctx context.Context, name string) (context.Context, *Span) {
+	if !t.Enabled() {
+		return ctx, nil
+	}
+	trace, ok := logger.TraceFromContext(ctx)
+	if !ok || trace.TraceID == "" {
+		return t.Start(ctx, name)
+	}
+	span := t.newSpan(name, SpanKindServer, trace.TraceID, trace.SpanID, trace.ParentSpanID)
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// Start starts a span for work within the span or request trace carried by
+// ctx, or a new trace without either. Log entries written with the returned
+// context carry the new span's ID.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if !t.Enabled() {
+		return ctx, nil
+	}
+	trace, _ := logger.TraceFromContext(ctx)
+	parentID := trace.SpanID
+	if parent := SpanFromContext(ctx); parent != nil {
+		trace.TraceID, parentID = parent.TraceID, parent.SpanID
+	}
+	if trace.TraceID == "" {
+		trace.TraceID, parentID = randomHex(16), ""
+	}
+
+	span := t.newSpan(name, SpanKindInternal, trace.TraceID, randomHex(8), parentID)
+	trace.SpanID, trace.ParentSpanID = span.SpanID, parentID
+	ctx = logger.WithTrace(ctx, trace)
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+func (t *Tracer) newSpan(name string, kind SpanKind, traceID, spanID, parentID string) *Span {
+	return &Span{
+		tracer:       t,
+		TraceID:      traceID,
+		SpanID:       spanID,
+		ParentSpanID: parentID,
+		Name:         name,
+		Kind:         kind,
+		StartTime:    time.Now(),
+		Attributes:   make(map[string]interface{}),
+	}
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// defaultTracer is used by the package-level functions; tracing is off until
+// SetDefault is called with an exporting tracer
+var defaultTracer atomic.Pointer[Tracer]
+
+func init() {
+	defaultTracer.Store(NewTracer(nil))
+}
+
+// Default returns the tracer used by the package-level functions
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+// SetDefault makes t the tracer used by the package-level functions
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span with the default tracer
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return Default().Start(ctx, name)
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"service/logger"
+)
+
+// memoryExporter keeps ended spans for inspection
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *memoryExporter) ExportSpan(service string, span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func TestTracer_Hierarchy(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(exporter)
+
+	ctx := logger.WithTrace(context.Background(), logger.Trace{
+		RequestID:    "req-1",
+		TraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:       "1111111111111111",
+		ParentSpanID: "00f067aa0ba902b7",
+	})
+	ctx, server := tracer.StartRequest(ctx, "POST /items")
+	childCtx, child := tracer.Start(ctx, "storage.create")
+	_, grandchild := tracer.Start(childCtx, "storage.save")
+	grandchild.SetError(errors.New("disk full"))
+	grandchild.End()
+	child.End()
+	server.End()
+	server.End()
+
+	if len(exporter.spans) != 3 {
+		t.Fatalf("Expected 3 spans exported once each, got %d", len(exporter.spans))
+	}
+	if server.SpanID != "1111111111111111" || server.ParentSpanID != "00f067aa0ba902b7" || server.Kind != SpanKindServer {
+		t.Errorf("Expected the server span to take the request's IDs, got %+v", server)
+	}
+	if child.ParentSpanID != server.SpanID || grandchild.ParentSpanID != child.SpanID {
+		t.Error("Expected each span to be the child of the span in its context")
+	}
+	for _, span := range exporter.spans {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected %s in the request's trace, got %s", span.Name, span.TraceID)
+		}
+		if span.EndTime.Before(span.StartTime) {
+			t.Errorf("Expected %s to end after it started", span.Name)
+		}
+	}
+	if grandchild.Status != StatusError || grandchild.StatusMessage != "disk full" {
+		t.Errorf("Expected error status, got %v %q", grandchild.Status, grandchild.StatusMessage)
+	}
+
+	// Log entries written within a span carry its ID
+	trace, _ := logger.TraceFromContext(childCtx)
+	if trace.SpanID != child.SpanID || trace.RequestID != "req-1" {
+		t.Errorf("Expected the context's trace to point at the child span, got %+v", trace)
+	}
+}
+
+func TestTracer_NewTrace(t *testing.T) {
+	tracer := NewTracer(&memoryExporter{})
+	_, span := tracer.Start(context.Background(), "retention")
+	if len(span.TraceID) != 32 || len(span.SpanID) != 16 || span.ParentSpanID != "" {
+		t.Errorf("Expected a root span of a new trace, got %+v", span)
+	}
+}
+
+func TestTracer_Disabled(t *testing.T) {
+	tracer := NewTracer(nil)
+	ctx := context.Background()
+	got, span := tracer.Start(ctx, "storage.create")
+	if span != nil || got != ctx {
+		t.Fatal("Expected no span while tracing is off")
+	}
+	// A nil span ignores every call
+	span.SetAttribute("shroomp.item.id", "abc")
+	span.SetError(errors.New("ignored"))
+	span.End()
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewOTLPExporter(&buf), WithService("shroomp"))
+	_, span := tracer.Start(context.Background(), "storage.save")
+	span.SetAttribute("shroomp.storage.bytes", 1045)
+	span.SetAttribute("shroomp.item.id", "abc")
+	span.SetAttribute("shroomp.batch.atomic", true)
+	span.SetError(errors.New("disk full"))
+	span.End()
+
+	var got struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Expected one OTLP JSON line, got %q", buf.String())
+	}
+	rs := got.ResourceSpans[0]
+	if *rs.Resource.Attributes[0].Value.StringValue != "shroomp" {
+		t.Errorf("Expected service.name resource attribute, got %+v", rs.Resource.Attributes)
+	}
+	s := rs.ScopeSpans[0].Spans[0]
+	if s.TraceID != span.TraceID || s.SpanID != span.SpanID || s.Name != "storage.save" || s.Kind != int(SpanKindInternal) {
+		t.Errorf("Unexpected span %+v", s)
+	}
+	if s.Status.Code != int(StatusError) || s.Status.Message != "disk full" {
+		t.Errorf("Expected error status, got %+v", s.Status)
+	}
+	// Attributes are sorted by key, with 64-bit integers as strings
+	if len(s.Attributes) != 3 || s.Attributes[0].Key != "shroomp.batch.atomic" || !*s.Attributes[0].Value.BoolValue ||
+		*s.Attributes[1].Value.StringValue != "abc" || *s.Attributes[2].Value.IntValue != "1045" {
+		t.Errorf("Unexpected attributes %+v", s.Attributes)
+	}
+	if !strings.Contains(buf.String(), `"startTimeUnixNano":"`) {
+		t.Errorf("Expected timestamps as strings, got %s", buf.String())
+	}
+}
+
+func TestOTLPFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	exporter, err := NewOTLPFileExporter(path)
+	if err != nil {
+		t.Fatalf("NewOTLPFileExporter failed: %v", err)
+	}
+	tracer := NewTracer(exporter)
+	for _, name := range []string{"decode", "validate"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.End()
+	}
+	exporter.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("Expected one line per span, got %q", data)
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewStdoutExporter(&buf))
+	_, span := tracer.Start(context.Background(), "decode")
+	span.SetAttribute("http.request.body.size", int64(83))
+	span.End()
+
+	if !strings.Contains(buf.String(), `"span":"decode"`) || !strings.Contains(buf.String(), `"http.request.body.size":83`) {
+		t.Errorf("Unexpected output %s", buf.String())
+	}
+}
@@ -0,0 +1,132 @@
+// Package validation checks request values against rules and collects every
+// violation, each located by a JSON pointer, instead of stopping at the first.
+package validation
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"service/problem"
+)
+
+// Validator collects the rules broken by the value at its location. Checks
+// name fields relative to it.
+type Validator struct {
+	path string
+	errs *Errors
+}
+
+// New returns a validator for a whole request body
+func New() *Validator {
+	return &Validator{errs: &Errors{}}
+}
+
+// At returns a validator for the value below v at the reference tokens, such
+// as At("operations", "2", "item"). It adds to the same errors as v.
+func (v *Validator) At(tokens ...string) *Validator {
+	path := v.path
+	for _, token := range tokens {
+		path += "/" + escape(token)
+	}
+	return &Validator{path: path, errs: v.errs}
+}
+
+// Index returns a validator for element i of the array field
+func (v *Validator) Index(field string, i int) *Validator {
+	return v.At(field, strconv.Itoa(i))
+}
+
+// Pointer returns the JSON pointer of field
+func (v *Validator) Pointer(field string) string {
+	return v.path + "/" + escape(field)
+}
+
+// Check records a violation of field unless ok, and reports ok
+func (v *Validator) Check(ok bool, field, code, detail string) bool {
+	if !ok {
+		*v.errs = append(*v.errs, problem.Invalid(v.Pointer(field), code, detail))
+	}
+	return ok
+}
+
+// Required checks that field is present
+func (v *Validator) Required(field string, present bool) bool {
+	return v.Check(present, field, problem.CodeRequired, field+" is required")
+}
+
+// Min checks that field is at least min
+func (v *Validator) Min(field string, got, min float64) bool {
+	return v.Check(got >= min, field, problem.CodeMin, field+" must be at least "+format(min))
+}
+
+// Max checks that field is at most max
+func (v *Validator) Max(field string, got, max float64) bool {
+	return v.Check(got <= max, field, problem.CodeMax, field+" must be at most "+format(max))
+}
+
+// Between checks that field lies within [min, max], reporting the bound it
+// crosses
+func (v *Validator) Between(field string, got, min, max float64) bool {
+	detail := field + " must be between " + format(min) + " and " + format(max)
+	return v.Check(got >= min, field, problem.CodeMin, detail) &&
+		v.Check(got <= max, field, problem.CodeMax, detail)
+}
+
+// NotAfter checks that the time in field is not after limit
+func (v *Validator) NotAfter(field string, got, limit time.Time, detail string) bool {
+	return v.Check(!got.After(limit), field, problem.CodeMax, detail)
+}
+
+// OneOf checks that field is one of allowed
+func (v *Validator) OneOf(field, got string, allowed ...string) bool {
+	for _, a := range allowed {
+		if got == a {
+			return true
+		}
+	}
+	return v.Check(false, field, problem.CodeFormat, field+" must be one of "+strings.Join(allowed, ", "))
+}
+
+// Valid reports whether no rule has been broken so far
+func (v *Validator) Valid() bool {
+	return len(*v.errs) == 0
+}
+
+// Err returns the violations recorded by v and every validator derived from
+// it, or nil
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return *v.errs
+}
+
+// Errors lists every violation found in a request, in the order checked
+type Errors []*problem.FieldError
+
+func (e Errors) Error() string {
+	details := make([]string, len(e))
+	for i, fe := range e {
+		details[i] = fe.Detail
+	}
+	return strings.Join(details, "; ")
+}
+
+// Unwrap returns the field errors, so that problem.Validation lists them all
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// escape encodes a JSON pointer reference token
+func escape(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func format(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
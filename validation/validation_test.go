@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"service/problem"
+)
+
+func TestValidator(t *testing.T) {
+	now := time.Now()
+	v := New()
+	v.Required("name", false)
+	v.Min("count", 0, 1)
+	v.Max("count", 5, 10)
+	v.Between("latitude", 91, -90, 90)
+	v.Between("longitude", -181, -180, 180)
+	v.NotAfter("dateTime", now.Add(time.Hour), now, "dateTime must not be in the future")
+	v.OneOf("visibility", "secret", "public", "private")
+	item := v.Index("operations", 2).At("item")
+	item.Required("location", false)
+	v.At("a/b~c").Required("x", false)
+
+	want := []problem.FieldError{
+		{Field: "/name", Code: problem.CodeRequired, Detail: "name is required"},
+		{Field: "/count", Code: problem.CodeMin, Detail: "count must be at least 1"},
+		{Field: "/latitude", Code: problem.CodeMax, Detail: "latitude must be between -90 and 90"},
+		{Field: "/longitude", Code: problem.CodeMin, Detail: "longitude must be between -180 and 180"},
+		{Field: "/dateTime", Code: problem.CodeMax, Detail: "dateTime must not be in the future"},
+		{Field: "/visibility", Code: problem.CodeFormat, Detail: "visibility must be one of public, private"},
+		{Field: "/operations/2/item/location", Code: problem.CodeRequired, Detail: "location is required"},
+		{Field: "/a~1b~0c/x", Code: problem.CodeRequired, Detail: "x is required"},
+	}
+
+	if v.Valid() || item.Valid() {
+		t.Error("Expected validators sharing errors to be invalid")
+	}
+	got := problem.FieldErrors(v.Err())
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d violations, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], got[i])
+		}
+	}
+
+	p := problem.Validation(v.Err())
+	if len(p.Errors) != len(want) || p.Detail != v.Err().Error() {
+		t.Errorf("Expected the problem to list every violation, got %+v", p)
+	}
+}
+
+func TestValidator_Valid(t *testing.T) {
+	v := New()
+	if !v.Required("name", true) || !v.Between("count", 3, 1, 10) || !v.OneOf("role", "user", "user", "admin") {
+		t.Error("Expected passing checks to report true")
+	}
+	if err := v.Err(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	v.Required("name", false)
+	var errs Errors
+	if !errors.As(v.Err(), &errs) || len(errs) != 1 {
+		t.Errorf("Expected Errors, got %v", v.Err())
+	}
+}